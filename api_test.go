@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jwoodsiii/chirpy/internal/config"
+	"github.com/jwoodsiii/chirpy/internal/media"
+	"github.com/jwoodsiii/chirpy/internal/migrate"
+	"github.com/jwoodsiii/chirpy/internal/store"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/api")
+
+const (
+	testPolkaKey      = "polka-test-key"
+	testAdminEmail    = "admin@example.com"
+	testAdminPassword = "admin-password"
+)
+
+// apiClient talks to a chirpy server running under httptest.
+type apiClient struct {
+	t      *testing.T
+	cfg    *apiConfig
+	server *httptest.Server
+	golden *goldenNormalizer
+}
+
+// newTestAPI serves the real router over httptest. It uses the in-memory
+// store unless CHIRPY_TEST_DB_URL names a database (Postgres, or sqlite:
+// for a file), which is migrated and wiped first, so never point it at
+// real data.
+func newTestAPI(t *testing.T) *apiClient {
+	t.Helper()
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+
+	conf := config.Default()
+	conf.Platform = "dev"
+	conf.JWTSecret = "test-secret"
+	conf.PolkaKey = testPolkaKey
+	conf.Chirps.BlockedWords = []string{"grawlix"}
+	conf.Chirps.FlaggedWords = []string{"snollygoster"}
+	// webhook tests deliver to httptest servers on loopback
+	conf.Webhooks.AllowPrivate = true
+
+	blobs, err := media.NewLocalBlobStore(t.TempDir(), "/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg *apiConfig
+	if dsn := os.Getenv("CHIRPY_TEST_DB_URL"); dsn != "" {
+		b := parseDatabaseURL(dsn)
+		db, err := openDB(b)
+		if err != nil {
+			t.Fatalf("opening CHIRPY_TEST_DB_URL: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		m, err := migrate.New(db, b.dialect, b.schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Up(context.Background()); err != nil {
+			t.Fatalf("migrating test database: %v", err)
+		}
+		st := b.newStore(db)
+		if err := st.DeleteUsers(context.Background()); err != nil {
+			t.Fatalf("wiping test database: %v", err)
+		}
+		cfg = newAPIConfig(conf, st, db, m, blobs)
+		if cfg.jobs != nil {
+			// jobs aren't tied to users, so wiping them doesn't clear the queue
+			if _, err := db.Exec("delete from jobs"); err != nil {
+				t.Fatalf("wiping test database: %v", err)
+			}
+		}
+	} else {
+		cfg = newAPIConfig(conf, store.NewMemory(), nil, nil, blobs)
+	}
+
+	if err := cfg.bootstrapAdmin(context.Background(), testAdminEmail, testAdminPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(cfg.routes())
+	t.Cleanup(server.Close)
+	return &apiClient{t: t, cfg: cfg, server: server, golden: newGoldenNormalizer()}
+}
+
+// do sends body as JSON with the given Authorization header, which may be
+// empty, and returns the status and response body.
+func (c *apiClient) do(method, path, authorization string, body any) (int, []byte) {
+	c.t.Helper()
+
+	var reqBody io.Reader
+	if body != nil {
+		dat, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reqBody = bytes.NewReader(dat)
+	}
+	req, err := http.NewRequest(method, c.server.URL+path, reqBody)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := c.server.Client().Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	dat, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp.StatusCode, dat
+}
+
+// check sends a request and compares the response with the golden file
+// testdata/api/<name>.json. It returns the decoded body.
+func (c *apiClient) check(name, method, path, authorization string, body any) map[string]any {
+	c.t.Helper()
+
+	status, dat := c.do(method, path, authorization, body)
+	var decoded any
+	if len(dat) > 0 {
+		if err := json.Unmarshal(dat, &decoded); err != nil {
+			c.t.Fatalf("%s: response isn't JSON: %v\n%s", name, err, dat)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(map[string]any{
+		"status": status,
+		"body":   c.golden.normalize("", decoded),
+	}); err != nil {
+		c.t.Fatal(err)
+	}
+	got := buf.Bytes()
+
+	path = filepath.Join("testdata", "api", name+".json")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		c.t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		c.t.Errorf("%s: response doesn't match %s\ngot:\n%s\nwant:\n%s", name, path, got, want)
+	}
+
+	obj, _ := decoded.(map[string]any)
+	return obj
+}
+
+var uuidPattern = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// goldenNormalizer replaces the values that change from run to run.
+// UUIDs become <uuid-N>, numbered in order of first appearance across the
+// whole test, so golden files still show which IDs are the same.
+type goldenNormalizer struct {
+	uuids map[string]string
+}
+
+func newGoldenNormalizer() *goldenNormalizer {
+	return &goldenNormalizer{uuids: map[string]string{}}
+}
+
+func (g *goldenNormalizer) normalize(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, child := range v {
+			out[k] = g.normalize(k, child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = g.normalize(key, child)
+		}
+		return out
+	case string:
+		switch {
+		case key == "created_at" || key == "updated_at":
+			return "<timestamp>"
+		case key == "token" || key == "refresh_token" || key == "request_id":
+			return "<" + strings.ReplaceAll(key, "_", "-") + ">"
+		}
+		return uuidPattern.ReplaceAllStringFunc(v, func(id string) string {
+			if _, ok := g.uuids[id]; !ok {
+				g.uuids[id] = fmt.Sprintf("<uuid-%d>", len(g.uuids)+1)
+			}
+			return g.uuids[id]
+		})
+	}
+	return v
+}
+
+// TestAPIRejectsMalformedBodies covers the checks decodeJSON makes before
+// a handler sees the request.
+func TestAPIRejectsMalformedBodies(t *testing.T) {
+	c := newTestAPI(t)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"no content type", "", `{"email":"a@example.com","password":"password"}`, http.StatusUnsupportedMediaType},
+		{"form content type", "application/x-www-form-urlencoded", "email=a@example.com", http.StatusUnsupportedMediaType},
+		{"empty body", "application/json", "", http.StatusBadRequest},
+		{"syntax error", "application/json", `{"email":`, http.StatusBadRequest},
+		{"not an object", "application/json", `["a@example.com"]`, http.StatusBadRequest},
+		{"trailing data", "application/json", `{"email":"a@example.com","password":"password"} {}`, http.StatusBadRequest},
+		{"too large", "application/json", `{"email":"` + strings.Repeat("a", maxJSONBodyBytes) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", c.server.URL+"/api/users", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			resp, err := c.server.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func bearer(token any) string {
+	return fmt.Sprintf("Bearer %v", token)
+}
+
+func TestAPI(t *testing.T) {
+	c := newTestAPI(t)
+
+	alice := c.check("signup", "POST", "/api/users", "", map[string]string{"email": "alice@example.com", "password": "alice-password"})
+	c.check("signup_duplicate", "POST", "/api/users", "", map[string]string{"email": "alice@example.com", "password": "other-password"})
+	c.check("signup_invalid", "POST", "/api/users", "", map[string]string{"email": "not-an-email", "password": "short"})
+	c.check("signup_unknown_field", "POST", "/api/users", "", map[string]any{"email": "carol@example.com", "password": "carol-password", "admin": true})
+	c.check("signup_wrong_type", "POST", "/api/users", "", map[string]any{"email": "carol@example.com", "password": 12345678})
+	bob := c.check("signup_second_user", "POST", "/api/users", "", map[string]string{"email": "bob@example.com", "password": "bob-password"})
+
+	c.check("login_bad_password", "POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "wrong"})
+	c.check("login_unknown_email", "POST", "/api/login", "", map[string]string{"email": "carol@example.com", "password": "x"})
+	aliceLogin := c.check("login", "POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "alice-password"})
+	bobLogin := c.check("login_second_user", "POST", "/api/login", "", map[string]string{"email": "bob@example.com", "password": "bob-password"})
+	aliceAuth, bobAuth := bearer(aliceLogin["token"]), bearer(bobLogin["token"])
+
+	c.check("chirp_create_unauthenticated", "POST", "/api/chirps", "", map[string]string{"body": "hello"})
+	c.check("chirp_create_too_long", "POST", "/api/chirps", aliceAuth, map[string]string{"body": strings.Repeat("a", 141)})
+	first := c.check("chirp_create", "POST", "/api/chirps", aliceAuth, map[string]string{"body": "What a Kerfuffle this is"})
+	c.check("chirp_create_second_user", "POST", "/api/chirps", bobAuth, map[string]string{"body": "Hi from bob"})
+	c.check("chirp_create_again", "POST", "/api/chirps", aliceAuth, map[string]string{"body": "Second chirp"})
+
+	c.check("chirps_by_invalid_author", "GET", "/api/chirps?author_id=nope", "", nil)
+	c.check("chirps_list", "GET", "/api/chirps", "", nil)
+	c.check("chirps_list_desc", "GET", "/api/chirps?sort=desc", "", nil)
+	c.check("chirps_by_author", "GET", "/api/chirps?author_id="+alice["id"].(string), "", nil)
+	c.check("chirps_by_author_desc", "GET", "/api/chirps?author_id="+alice["id"].(string)+"&sort=desc", "", nil)
+
+	chirpPath := "/api/chirps/" + first["id"].(string)
+	c.check("chirp_get", "GET", chirpPath, "", nil)
+	c.check("chirp_get_invalid_id", "GET", "/api/chirps/not-a-uuid", "", nil)
+	c.check("chirp_delete_not_author", "DELETE", chirpPath, bobAuth, nil)
+	c.check("chirp_delete", "DELETE", chirpPath, aliceAuth, nil)
+	c.check("chirp_get_deleted", "GET", chirpPath, "", nil)
+
+	c.check("chirp_create_masked", "POST", "/api/chirps", aliceAuth, map[string]string{"body": "ＫＥＲＦＵＦＦＬＥ!  what a\nshar\u200bbert, you snollygoster"})
+	c.check("chirp_create_blocked", "POST", "/api/chirps", aliceAuth, map[string]string{"body": "a GRAWLIX."})
+	// 140 emoji are 560 bytes, and the link counts as 23 characters
+	c.check("chirp_create_emoji", "POST", "/api/chirps", bobAuth, map[string]string{"body": strings.Repeat("🐦", 140)})
+	c.check("chirp_create_with_link", "POST", "/api/chirps", bobAuth,
+		map[string]string{"body": strings.Repeat("b", 100) + " https://example.com/" + strings.Repeat("x", 200)})
+
+	aliceRefresh := bearer(aliceLogin["refresh_token"])
+	c.check("refresh", "POST", "/api/refresh", aliceRefresh, nil)
+	c.check("revoke", "POST", "/api/revoke", aliceRefresh, nil)
+	c.check("refresh_revoked", "POST", "/api/refresh", aliceRefresh, nil)
+
+	upgrade := map[string]any{"event": "user.upgraded", "data": map[string]any{"user_id": alice["id"]}}
+	c.check("webhook_missing_key", "POST", "/api/polka/webhooks", "", upgrade)
+	c.check("webhook_wrong_key", "POST", "/api/polka/webhooks", "ApiKey wrong", upgrade)
+	c.check("webhook_other_event", "POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey,
+		map[string]any{"event": "user.payment_failed", "data": map[string]any{"user_id": bob["id"]}})
+	c.check("webhook_invalid_user", "POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey,
+		map[string]any{"event": "user.upgraded", "data": map[string]any{"user_id": "42"}})
+	c.check("webhook_upgrade", "POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey, upgrade)
+	c.check("login_after_upgrade", "POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "alice-password"})
+	c.check("chirp_create_red_member", "POST", "/api/chirps", aliceAuth, map[string]string{"body": strings.Repeat("a", 1000)})
+	c.check("chirp_create_red_too_long", "POST", "/api/chirps", aliceAuth, map[string]string{"body": strings.Repeat("a", 1001)})
+
+	c.check("reset_not_admin", "POST", "/admin/reset", aliceAuth, nil)
+	adminLogin := c.check("login_admin", "POST", "/api/login", "", map[string]string{"email": testAdminEmail, "password": testAdminPassword})
+	c.check("reset", "POST", "/admin/reset", bearer(adminLogin["token"]), nil)
+	c.check("chirps_list_after_reset", "GET", "/api/chirps", "", nil)
+}
+
+func TestBlocksAndMutes(t *testing.T) {
+	c := newTestAPI(t)
+	alice := c.signup("alice@example.com")
+	bob := c.signup("bob@example.com")
+	carol := c.signup("carol@example.com")
+	dave := c.signup("dave@example.com")
+	for _, u := range []testUser{bob, carol, dave} {
+		c.mustDo("POST", "/api/chirps", u.auth, map[string]string{"body": "hi from " + u.id})
+	}
+
+	// authors returns who wrote the chirps at path, as seen by authorization
+	authors := func(path, authorization string) []string {
+		t.Helper()
+		status, dat := c.do("GET", path, authorization, nil)
+		var chirps []Chirp
+		if err := json.Unmarshal(dat, &chirps); status != http.StatusOK || err != nil {
+			t.Fatalf("GET %s: %d %s", path, status, dat)
+		}
+		ids := []string{}
+		for _, chirp := range chirps {
+			ids = append(ids, chirp.UserId.String())
+		}
+		return ids
+	}
+
+	c.mustDo("POST", "/api/users/"+bob.id+"/block", alice.auth, nil)
+	c.mustDo("POST", "/api/users/"+carol.id+"/mute", alice.auth, nil)
+
+	tests := []struct {
+		name, path, authorization string
+		want                      []string
+	}{
+		{"alice's listing", "/api/chirps", alice.auth, []string{dave.id}},
+		{"alice's view of bob", "/api/chirps?author_id=" + bob.id, alice.auth, []string{}},
+		{"alice's view of carol", "/api/chirps?author_id=" + carol.id, alice.auth, []string{}},
+		{"dave's listing", "/api/chirps", dave.auth, []string{bob.id, carol.id, dave.id}},
+		{"bob's listing", "/api/chirps", bob.auth, []string{bob.id, carol.id, dave.id}},
+		{"anonymous listing", "/api/chirps", "", []string{bob.id, carol.id, dave.id}},
+	}
+	for _, tt := range tests {
+		if got := authors(tt.path, tt.authorization); !slices.Equal(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	c.mustDo("DELETE", "/api/users/"+bob.id+"/block", alice.auth, nil)
+	c.mustDo("DELETE", "/api/users/"+carol.id+"/mute", alice.auth, nil)
+	if got := authors("/api/chirps", alice.auth); len(got) != 3 {
+		t.Errorf("alice's listing after unblocking and unmuting = %v, want all three authors", got)
+	}
+}
+
+func TestMetricsAccess(t *testing.T) {
+	c := newTestAPI(t)
+	alice := c.signup("alice@example.com")
+	admin := c.mustDo("POST", "/api/login", "", map[string]string{"email": testAdminEmail, "password": testAdminPassword})
+	adminAuth := bearer(admin["token"])
+
+	tests := []struct {
+		name, token, authorization string
+		want                       int
+	}{
+		{"anonymous without a token", "", "", http.StatusUnauthorized},
+		{"user without a token", "", alice.auth, http.StatusForbidden},
+		{"admin without a token", "", adminAuth, http.StatusOK},
+		{"admin with a token", "scrape-token", adminAuth, http.StatusUnauthorized},
+		{"scraper with a token", "scrape-token", bearer("scrape-token"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		c.cfg.metricsToken = tt.token
+		if status, body := c.do("GET", "/metrics", tt.authorization, nil); status != tt.want {
+			t.Errorf("%s: %d %s, want %d", tt.name, status, body, tt.want)
+		}
+	}
+}
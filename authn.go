@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/logging"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+)
+
+// authenticate validates the request's bearer access token and records the
+// user on the request so it shows up in logs. Errors are Unauthorized
+// problems.
+func (cfg *apiConfig) authenticate(r *http.Request) (uuid.UUID, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, problem.Wrap(problem.Unauthorized, err, "a bearer access token is required")
+	}
+
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		return uuid.Nil, problem.Wrap(problem.Unauthorized, err, "invalid or expired access token")
+	}
+
+	logging.SetUserID(r.Context(), userID.String())
+	return userID, nil
+}
+
+// viewerID returns the authenticated caller for endpoints that also serve
+// anonymous requests. Without an Authorization header it returns uuid.Nil,
+// which matches no block or mute rows, so nothing is filtered.
+func (cfg *apiConfig) viewerID(r *http.Request) (uuid.UUID, error) {
+	userID, err := cfg.authenticate(r)
+	if errors.Is(err, auth.ErrNoAuthHeaderIncluded) {
+		return uuid.Nil, nil
+	}
+	return userID, err
+}
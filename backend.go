@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/migrate"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+	"github.com/jwoodsiii/chirpy/internal/store"
+	"github.com/jwoodsiii/chirpy/sql/schema"
+	sqliteschema "github.com/jwoodsiii/chirpy/sql/sqlite/schema"
+	_ "modernc.org/sqlite"
+)
+
+// backend is the database chirpy runs against, chosen by DB_URL.
+type backend struct {
+	name    string
+	driver  string
+	dsn     string
+	dialect migrate.Dialect
+	schema  fs.FS
+}
+
+// sqlitePragmas are applied to every SQLite connection. Foreign keys are
+// off by default in SQLite, and WAL plus a busy timeout lets readers carry
+// on while a write is in progress.
+const sqlitePragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+// parseDatabaseURL picks the backend for url. URLs starting with sqlite:
+// (as in sqlite:chirpy.db) or file: open a SQLite database; anything else
+// is handed to the Postgres driver.
+func parseDatabaseURL(url string) backend {
+	path, isSQLite := strings.CutPrefix(url, "sqlite:")
+	if !isSQLite {
+		path, isSQLite = strings.CutPrefix(url, "file:")
+	}
+	if !isSQLite {
+		return backend{name: "postgres", driver: "postgres", dsn: url, dialect: migrate.Postgres, schema: schema.FS}
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return backend{
+		name:    "sqlite",
+		driver:  "sqlite",
+		dsn:     "file:" + path + sep + sqlitePragmas,
+		dialect: migrate.SQLite,
+		schema:  sqliteschema.FS,
+	}
+}
+
+// newStore returns the Store for db. The Postgres store's sqlc Queries
+// also serve the features SQLite lacks.
+func (b backend) newStore(db *sql.DB) store.Store {
+	if b.name == "sqlite" {
+		return store.NewSQLite(db)
+	}
+	return store.NewPostgres(db)
+}
+
+// postgresQueries returns the sqlc Queries behind st, which may be a
+// transaction, for the features outside the Store interface. It is nil
+// for the other stores, which don't have them.
+func postgresQueries(st store.Store) *database.Queries {
+	if pg, ok := st.(*store.Postgres); ok {
+		return pg.Queries
+	}
+	return nil
+}
+
+// middlewareRequirePostgres answers 501 for features the SQLite backend
+// doesn't implement: media attachments, reports and moderation, and role
+// changes.
+func (cfg *apiConfig) middlewareRequirePostgres(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.db == nil {
+			respondWithError(w, r, problem.New(problem.NotImplemented, "this feature requires the Postgres backend"))
+			return
+		}
+		next(w, r)
+	}
+}
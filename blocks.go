@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+)
+
+func (cfg *apiConfig) handlerBlockUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, targetID, ok := cfg.relationshipParams(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.store.BlockUser(r.Context(), database.BlockUserParams{BlockerID: userID, BlockedID: targetID}); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't block user"))
+		return
+	}
+
+	respondWithJson(w, http.StatusNoContent, "")
+}
+
+func (cfg *apiConfig) handlerUnblockUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, targetID, ok := cfg.relationshipParams(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.store.UnblockUser(r.Context(), database.UnblockUserParams{BlockerID: userID, BlockedID: targetID}); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't unblock user"))
+		return
+	}
+
+	respondWithJson(w, http.StatusNoContent, "")
+}
+
+func (cfg *apiConfig) handlerMuteUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, targetID, ok := cfg.relationshipParams(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.store.MuteUser(r.Context(), database.MuteUserParams{MuterID: userID, MutedID: targetID}); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't mute user"))
+		return
+	}
+
+	respondWithJson(w, http.StatusNoContent, "")
+}
+
+func (cfg *apiConfig) handlerUnmuteUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, targetID, ok := cfg.relationshipParams(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.store.UnmuteUser(r.Context(), database.UnmuteUserParams{MuterID: userID, MutedID: targetID}); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't unmute user"))
+		return
+	}
+
+	respondWithJson(w, http.StatusNoContent, "")
+}
+
+// relationshipParams authenticates the caller and resolves the {id} path
+// value to an existing user other than the caller. It writes the error
+// response itself and reports whether the handler should continue.
+func (cfg *apiConfig) relationshipParams(w http.ResponseWriter, r *http.Request) (userID, targetID uuid.UUID, ok bool) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	targetID, err = pathUUID(r, "id")
+	if err != nil {
+		respondWithError(w, r, err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if targetID == userID {
+		respondWithError(w, r, problem.New(problem.ValidationFailed, "you can't do that to yourself"))
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if _, err := cfg.store.GetUser(r.Context(), targetID); err != nil {
+		respondWithError(w, r, problem.New(problem.NotFound, "user not found"))
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, targetID, true
+}
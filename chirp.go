@@ -1,56 +1,76 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
-	"io"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/jwoodsiii/chirpy/internal/auth"
 	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/filter"
+	"github.com/jwoodsiii/chirpy/internal/jobs"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+	"github.com/jwoodsiii/chirpy/internal/store"
+	"github.com/jwoodsiii/chirpy/internal/textlen"
+	"github.com/jwoodsiii/chirpy/internal/validate"
 )
 
 type Chirp struct {
-	Id        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserId    uuid.UUID `json:"user_id"`
+	Id        uuid.UUID         `json:"id"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Body      string            `json:"body"`
+	UserId    uuid.UUID         `json:"user_id"`
+	Media     []MediaAttachment `json:"media"`
 }
 
 func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
 	r.Body.Close()
 
-	token, err := auth.GetBearerToken(r.Header)
+	userID, err := cfg.authenticate(r)
 	if err != nil {
-		respondWithError(w, 401, err.Error())
+		respondWithError(w, r, err)
+		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	id, err := pathUUID(r, "chirpID")
 	if err != nil {
-		respondWithError(w, 403, err.Error())
+		respondWithError(w, r, err)
 		return
 	}
 
-	id := r.PathValue("chirpID")
-
-	chirp, err := cfg.db.GetChirp(r.Context(), uuid.MustParse(id))
+	chirp, err := cfg.store.GetChirp(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, problem.Wrap(problem.NotFound, err, "chirp not found"))
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, err.Error())
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't delete chirp"))
+		return
 	}
 
 	if chirp.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "not authorized to delete this chirp")
+		respondWithError(w, r, problem.New(problem.Forbidden, "not authorized to delete this chirp"))
+		return
 	}
-	_, err = cfg.db.DeleteChirp(r.Context(), database.DeleteChirpParams{ID: uuid.MustParse(id), UserID: userID})
+	deleted := ChirpDeleted{Id: chirp.ID, UserId: chirp.UserID}
+	err = cfg.store.InTx(r.Context(), func(tx store.Store, exec jobs.Execer) error {
+		if _, err := tx.DeleteChirp(r.Context(), database.DeleteChirpParams{ID: id, UserID: userID}); err != nil {
+			return err
+		}
+		return cfg.enqueueWebhooks(r.Context(), postgresQueries(tx), exec, eventChirpDeleted, chirp.UserID, deleted)
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't delete chirp"))
 		return
 	}
+	cfg.metrics.chirpsDeleted.Inc()
+	cfg.publishChirpEvent(eventChirpDeleted, chirp.UserID, chirp.Body, deleted)
 
 	respondWithJson(w, http.StatusNoContent, "")
 
@@ -59,10 +79,9 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	id := r.PathValue("chirpID")
-	log.Printf("ID before uuid parse: %s", id)
-	if id == "" {
-		respondWithError(w, http.StatusBadRequest, "missing chirp ID")
+	id, err := pathUUID(r, "chirpID")
+	if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
@@ -70,38 +89,58 @@ func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
 		Chirp
 	}
 
-	chirp, err := cfg.db.GetChirp(r.Context(), uuid.MustParse(id))
+	chirp, err := cfg.store.GetChirp(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, problem.Wrap(problem.NotFound, err, "chirp not found"))
+		return
+	}
 	if err != nil {
-		log.Printf("Database error: %v attempting to pull id: %s", err, uuid.MustParse(id))
-		respondWithError(w, http.StatusNotFound, "Couldn't retrieve chirp")
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't retrieve chirp"))
 		return
 	}
 
-	respondWithJson(w, http.StatusOK, responseBody{
-		Chirp{
-			Id:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserId:    chirp.UserID,
-		},
-	})
+	res := []Chirp{{
+		Id:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserId:    chirp.UserID,
+	}}
+	if err := cfg.loadChirpMedia(r.Context(), res); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "Couldn't retrieve chirp media"))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, responseBody{res[0]})
 }
 
 func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
-	author := r.URL.Query().Get("author_id")
+	author, err := queryUUID(r, "author_id")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
 	sortDirection := "asc"
 	sortDirectionParam := r.URL.Query().Get("sort")
 	if sortDirectionParam == "desc" {
 		sortDirection = "desc"
 	}
 
+	viewerID, err := cfg.viewerID(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
 	chirps := []Chirp{}
-	if author != "" {
-		dbChirps, err := cfg.db.GetChirpsByAuthor(r.Context(), uuid.MustParse(author))
+	if author != uuid.Nil {
+		dbChirps, err := cfg.store.GetChirpsByAuthor(r.Context(), database.GetChirpsByAuthorParams{
+			UserID:   author,
+			ViewerID: viewerID,
+		})
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+			respondWithError(w, r, problem.Wrap(problem.Internal, err, "Couldn't retrieve chirps"))
 			return
 		} else {
 			for _, dbChirp := range dbChirps {
@@ -120,14 +159,19 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 				return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
 			})
 
+			if err := cfg.loadChirpMedia(r.Context(), chirps); err != nil {
+				respondWithError(w, r, problem.Wrap(problem.Internal, err, "Couldn't retrieve chirp media"))
+				return
+			}
+
 			respondWithJson(w, http.StatusOK, chirps)
 			return
 		}
 	}
 
-	dbChirps, err := cfg.db.GetChirps(r.Context())
+	dbChirps, err := cfg.store.GetChirps(r.Context(), viewerID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "Couldn't retrieve chirps"))
 		return
 	}
 
@@ -148,80 +192,159 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 		return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
 	})
 
+	if err := cfg.loadChirpMedia(r.Context(), chirps); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "Couldn't retrieve chirp media"))
+		return
+	}
+
 	respondWithJson(w, http.StatusOK, chirps)
 }
 
 func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
+	type mediaParams struct {
+		ID      string `json:"id" validate:"required,uuid"`
+		AltText string `json:"alt_text" validate:"required,max=1000"`
+	}
+
+	// The body's length limit depends on the author's tier, so it is
+	// checked below.
 	type requestBody struct {
-		Body string `json:"body"`
+		Body  string        `json:"body"`
+		Media []mediaParams `json:"media" validate:"max=4"`
 	}
 
 	type responseBody struct {
 		Chirp
 	}
 
-	tokenString, err := auth.GetBearerToken(r.Header)
+	userId, err := cfg.authenticate(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "invalid token")
+		respondWithError(w, r, err)
 		return
 	}
 
-	userId, err := auth.ValidateJWT(tokenString, cfg.jwtSecret)
+	user, err := cfg.store.GetUser(r.Context(), userId)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "invalid token")
+		respondWithError(w, r, problem.Wrap(problem.Unauthorized, err, "invalid or expired access token"))
 		return
 	}
-
-	dat, err := io.ReadAll(r.Body)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "error reading response body")
+	if restriction := accountRestriction(user); restriction != "" {
+		respondWithError(w, r, problem.New(problem.Forbidden, restriction))
 		return
 	}
 
 	var params requestBody
-	if err := json.Unmarshal(dat, &params); err != nil {
-		respondWithError(w, http.StatusBadRequest, "error unmarshalling request body")
+	if err := decodeJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
-	// handle chirp len
-	if len(params.Body) > 140 {
-		respondWithError(w, http.StatusBadRequest, "chirp is too long")
+	if limit, n := cfg.chirpLengthLimit(user), textlen.Count(params.Body); n > limit {
+		respondWithError(w, r, problem.Wrap(problem.ValidationFailed,
+			validate.Errors{{Field: "body", Message: fmt.Sprintf("must be at most %d characters", limit), Limit: limit, Count: n}},
+			fmt.Sprintf("chirp is %d characters long, the limit is %d", n, limit)))
 		return
 	}
 
-	chirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{Body: handleProfanity(params.Body), UserID: userId})
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error creating chirp")
+	mediaIDs := make([]uuid.UUID, len(params.Media))
+	seen := make(map[uuid.UUID]bool, len(params.Media))
+	for i, m := range params.Media {
+		id, err := uuid.Parse(m.ID)
+		if err != nil {
+			respondWithError(w, r, validate.Errors{{Field: fmt.Sprintf("media[%d].id", i), Message: "must be a UUID"}})
+			return
+		}
+		if seen[id] {
+			respondWithError(w, r, validate.Errors{{Field: fmt.Sprintf("media[%d].id", i), Message: "is attached more than once"}})
+			return
+		}
+		params.Media[i].AltText = strings.TrimSpace(m.AltText)
+		mediaIDs[i] = id
+		seen[id] = true
+	}
+
+	filtered := cfg.contentFilter().Check(params.Body)
+	if filtered.Has(filter.Reject) {
+		respondWithError(w, r, problem.Wrap(problem.ValidationFailed,
+			validate.Errors{{Field: "body", Message: "contains a word that isn't allowed"}},
+			"chirp contains a blocked word"))
 		return
 	}
 
-	// handle profane
-	respondWithJson(w, http.StatusCreated, responseBody{
-		Chirp{
-			Id:        chirp.ID,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-			Body:      chirp.Body,
-			UserId:    chirp.UserID,
-		},
+	if len(params.Media) > 0 && cfg.db == nil {
+		respondWithError(w, r, problem.New(problem.NotImplemented, "media attachments require the Postgres backend"))
+		return
+	}
+
+	var chirp database.Chirp
+	var res []Chirp
+	err = cfg.store.InTx(r.Context(), func(tx store.Store, exec jobs.Execer) error {
+		var err error
+		chirp, err = tx.CreateChirp(r.Context(), database.CreateChirpParams{Body: filtered.Text, UserID: userId})
+		if err != nil {
+			return err
+		}
+
+		q := postgresQueries(tx)
+		for i, m := range params.Media {
+			attached, err := q.AttachChirpMedia(r.Context(), database.AttachChirpMediaParams{
+				ChirpID:  chirp.ID,
+				Position: int32(i),
+				AltText:  m.AltText,
+				MediaID:  mediaIDs[i],
+				UserID:   userId,
+			})
+			if err != nil {
+				return problem.Wrap(problem.Internal, err, "error attaching media")
+			}
+			if attached == 0 {
+				return problem.Newf(problem.ValidationFailed, "media %s not found or already attached", mediaIDs[i])
+			}
+		}
+
+		res = []Chirp{newChirpResponse(chirp)}
+		if err := cfg.loadChirpMediaWith(r.Context(), q, res); err != nil {
+			return problem.Wrap(problem.Internal, err, "Couldn't retrieve chirp media")
+		}
+		return cfg.enqueueWebhooks(r.Context(), q, exec, eventChirpCreated, chirp.UserID, res[0])
 	})
+	if errors.As(err, new(*problem.Error)) {
+		respondWithError(w, r, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "error creating chirp"))
+		return
+	}
+	cfg.metrics.chirpsCreated.Inc()
+	if filtered.Has(filter.Flag) {
+		cfg.flagChirp(r.Context(), chirp, filtered.Words(filter.Flag))
+	}
+	cfg.publishChirpEvent(eventChirpCreated, chirp.UserID, chirp.Body, res[0])
+
+	respondWithJson(w, http.StatusCreated, responseBody{res[0]})
 }
 
-func handleProfanity(chirp string) string {
-	// kerfuffle
-	// sharbert
-	// fornax
-	c := strings.Fields(chirp)
-	for i, v := range c {
-		switch strings.ToLower(v) {
-		case "kerfuffle", "sharbert", "fornax":
-			c[i] = "****"
-		}
+// newChirpResponse is a just-created chirp, before its media is loaded.
+func newChirpResponse(chirp database.Chirp) Chirp {
+	return Chirp{
+		Id:        chirp.ID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Body:      chirp.Body,
+		UserId:    chirp.UserID,
+	}
+}
+
+// chirpLengthLimit is the most characters, as counted by textlen, that
+// user may post in one chirp.
+func (cfg *apiConfig) chirpLengthLimit(user database.User) int {
+	if user.IsChirpyRed {
+		return cfg.redMaxChirpLength
 	}
-	return strings.Join(c, " ")
+	return cfg.maxChirpLength
 }
 
 func respondWithJson(w http.ResponseWriter, code int, payload any) error {
@@ -236,6 +359,7 @@ func respondWithJson(w http.ResponseWriter, code int, payload any) error {
 	return nil
 }
 
-func respondWithError(w http.ResponseWriter, code int, msg string) error {
-	return respondWithJson(w, code, map[string]string{"error": msg})
+// respondWithError writes err as problem details; see package problem.
+func respondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	problem.Write(w, r, err)
 }
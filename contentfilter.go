@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/config"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/filter"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+)
+
+const (
+	// filterRefreshInterval is how often each replica reloads the terms
+	// admins manage, so a change made on one replica reaches the others.
+	filterRefreshInterval = time.Minute
+
+	// reportReasonFilter marks reports raised by the content filter
+	// rather than a user; it can't be chosen through the report endpoint.
+	reportReasonFilter = "filter"
+
+	moderationSetFilterTerm    = "set_filter_term"
+	moderationDeleteFilterTerm = "delete_filter_term"
+)
+
+type FilterTerm struct {
+	Word      string        `json:"word"`
+	Action    filter.Action `json:"action"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	UpdatedBy *uuid.UUID    `json:"updated_by"`
+}
+
+// configFilterTerms turns the word lists in c into filter terms.
+func configFilterTerms(c config.Chirps) []filter.Term {
+	var terms []filter.Term
+	for _, list := range []struct {
+		words  []string
+		action filter.Action
+	}{
+		{c.ProfaneWords, filter.Mask},
+		{c.FlaggedWords, filter.Flag},
+		{c.BlockedWords, filter.Reject},
+	} {
+		for _, w := range list.words {
+			terms = append(terms, filter.Term{Word: w, Action: list.action})
+		}
+	}
+	return terms
+}
+
+// contentFilter returns the filter chirps are checked against.
+func (cfg *apiConfig) contentFilter() *filter.Filter {
+	return cfg.filter.Load()
+}
+
+// reloadFilter rebuilds the content filter from the configured words and,
+// on Postgres, the terms managed at /admin/filter/terms, which take
+// precedence over configured ones.
+func (cfg *apiConfig) reloadFilter(ctx context.Context) error {
+	terms := slices.Clone(cfg.filterTerms)
+	if cfg.db != nil {
+		dbTerms, err := cfg.db.ListFilterTerms(ctx)
+		if err != nil {
+			return fmt.Errorf("load filter terms: %w", err)
+		}
+		for _, t := range dbTerms {
+			terms = append(terms, filter.Term{Word: t.Word, Action: filter.Action(t.Action)})
+		}
+	}
+	cfg.filter.Store(filter.New(terms))
+	return nil
+}
+
+// runFilterRefresher reloads the content filter every interval.
+func (cfg *apiConfig) runFilterRefresher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := cfg.reloadFilter(ctx); err != nil {
+			slog.ErrorContext(ctx, "filter refresh failed, keeping the current terms", "err", err)
+		}
+	}
+}
+
+// flagChirp files a report on chirp for the moderation queue listing the
+// flagged words it contains. Reports need Postgres, so elsewhere the flag
+// is only logged. The chirp has already been posted, so failures are
+// logged rather than returned.
+func (cfg *apiConfig) flagChirp(ctx context.Context, chirp database.Chirp, words []string) {
+	if cfg.db == nil {
+		slog.WarnContext(ctx, "chirp flagged by filter", "chirp_id", chirp.ID, "words", words)
+		return
+	}
+	if _, err := cfg.db.CreateReport(ctx, database.CreateReportParams{
+		ChirpID:       uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		ChirpAuthorID: chirp.UserID,
+		ChirpBody:     chirp.Body,
+		Reason:        reportReasonFilter,
+		Details:       "contains flagged words: " + strings.Join(words, ", "),
+	}); err != nil {
+		slog.ErrorContext(ctx, "couldn't report flagged chirp", "chirp_id", chirp.ID, "err", err)
+	}
+}
+
+func (cfg *apiConfig) handlerListFilterTerms(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	dbTerms, err := cfg.db.ListFilterTerms(r.Context())
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't list filter terms"))
+		return
+	}
+
+	terms := []FilterTerm{}
+	for _, t := range dbTerms {
+		terms = append(terms, filterTermFromDB(t))
+	}
+	respondWithJson(w, http.StatusOK, terms)
+}
+
+func (cfg *apiConfig) handlerPutFilterTerm(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type requestBody struct {
+		Action filter.Action `json:"action" validate:"required,oneof=mask reject flag"`
+	}
+
+	admin := userFromContext(r.Context())
+
+	word, err := filterWordParam(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var params requestBody
+	if err := decodeJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't save filter term"))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	term, err := qtx.UpsertFilterTerm(r.Context(), database.UpsertFilterTermParams{
+		Word:      word,
+		Action:    string(params.Action),
+		UpdatedBy: uuid.NullUUID{UUID: admin.ID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't save filter term"))
+		return
+	}
+
+	if _, err := qtx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID: uuid.NullUUID{UUID: admin.ID, Valid: true},
+		Action:      moderationSetFilterTerm,
+		Note:        fmt.Sprintf("%s -> %s", word, params.Action),
+	}); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't save filter term"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't save filter term"))
+		return
+	}
+	cfg.reloadFilterAfterChange(r.Context())
+
+	respondWithJson(w, http.StatusOK, filterTermFromDB(term))
+}
+
+func (cfg *apiConfig) handlerDeleteFilterTerm(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	admin := userFromContext(r.Context())
+
+	word, err := filterWordParam(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't delete filter term"))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	deleted, err := qtx.DeleteFilterTerm(r.Context(), word)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't delete filter term"))
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, r, problem.New(problem.NotFound, "filter term not found"))
+		return
+	}
+
+	if _, err := qtx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID: uuid.NullUUID{UUID: admin.ID, Valid: true},
+		Action:      moderationDeleteFilterTerm,
+		Note:        word,
+	}); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't delete filter term"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't delete filter term"))
+		return
+	}
+	cfg.reloadFilterAfterChange(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reloadFilterAfterChange applies an admin's change on this replica at
+// once. The change is already saved, so a failure only delays it until
+// the next refresh.
+func (cfg *apiConfig) reloadFilterAfterChange(ctx context.Context) {
+	if err := cfg.reloadFilter(ctx); err != nil {
+		slog.ErrorContext(ctx, "couldn't reload filter terms", "err", err)
+	}
+}
+
+// filterWordParam returns the {word} path value in the normalized form
+// terms are stored and matched in.
+func filterWordParam(r *http.Request) (string, error) {
+	word := filter.Normalize(r.PathValue("word"))
+	if !filter.IsWord(word) {
+		return "", problem.New(problem.ValidationFailed, "a filter term must be a single word")
+	}
+	return word, nil
+}
+
+func filterTermFromDB(t database.FilterTerm) FilterTerm {
+	return FilterTerm{
+		Word:      t.Word,
+		Action:    filter.Action(t.Action),
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+		UpdatedBy: nullUUIDPtr(t.UpdatedBy),
+	}
+}
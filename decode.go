@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+	"github.com/jwoodsiii/chirpy/internal/validate"
+)
+
+// maxJSONBodyBytes caps JSON request bodies. Media uploads are multipart
+// and have their own limit.
+const maxJSONBodyBytes = 1 << 20
+
+// decodeJSON decodes the JSON object in r's body into v and validates it
+// against v's validate tags. The body must be sent as application/json,
+// hold exactly one object and only use fields v declares. The returned
+// error is always a problem.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	return decodeBody(w, r, v, false)
+}
+
+// decodeOptionalJSON is decodeJSON for endpoints whose body may be left
+// out entirely; an empty body is validated as an empty object.
+func decodeOptionalJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	return decodeBody(w, r, v, true)
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v any, optional bool) error {
+	dat, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return problem.Newf(problem.PayloadTooLarge, "request body must not exceed %d bytes", tooLarge.Limit)
+	}
+	if err != nil {
+		return problem.Wrap(problem.BadRequest, err, "couldn't read request")
+	}
+
+	if len(bytes.TrimSpace(dat)) == 0 {
+		if !optional {
+			return problem.New(problem.BadRequest, "request body is required")
+		}
+		return validate.Struct(v)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return problem.New(problem.UnsupportedMediaType, "request body must be sent as application/json")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(dat))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	if dec.More() {
+		return problem.New(problem.BadRequest, "request body must contain a single JSON object")
+	}
+
+	return validate.Struct(v)
+}
+
+// decodeError turns a json.Decoder error into a problem, naming the field
+// at fault where there is one.
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return validate.Errors{{Field: typeErr.Field, Message: "must be " + jsonType(typeErr.Type)}}
+	case errors.As(err, &typeErr):
+		return problem.Wrap(problem.BadRequest, err, "request body must be a JSON object")
+	}
+
+	// encoding/json has no error type for unknown fields.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return validate.Errors{{Field: strings.Trim(field, `"`), Message: "is not a known field"}}
+	}
+	return problem.Wrap(problem.BadRequest, err, "request body is not valid JSON")
+}
+
+// jsonType describes the JSON value that decodes into t.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+// pathUUID parses the path value name as a UUID.
+func pathUUID(r *http.Request, name string) (uuid.UUID, error) {
+	return parseUUIDParam(name, r.PathValue(name))
+}
+
+// queryUUID parses the query parameter name as a UUID, returning uuid.Nil
+// when it is absent.
+func queryUUID(r *http.Request, name string) (uuid.UUID, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return uuid.Nil, nil
+	}
+	return parseUUIDParam(name, v)
+}
+
+// queryUUIDs parses every value of the query parameter name as a UUID.
+func queryUUIDs(r *http.Request, name string) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for _, v := range r.URL.Query()[name] {
+		id, err := parseUUIDParam(name, v)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func parseUUIDParam(name, v string) (uuid.UUID, error) {
+	id, err := uuid.Parse(v)
+	if err != nil {
+		return uuid.Nil, problem.Wrap(problem.ValidationFailed,
+			validate.Errors{{Field: name, Message: "must be a UUID"}},
+			fmt.Sprintf("%s is not a valid ID", name))
+	}
+	return id, nil
+}
@@ -118,3 +118,73 @@ func TestCheckPasswordHash(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAccessToken(t *testing.T) {
+	userID := uuid.New()
+	adminToken, _ := MakeJWTWithRole(userID, RoleAdmin, "secret", time.Hour)
+	plainToken, _ := MakeJWT(userID, "secret", time.Hour)
+
+	tests := []struct {
+		name        string
+		tokenString string
+		wantRole    Role
+		wantErr     bool
+	}{
+		{
+			name:        "Token with role",
+			tokenString: adminToken,
+			wantRole:    RoleAdmin,
+		},
+		{
+			name:        "Token without role",
+			tokenString: plainToken,
+			wantRole:    "",
+		},
+		{
+			name:        "Invalid token",
+			tokenString: "invalid.token.string",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAccessToken(tt.tokenString, "secret")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAccessToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.UserID != userID || got.Role != tt.wantRole {
+				t.Errorf("ParseAccessToken() = %+v, want user %v role %q", got, userID, tt.wantRole)
+			}
+			if time.Since(got.IssuedAt) > time.Minute {
+				t.Errorf("ParseAccessToken() IssuedAt = %v, want recent", got.IssuedAt)
+			}
+			if d := got.ExpiresAt.Sub(got.IssuedAt); d != time.Hour {
+				t.Errorf("ParseAccessToken() expires %v after issue, want 1h", d)
+			}
+		})
+	}
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role Role
+		min  Role
+		want bool
+	}{
+		{RoleAdmin, RoleModerator, true},
+		{RoleModerator, RoleModerator, true},
+		{RoleUser, RoleModerator, false},
+		{"", RoleUser, false},
+		{"superuser", RoleUser, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.AtLeast(tt.min); got != tt.want {
+			t.Errorf("Role(%q).AtLeast(%q) = %v, want %v", tt.role, tt.min, got, tt.want)
+		}
+	}
+}
@@ -9,50 +9,105 @@ import (
 	"github.com/google/uuid"
 )
 
+// AccessClaims are the claims carried by an access token. Role is a
+// snapshot taken when the token was issued.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	Role Role `json:"role,omitempty"`
+}
+
+// AccessToken is the validated content of an access token.
+type AccessToken struct {
+	UserID    uuid.UUID
+	Role      Role
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
 // MakeJWT -
 func MakeJWT(
 	userID uuid.UUID,
 	tokenSecret string,
 	expiresIn time.Duration,
+) (string, error) {
+	return MakeJWTWithRole(userID, "", tokenSecret, expiresIn)
+}
+
+// MakeJWTWithRole issues an access token that also carries the user's role.
+func MakeJWTWithRole(
+	userID uuid.UUID,
+	role Role,
+	tokenSecret string,
+	expiresIn time.Duration,
 ) (string, error) {
 	signingKey := []byte(tokenSecret)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    string(TokenTypeAccess),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeAccess),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Role: role,
 	})
 	return token.SignedString(signingKey)
 }
 
 // ValidateJWT -
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claimsStruct := jwt.RegisteredClaims{}
+	token, err := ParseAccessToken(tokenString, tokenSecret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return token.UserID, nil
+}
+
+// ParseAccessToken validates an access token and returns its user, role and
+// issue time.
+func ParseAccessToken(tokenString, tokenSecret string) (AccessToken, error) {
+	claimsStruct := AccessClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&claimsStruct,
 		func(token *jwt.Token) (any, error) { return []byte(tokenSecret), nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
 	)
 	if err != nil {
-		return uuid.Nil, err
+		return AccessToken{}, err
 	}
 
 	userIDString, err := token.Claims.GetSubject()
 	if err != nil {
-		return uuid.Nil, err
+		return AccessToken{}, err
 	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, err
+		return AccessToken{}, err
 	}
 	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+		return AccessToken{}, errors.New("invalid issuer")
 	}
 
 	id, err := uuid.Parse(userIDString)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+		return AccessToken{}, fmt.Errorf("invalid user ID: %w", err)
 	}
-	return id, nil
+
+	var issuedAt time.Time
+	if claimsStruct.IssuedAt != nil {
+		issuedAt = claimsStruct.IssuedAt.Time
+	}
+
+	var expiresAt time.Time
+	if claimsStruct.ExpiresAt != nil {
+		expiresAt = claimsStruct.ExpiresAt.Time
+	}
+
+	return AccessToken{
+		UserID:    id,
+		Role:      claimsStruct.Role,
+		IssuedAt:  issuedAt,
+		ExpiresAt: expiresAt,
+	}, nil
 }
@@ -0,0 +1,399 @@
+// Package config loads chirpy's settings. Values come from, in increasing
+// order of precedence: built-in defaults, an optional YAML file, and
+// environment variables (which main seeds from a .env file without
+// overriding variables that are already set). Every problem found is
+// reported at once so a misconfigured deployment can be fixed in one pass.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces secret values when the configuration is printed.
+const Redacted = "[REDACTED]"
+
+// Config is the full set of settings. Fields tagged env can be set by that
+// environment variable; fields tagged secret are redacted by Print. List
+// values are comma separated in the environment. DatabaseURL is either a
+// Postgres URL or sqlite:<path> for a SQLite database file.
+type Config struct {
+	Platform      string `yaml:"platform" env:"PLATFORM"`
+	DatabaseURL   string `yaml:"database_url" env:"DB_URL" secret:"true"`
+	JWTSecret     string `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	PolkaKey      string `yaml:"polka_key" env:"POLKA_KEY" secret:"true"`
+	MetricsToken  string `yaml:"metrics_token" env:"METRICS_TOKEN" secret:"true"`
+	MediaDir      string `yaml:"media_dir" env:"MEDIA_DIR"`
+	AdminEmail    string `yaml:"admin_email" env:"ADMIN_EMAIL"`
+	AdminPassword string `yaml:"admin_password" env:"ADMIN_PASSWORD" secret:"true"`
+
+	// MigrateOnStart applies pending migrations before serving.
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"MIGRATE_ON_START"`
+
+	Log       Log       `yaml:"log"`
+	Server    Server    `yaml:"server"`
+	Auth      Auth      `yaml:"auth"`
+	Chirps    Chirps    `yaml:"chirps"`
+	RateLimit RateLimit `yaml:"rate_limit"`
+	Stream    Stream    `yaml:"stream"`
+	Webhooks  Webhooks  `yaml:"webhooks"`
+	Jobs      Jobs      `yaml:"jobs"`
+}
+
+type Log struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+type Server struct {
+	Addr              string        `yaml:"addr" env:"ADDR"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	ShutdownDelay     time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" env:"MAX_HEADER_BYTES"`
+	TLSCertFile       string        `yaml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile        string        `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+
+	// RequestTimeout bounds each API request and UploadTimeout each media
+	// upload; zero disables them.
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT"`
+	UploadTimeout  time.Duration `yaml:"upload_timeout" env:"UPLOAD_TIMEOUT"`
+	// MaxConcurrentRequests is how many requests are served at once before
+	// the rest are turned away with a 503; zero means no limit.
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests" env:"MAX_CONCURRENT_REQUESTS"`
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For header is believed when finding the client IP.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// TLSEnabled reports whether the server should serve HTTPS.
+func (s Server) TLSEnabled() bool {
+	return s.TLSCertFile != ""
+}
+
+// TrustedProxyPrefixes parses TrustedProxies. A bare address is a
+// single-address prefix.
+func (s Server) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(s.TrustedProxies))
+	for _, p := range s.TrustedProxies {
+		if addr, err := netip.ParseAddr(p); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES entries must be IP addresses or CIDR ranges, got %q", p)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+type Auth struct {
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+}
+
+type RateLimit struct {
+	// Enabled turns on the per-route limits on logins, signups, posting
+	// and uploads.
+	Enabled bool `yaml:"enabled" env:"RATE_LIMIT_ENABLED"`
+}
+
+// Stream configures the real-time event streams. MaxClients caps open
+// streams, zero meaning no cap; Replay is how many recent events a
+// reconnecting client can resume from, and QueueSize how many may wait
+// for one client before it is disconnected as too slow.
+type Stream struct {
+	MaxClients int `yaml:"max_clients" env:"STREAM_MAX_CLIENTS"`
+	Replay     int `yaml:"replay" env:"STREAM_REPLAY"`
+	QueueSize  int `yaml:"queue_size" env:"STREAM_QUEUE_SIZE"`
+}
+
+// Webhooks configures outbound webhook delivery. Each delivery is tried
+// up to MaxAttempts times, backing off exponentially, before it is
+// dead-lettered. AllowPrivate lets endpoints use plain HTTP and private or
+// loopback addresses, which is only safe in development.
+type Webhooks struct {
+	MaxAttempts  int           `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	Timeout      time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT"`
+	AllowPrivate bool          `yaml:"allow_private" env:"WEBHOOK_ALLOW_PRIVATE"`
+}
+
+// Jobs configures the background job runner. Concurrency is how many jobs
+// one instance runs at once and PollInterval how often it looks for due
+// ones when idle. On shutdown, running jobs get DrainTimeout to finish
+// before they are interrupted and put back in the queue.
+type Jobs struct {
+	Concurrency  int           `yaml:"concurrency" env:"JOB_CONCURRENCY"`
+	PollInterval time.Duration `yaml:"poll_interval" env:"JOB_POLL_INTERVAL"`
+	DrainTimeout time.Duration `yaml:"drain_timeout" env:"JOB_DRAIN_TIMEOUT"`
+}
+
+// Chirps configures posting. Lengths are in user-perceived characters
+// with links counted as 23; MaxLength applies to everyone and RedMaxLength
+// to Chirpy Red members. ProfaneWords are masked, BlockedWords make a
+// chirp be rejected and FlaggedWords send it to the moderation queue.
+// Admins can add to and override these lists at /admin/filter/terms.
+type Chirps struct {
+	MaxLength    int      `yaml:"max_length" env:"CHIRP_MAX_LENGTH"`
+	RedMaxLength int      `yaml:"red_max_length" env:"CHIRP_RED_MAX_LENGTH"`
+	ProfaneWords []string `yaml:"profane_words" env:"PROFANE_WORDS"`
+	BlockedWords []string `yaml:"blocked_words" env:"BLOCKED_WORDS"`
+	FlaggedWords []string `yaml:"flagged_words" env:"FLAGGED_WORDS"`
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() Config {
+	return Config{
+		MediaDir: "media",
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+		Server: Server{
+			Addr: ":8080",
+			// uploads of up to 10 MiB have to fit in the read timeout
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			RequestTimeout:    10 * time.Second,
+			UploadTimeout:     30 * time.Second,
+
+			MaxConcurrentRequests: 256,
+		},
+		Auth: Auth{
+			AccessTokenTTL:  time.Hour,
+			RefreshTokenTTL: 60 * 24 * time.Hour,
+		},
+		Chirps: Chirps{
+			MaxLength:    140,
+			RedMaxLength: 1000,
+			ProfaneWords: []string{"kerfuffle", "sharbert", "fornax"},
+		},
+		RateLimit: RateLimit{
+			Enabled: true,
+		},
+		Stream: Stream{
+			MaxClients: 1000,
+			Replay:     1024,
+			QueueSize:  64,
+		},
+		Webhooks: Webhooks{
+			MaxAttempts: 8,
+			Timeout:     10 * time.Second,
+		},
+		Jobs: Jobs{
+			Concurrency:  10,
+			PollInterval: 5 * time.Second,
+			DrainTimeout: 20 * time.Second,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path
+// when path isn't empty, and the variables visible through lookupEnv
+// (normally os.LookupEnv), then validates it.
+func Load(path string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg, err := Parse(path, lookupEnv)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Parse is Load without validation, for tools such as the migrate command
+// that only need a few settings.
+func Parse(path string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	var errs []error
+	walk(reflect.ValueOf(&cfg).Elem(), func(f reflect.StructField, v reflect.Value) {
+		name := f.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		raw, ok := lookupEnv(name)
+		if !ok || raw == "" {
+			return
+		}
+		if err := setFromString(v, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	})
+	return cfg, errors.Join(errs...)
+}
+
+func loadFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting, joined into one error.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.DatabaseURL != "", "DB_URL is required")
+	check(c.JWTSecret != "", "JWT_SECRET is required")
+	check(c.MediaDir != "", "MEDIA_DIR must not be empty")
+	check(c.AdminPassword == "" || c.AdminEmail != "", "ADMIN_PASSWORD is set without ADMIN_EMAIL")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "LOG_LEVEL must be debug, info, warn or error, got %q", c.Log.Level)
+	check(c.Log.Format == "json" || c.Log.Format == "text", "LOG_FORMAT must be json or text, got %q", c.Log.Format)
+
+	check(c.Server.Addr != "", "ADDR must not be empty")
+	check(c.Server.ReadTimeout >= 0, "READ_TIMEOUT must not be negative")
+	check(c.Server.ReadHeaderTimeout >= 0, "READ_HEADER_TIMEOUT must not be negative")
+	check(c.Server.WriteTimeout >= 0, "WRITE_TIMEOUT must not be negative")
+	check(c.Server.IdleTimeout >= 0, "IDLE_TIMEOUT must not be negative")
+	check(c.Server.ShutdownTimeout >= 0, "SHUTDOWN_TIMEOUT must not be negative")
+	check(c.Server.ShutdownDelay >= 0, "SHUTDOWN_DELAY must not be negative")
+	check(c.Server.MaxHeaderBytes > 0, "MAX_HEADER_BYTES must be positive")
+	check((c.Server.TLSCertFile == "") == (c.Server.TLSKeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	check(c.Server.RequestTimeout >= 0, "REQUEST_TIMEOUT must not be negative")
+	check(c.Server.UploadTimeout >= 0, "UPLOAD_TIMEOUT must not be negative")
+	check(c.Server.MaxConcurrentRequests >= 0, "MAX_CONCURRENT_REQUESTS must not be negative")
+	if _, err := c.Server.TrustedProxyPrefixes(); err != nil {
+		errs = append(errs, err)
+	}
+
+	check(c.Auth.AccessTokenTTL > 0, "ACCESS_TOKEN_TTL must be positive")
+	check(c.Auth.RefreshTokenTTL > 0, "REFRESH_TOKEN_TTL must be positive")
+	check(c.Auth.RefreshTokenTTL >= c.Auth.AccessTokenTTL, "REFRESH_TOKEN_TTL must not be shorter than ACCESS_TOKEN_TTL")
+
+	check(c.Stream.MaxClients >= 0, "STREAM_MAX_CLIENTS must not be negative")
+	check(c.Stream.Replay >= 0, "STREAM_REPLAY must not be negative")
+	check(c.Stream.QueueSize > 0, "STREAM_QUEUE_SIZE must be positive")
+
+	check(c.Webhooks.MaxAttempts > 0, "WEBHOOK_MAX_ATTEMPTS must be positive")
+	check(c.Webhooks.Timeout > 0, "WEBHOOK_TIMEOUT must be positive")
+
+	check(c.Jobs.Concurrency > 0, "JOB_CONCURRENCY must be positive")
+	check(c.Jobs.PollInterval > 0, "JOB_POLL_INTERVAL must be positive")
+	check(c.Jobs.DrainTimeout >= 0, "JOB_DRAIN_TIMEOUT must not be negative")
+
+	check(c.Chirps.MaxLength > 0, "CHIRP_MAX_LENGTH must be positive")
+	check(c.Chirps.RedMaxLength >= c.Chirps.MaxLength, "CHIRP_RED_MAX_LENGTH must not be less than CHIRP_MAX_LENGTH")
+	for _, list := range []struct {
+		name  string
+		words []string
+	}{
+		{"PROFANE_WORDS", c.Chirps.ProfaneWords},
+		{"BLOCKED_WORDS", c.Chirps.BlockedWords},
+		{"FLAGGED_WORDS", c.Chirps.FlaggedWords},
+	} {
+		for _, w := range list.words {
+			check(w != "" && !strings.ContainsFunc(w, unicode.IsSpace), "%s entries must be single words, got %q", list.name, w)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Print writes the configuration as YAML with secrets redacted.
+func (c Config) Print(w io.Writer) error {
+	redacted := c
+	walk(reflect.ValueOf(&redacted).Elem(), func(f reflect.StructField, v reflect.Value) {
+		if f.Tag.Get("secret") == "true" && v.String() != "" {
+			v.SetString(Redacted)
+		}
+	})
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(redacted); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// walk calls fn for every leaf field of the struct v, descending into
+// nested structs.
+func walk(v reflect.Value, fn func(reflect.StructField, reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		if f.Type.Kind() == reflect.Struct {
+			walk(fv, fn)
+			continue
+		}
+		fn(f, fv)
+	}
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+func setFromString(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, want a value such as 30s or 1h", raw)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for item := range strings.SplitSeq(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envMap(m map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := m[key]
+		return v, ok
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.yaml")
+	file := `
+database_url: postgres://file
+jwt_secret: from-file
+server:
+  addr: ":9000"
+  read_timeout: 10s
+auth:
+  access_token_ttl: 15m
+chirps:
+  profane_words: [darn]
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path, envMap(map[string]string{
+		"JWT_SECRET":       "from-env",
+		"READ_TIMEOUT":     "20s",
+		"CHIRP_MAX_LENGTH": "280",
+		"PROFANE_WORDS":    "heck, gosh ,",
+	}))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.DatabaseURL != "postgres://file" {
+		t.Errorf("DatabaseURL = %q, want value from file", cfg.DatabaseURL)
+	}
+	if cfg.JWTSecret != "from-env" {
+		t.Errorf("JWTSecret = %q, want env to override file", cfg.JWTSecret)
+	}
+	if cfg.Server.Addr != ":9000" {
+		t.Errorf("Addr = %q, want :9000", cfg.Server.Addr)
+	}
+	if cfg.Server.ReadTimeout != 20*time.Second {
+		t.Errorf("ReadTimeout = %v, want 20s", cfg.Server.ReadTimeout)
+	}
+	if cfg.Auth.AccessTokenTTL != 15*time.Minute {
+		t.Errorf("AccessTokenTTL = %v, want 15m", cfg.Auth.AccessTokenTTL)
+	}
+	if cfg.Auth.RefreshTokenTTL != Default().Auth.RefreshTokenTTL {
+		t.Errorf("RefreshTokenTTL = %v, want default", cfg.Auth.RefreshTokenTTL)
+	}
+	if cfg.Chirps.MaxLength != 280 {
+		t.Errorf("MaxLength = %d, want 280", cfg.Chirps.MaxLength)
+	}
+	if got := strings.Join(cfg.Chirps.ProfaneWords, ","); got != "heck,gosh" {
+		t.Errorf("ProfaneWords = %q, want heck,gosh", got)
+	}
+}
+
+func TestLoadAggregatesErrors(t *testing.T) {
+	_, err := Load("", envMap(map[string]string{
+		"LOG_FORMAT":           "xml",
+		"TLS_CERT_FILE":        "cert.pem",
+		"TRUSTED_PROXIES":      "10.0.0.1,10.0.0.0/33",
+		"CHIRP_RED_MAX_LENGTH": "100",
+		"WEBHOOK_MAX_ATTEMPTS": "0",
+		"JOB_CONCURRENCY":      "0",
+	}))
+	if err == nil {
+		t.Fatal("Load() succeeded, want error")
+	}
+	for _, want := range []string{"DB_URL", "JWT_SECRET", "LOG_FORMAT", "TLS_KEY_FILE", "TRUSTED_PROXIES", "CHIRP_RED_MAX_LENGTH", "WEBHOOK_MAX_ATTEMPTS", "JOB_CONCURRENCY"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %s", err, want)
+		}
+	}
+
+	_, err = Load("", envMap(map[string]string{
+		"READ_TIMEOUT":     "soon",
+		"CHIRP_MAX_LENGTH": "long",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "READ_TIMEOUT") || !strings.Contains(err.Error(), "CHIRP_MAX_LENGTH") {
+		t.Errorf("Load() error = %v, want both parse errors", err)
+	}
+}
+
+func TestLoadRejectsUnknownFileKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.yaml")
+	if err := os.WriteFile(path, []byte("jwt_secrett: typo\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, envMap(nil)); err == nil {
+		t.Error("Load() accepted an unknown key")
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.DatabaseURL = "postgres://user:hunter2@db/chirpy"
+	cfg.JWTSecret = "hunter2"
+
+	var sb strings.Builder
+	if err := cfg.Print(&sb); err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("Print leaked a secret:\n%s", out)
+	}
+	for _, want := range []string{"jwt_secret: '" + Redacted + "'", "polka_key: \"\"", "read_timeout: 30s"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Print output missing %q:\n%s", want, out)
+		}
+	}
+	if cfg.JWTSecret != "hunter2" {
+		t.Error("Print modified the config")
+	}
+}
@@ -82,11 +82,18 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 }
 
 const getChirps = `-- name: GetChirps :many
-select id, created_at, updated_at, body, user_id from chirps order by created_at asc
+select id, created_at, updated_at, body, user_id from chirps
+where not exists (
+    select 1 from user_blocks where blocker_id=$1 and blocked_id=chirps.user_id
+)
+and not exists (
+    select 1 from user_mutes where muter_id=$1 and muted_id=chirps.user_id
+)
+order by created_at asc
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+func (q *Queries) GetChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -115,11 +122,24 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByAuthor = `-- name: GetChirpsByAuthor :many
-select id, created_at, updated_at, body, user_id from chirps where user_id=$1 order by created_at asc
+select id, created_at, updated_at, body, user_id from chirps
+where user_id=$1
+and not exists (
+    select 1 from user_blocks where blocker_id=$2 and blocked_id=chirps.user_id
+)
+and not exists (
+    select 1 from user_mutes where muter_id=$2 and muted_id=chirps.user_id
+)
+order by created_at asc
 `
 
-func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthor, userID)
+type GetChirpsByAuthorParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetChirpsByAuthor(ctx context.Context, arg GetChirpsByAuthorParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByAuthor, arg.UserID, arg.ViewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -146,3 +166,15 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const removeChirp = `-- name: RemoveChirp :execrows
+delete from chirps where id=$1
+`
+
+func (q *Queries) RemoveChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, removeChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
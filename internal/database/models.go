@@ -6,6 +6,7 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,6 +20,86 @@ type Chirp struct {
 	UserID    uuid.UUID
 }
 
+type ChirpMedium struct {
+	ChirpID  uuid.UUID
+	MediaID  uuid.UUID
+	Position int32
+	AltText  string
+}
+
+type FilterTerm struct {
+	Word      string
+	Action    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UpdatedBy uuid.NullUUID
+}
+
+type Job struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Kind        string
+	Payload     json.RawMessage
+	Status      string
+	Attempts    int32
+	MaxAttempts int32
+	RunAt       time.Time
+	LockedUntil sql.NullTime
+	LastError   string
+	UniqueKey   sql.NullString
+}
+
+type MediaUpload struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	UserID       uuid.UUID
+	ContentType  string
+	Width        int32
+	Height       int32
+	Key          string
+	ThumbnailKey string
+	Blurhash     string
+}
+
+type ModerationAction struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	ModeratorID   uuid.NullUUID
+	ReportID      uuid.NullUUID
+	Action        string
+	TargetUserID  uuid.NullUUID
+	TargetChirpID uuid.NullUUID
+	Note          string
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Type      string
+	GroupKey  string
+	EventKeys []string
+	SubjectID uuid.NullUUID
+	ReadAt    sql.NullTime
+}
+
+type NotificationEvent struct {
+	UserID    uuid.UUID
+	Type      string
+	EventKey  string
+	CreatedAt time.Time
+}
+
+type NotificationPreference struct {
+	UserID    uuid.UUID
+	Type      string
+	Enabled   bool
+	UpdatedAt time.Time
+}
+
 type RefreshToken struct {
 	Token     string
 	CreatedAt time.Time
@@ -28,6 +109,23 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime
 }
 
+type Report struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	ReporterID    uuid.NullUUID
+	ChirpID       uuid.NullUUID
+	ChirpAuthorID uuid.UUID
+	ChirpBody     string
+	Reason        string
+	Details       string
+	Status        string
+	AssignedTo    uuid.NullUUID
+	Resolution    sql.NullString
+	ResolvedBy    uuid.NullUUID
+	ResolvedAt    sql.NullTime
+}
+
 type User struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
@@ -35,4 +133,48 @@ type User struct {
 	Email          string
 	HashedPassword string
 	IsChirpyRed    bool
+	AvatarKey      sql.NullString
+	BannerKey      sql.NullString
+	Role           string
+	SuspendedUntil sql.NullTime
+	BannedAt       sql.NullTime
+	RoleUpdatedAt  sql.NullTime
+}
+
+type UserBlock struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
+type UserMute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	EndpointID     uuid.UUID
+	EventType      string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	LastStatusCode sql.NullInt32
+	LastError      string
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Url       string
+	Secret    string
+	Events    []string
+	AllUsers  bool
 }
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -18,19 +19,20 @@ values (
     NOW(),
     NOW(),
     $2,
-    NOW()+interval '60 day',
+    $3,
     null
 )
 returning token, created_at, updated_at, user_id, expires_at, revoked_at
 `
 
 type CreateTokenParams struct {
-	Token  string
-	UserID uuid.UUID
+	Token     string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
 }
 
 func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createToken, arg.Token, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createToken, arg.Token, arg.UserID, arg.ExpiresAt)
 	var i RefreshToken
 	err := row.Scan(
 		&i.Token,
@@ -102,3 +104,15 @@ func (q *Queries) RevokeToken(ctx context.Context, token string) (RefreshToken,
 	)
 	return i, err
 }
+
+const revokeUserTokens = `-- name: RevokeUserTokens :exec
+update refresh_tokens
+set revoked_at=NOW(), updated_at=NOW()
+where user_id=$1
+and revoked_at is null
+`
+
+func (q *Queries) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserTokens, userID)
+	return err
+}
@@ -7,10 +7,38 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const banUser = `-- name: BanUser :one
+update users
+set banned_at=NOW(), updated_at=NOW()
+where id=$1
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, avatar_key, banner_key, role, suspended_until, banned_at, role_updated_at
+`
+
+func (q *Queries) BanUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, banUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.RoleUpdatedAt,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 insert into users (id, created_at, updated_at, email, hashed_password)
 values(
@@ -20,7 +48,7 @@ values(
     $1,
     $2
 )
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, avatar_key, banner_key, role, suspended_until, banned_at, role_updated_at
 `
 
 type CreateUserParams struct {
@@ -38,6 +66,12 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.RoleUpdatedAt,
 	)
 	return i, err
 }
@@ -51,8 +85,32 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 	return err
 }
 
+const getUser = `-- name: GetUser :one
+select id, created_at, updated_at, email, hashed_password, is_chirpy_red, avatar_key, banner_key, role, suspended_until, banned_at, role_updated_at from users where id=$1
+`
+
+func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.RoleUpdatedAt,
+	)
+	return i, err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-select id, created_at, updated_at, email, hashed_password, is_chirpy_red from users where email=$1
+select id, created_at, updated_at, email, hashed_password, is_chirpy_red, avatar_key, banner_key, role, suspended_until, banned_at, role_updated_at from users where email=$1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -65,6 +123,77 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.RoleUpdatedAt,
+	)
+	return i, err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+update users
+set role=$2, role_updated_at=$3, updated_at=NOW()
+where id=$1
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, avatar_key, banner_key, role, suspended_until, banned_at, role_updated_at
+`
+
+type SetUserRoleParams struct {
+	ID            uuid.UUID
+	Role          string
+	RoleUpdatedAt sql.NullTime
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role, arg.RoleUpdatedAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.RoleUpdatedAt,
+	)
+	return i, err
+}
+
+const suspendUser = `-- name: SuspendUser :one
+update users
+set suspended_until=$2, updated_at=NOW()
+where id=$1
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, avatar_key, banner_key, role, suspended_until, banned_at, role_updated_at
+`
+
+type SuspendUserParams struct {
+	ID             uuid.UUID
+	SuspendedUntil sql.NullTime
+}
+
+func (q *Queries) SuspendUser(ctx context.Context, arg SuspendUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, suspendUser, arg.ID, arg.SuspendedUntil)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.RoleUpdatedAt,
 	)
 	return i, err
 }
@@ -73,7 +202,7 @@ const updateUser = `-- name: UpdateUser :one
 update users
 set email=$2, hashed_password=$3, updated_at=NOW()
 where id=$1
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, avatar_key, banner_key, role, suspended_until, banned_at, role_updated_at
 `
 
 type UpdateUserParams struct {
@@ -92,6 +221,76 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.RoleUpdatedAt,
+	)
+	return i, err
+}
+
+const updateUserAvatar = `-- name: UpdateUserAvatar :one
+update users
+set avatar_key=$2, updated_at=NOW()
+where id=$1
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, avatar_key, banner_key, role, suspended_until, banned_at, role_updated_at
+`
+
+type UpdateUserAvatarParams struct {
+	ID        uuid.UUID
+	AvatarKey sql.NullString
+}
+
+func (q *Queries) UpdateUserAvatar(ctx context.Context, arg UpdateUserAvatarParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserAvatar, arg.ID, arg.AvatarKey)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.RoleUpdatedAt,
+	)
+	return i, err
+}
+
+const updateUserBanner = `-- name: UpdateUserBanner :one
+update users
+set banner_key=$2, updated_at=NOW()
+where id=$1
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, avatar_key, banner_key, role, suspended_until, banned_at, role_updated_at
+`
+
+type UpdateUserBannerParams struct {
+	ID        uuid.UUID
+	BannerKey sql.NullString
+}
+
+func (q *Queries) UpdateUserBanner(ctx context.Context, arg UpdateUserBannerParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserBanner, arg.ID, arg.BannerKey)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.RoleUpdatedAt,
 	)
 	return i, err
 }
@@ -100,7 +299,7 @@ const upgradeUser = `-- name: UpgradeUser :one
 update users
 set is_chirpy_red=true
 where id=$1
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, avatar_key, banner_key, role, suspended_until, banned_at, role_updated_at
 `
 
 func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) (User, error) {
@@ -113,6 +312,12 @@ func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.RoleUpdatedAt,
 	)
 	return i, err
 }
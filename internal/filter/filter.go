@@ -0,0 +1,236 @@
+// Package filter finds listed words in user text. Words and text are
+// compared after Unicode normalization, case folding and confusable
+// folding, so "KerFuffle.", "ｋｅｒｆｕｆｆｌｅ", "kérfuffle" and "kеrfuffle"
+// (with a Cyrillic е) all match the term "kerfuffle". Only whole words
+// match: "fornaxes" does not match "fornax".
+package filter
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Action is what happens to text containing a term.
+type Action string
+
+const (
+	// Mask replaces the word with asterisks.
+	Mask Action = "mask"
+	// Reject refuses the text outright.
+	Reject Action = "reject"
+	// Flag accepts the text but sends it to the moderation queue.
+	Flag Action = "flag"
+)
+
+// Valid reports whether a is a known action.
+func (a Action) Valid() bool {
+	return a == Mask || a == Reject || a == Flag
+}
+
+// maskText replaces a masked word whatever its length, so the length of
+// the word isn't given away.
+const maskText = "****"
+
+// Term is a word and what to do when it is found.
+type Term struct {
+	Word   string
+	Action Action
+}
+
+// Match is one occurrence of a term. Start and End are byte offsets into
+// the checked text.
+type Match struct {
+	Term       Term
+	Start, End int
+}
+
+// Result is the outcome of Check.
+type Result struct {
+	// Text is the checked text with masked words replaced and everything
+	// else, spacing and newlines included, left as it was.
+	Text    string
+	Matches []Match
+}
+
+// Has reports whether any match has action a.
+func (r Result) Has(a Action) bool {
+	return slices.ContainsFunc(r.Matches, func(m Match) bool { return m.Term.Action == a })
+}
+
+// Words returns the distinct terms matched with action a.
+func (r Result) Words(a Action) []string {
+	var words []string
+	for _, m := range r.Matches {
+		if m.Term.Action == a && !slices.Contains(words, m.Term.Word) {
+			words = append(words, m.Term.Word)
+		}
+	}
+	return words
+}
+
+// Filter matches text against a fixed set of terms. It is safe for
+// concurrent use; build a new one to change the terms.
+type Filter struct {
+	terms map[string]Term
+}
+
+// New returns a Filter for terms. Words are normalized, so terms that
+// differ only in case or accents are the same term, and a later term
+// replaces an earlier one: list defaults first and overrides after.
+// Words that don't normalize to a single word can never match and are
+// dropped.
+func New(terms []Term) *Filter {
+	f := &Filter{terms: make(map[string]Term, len(terms))}
+	for _, t := range terms {
+		word := Normalize(t.Word)
+		if !IsWord(word) {
+			continue
+		}
+		f.terms[word] = Term{Word: word, Action: t.Action}
+	}
+	return f
+}
+
+// Terms returns the filter's terms sorted by word.
+func (f *Filter) Terms() []Term {
+	terms := make([]Term, 0, len(f.terms))
+	for _, t := range f.terms {
+		terms = append(terms, t)
+	}
+	slices.SortFunc(terms, func(a, b Term) int { return strings.Compare(a.Word, b.Word) })
+	return terms
+}
+
+// Check finds every term in text.
+func (f *Filter) Check(text string) Result {
+	var res Result
+	var out strings.Builder
+	last := 0
+	for start, end := range words(text) {
+		term, ok := f.terms[Normalize(text[start:end])]
+		if !ok {
+			continue
+		}
+		res.Matches = append(res.Matches, Match{Term: term, Start: start, End: end})
+		if term.Action == Mask {
+			out.WriteString(text[last:start])
+			out.WriteString(maskText)
+			last = end
+		}
+	}
+	if last == 0 {
+		res.Text = text
+	} else {
+		out.WriteString(text[last:])
+		res.Text = out.String()
+	}
+	return res
+}
+
+// words yields the byte range of every word in text. A word is a run of
+// letters, marks and digits; format characters such as zero-width spaces
+// inside a word don't split it, so they can't be used to slip a term past
+// the filter.
+func words(text string) func(yield func(int, int) bool) {
+	return func(yield func(int, int) bool) {
+		start := -1
+		for i, r := range text {
+			switch {
+			case isWordRune(r):
+				if start < 0 {
+					start = i
+				}
+			case start >= 0 && unicode.Is(unicode.Cf, r):
+			case start >= 0:
+				if !yield(start, i) {
+					return
+				}
+				start = -1
+			}
+		}
+		if start >= 0 {
+			yield(start, len(text))
+		}
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r)
+}
+
+// IsWord reports whether s is a single, non-empty word.
+func IsWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Normalize returns the form words are compared in: compatibility
+// characters decomposed (fullwidth letters, ligatures), accents and format
+// characters removed, case folded, and look-alike letters replaced by the
+// Latin letter they imitate. Digits are only read as letters in words that
+// also have a letter, so "k3rfuffl3" is disguised but "455" is a number.
+func Normalize(s string) string {
+	t := transform.Chain(
+		norm.NFKD,
+		runes.Remove(runes.In(unicode.Mn)),
+		runes.Remove(runes.In(unicode.Cf)),
+		cases.Fold(),
+		runes.Map(foldConfusable),
+		norm.NFC,
+	)
+	out, _, err := transform.String(t, s)
+	if err != nil {
+		return s
+	}
+	if strings.ContainsFunc(out, unicode.IsLetter) {
+		out = strings.Map(foldDigit, out)
+	}
+	return out
+}
+
+// confusables maps characters commonly used to disguise Latin letters to
+// the letter they imitate. It only needs lowercase entries because it is
+// applied after case folding.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h',
+	'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's',
+	'і': 'i', 'ї': 'i', 'ј': 'j', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'һ': 'h',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v',
+	'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ϲ': 'c',
+	// Latin look-alikes that don't decompose
+	'ı': 'i', 'ł': 'l', 'ø': 'o', 'đ': 'd', 'ħ': 'h', 'ƅ': 'b',
+}
+
+// digitConfusables maps digits standing in for letters to the letter.
+var digitConfusables = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't',
+}
+
+func foldConfusable(r rune) rune {
+	if c, ok := confusables[r]; ok {
+		return c
+	}
+	return r
+}
+
+func foldDigit(r rune) rune {
+	if c, ok := digitConfusables[r]; ok {
+		return c
+	}
+	return r
+}
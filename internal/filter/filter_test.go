@@ -0,0 +1,84 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testTerms = []Term{
+	{Word: "kerfuffle", Action: Mask},
+	{Word: "fornax", Action: Mask},
+	{Word: "sharbert", Action: Reject},
+	{Word: "gosh", Action: Flag},
+}
+
+func TestCheckMasks(t *testing.T) {
+	f := New(testTerms)
+	tests := []struct {
+		name, text, want string
+	}{
+		{"plain", "What a kerfuffle this is", "What a **** this is"},
+		{"punctuation", "kerfuffle! KerFuffle. (fornax)", "****! ****. (****)"},
+		{"keeps spacing", "a  kerfuffle\n\tthen  more", "a  ****\n\tthen  more"},
+		{"accents", "kérfüffle", "****"},
+		{"fullwidth", "ｋｅｒｆｕｆｆｌｅ", "****"},
+		{"cyrillic", "k\u0435rfuffle", "****"},
+		{"digits", "k3rfuffl3", "****"},
+		{"zero-width space", "ker\u200bfuffle", "****"},
+		{"whole words only", "fornaxes kerfuffled", "fornaxes kerfuffled"},
+		{"nothing to mask", "hello world", "hello world"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Check(tt.text).Text; got != tt.want {
+				t.Errorf("Check(%q).Text = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckActions(t *testing.T) {
+	f := New(testTerms)
+	res := f.Check("Gosh, a Sharbert and a kerfuffle")
+
+	if res.Text != "Gosh, a Sharbert and a ****" {
+		t.Errorf("Text = %q, only masked terms should change", res.Text)
+	}
+	if !res.Has(Reject) || !res.Has(Flag) || !res.Has(Mask) {
+		t.Errorf("Matches = %+v, want one of each action", res.Matches)
+	}
+	if got := res.Words(Flag); !reflect.DeepEqual(got, []string{"gosh"}) {
+		t.Errorf("Words(Flag) = %q, want [gosh]", got)
+	}
+	if m := res.Matches[0]; m.Start != 0 || m.End != 4 {
+		t.Errorf("first match at [%d:%d], want [0:4]", m.Start, m.End)
+	}
+}
+
+func TestNewLaterTermsWin(t *testing.T) {
+	f := New([]Term{
+		{Word: "Kerfuffle", Action: Mask},
+		{Word: "kerfuffle", Action: Reject},
+		{Word: "two words", Action: Reject},
+	})
+	want := []Term{{Word: "kerfuffle", Action: Reject}}
+	if got := f.Terms(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Terms() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCheckKeepsNumbers(t *testing.T) {
+	f := New([]Term{{Word: "sos", Action: Mask}})
+	tests := []struct {
+		text, want string
+	}{
+		{"call 505 now", "call 505 now"},
+		{"room 5o5", "room ****"},
+		{"s0s", "****"},
+	}
+	for _, tt := range tests {
+		if got := f.Check(tt.text).Text; got != tt.want {
+			t.Errorf("Check(%q).Text = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Package health runs the named checks behind the readiness probe. Checks
+// run concurrently, each bounded by a timeout, and every result is reported
+// so an operator can see which dependency is failing.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK           = "ok"
+	StatusFailing      = "failing"
+	StatusShuttingDown = "shutting_down"
+)
+
+// CheckFunc reports whether a dependency is usable. It should honour ctx.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker holds the registered readiness checks.
+type Checker struct {
+	timeout      time.Duration
+	mu           sync.RWMutex
+	checks       []check
+	shuttingDown atomic.Bool
+}
+
+// New returns a Checker that gives each check at most timeout to finish.
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a check. Names should be short and unique, e.g. "database".
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// SetShuttingDown marks the process as draining. From then on Check reports
+// not ready without running any checks, so load balancers stop routing new
+// traffic here while in-flight requests finish.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is the outcome of a full readiness check.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Ready reports whether every check passed.
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// Check runs every registered check and collects the results.
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.shuttingDown.Load() {
+		return Report{Status: StatusShuttingDown}
+	}
+
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ch := range checks {
+		wg.Go(func() {
+			res := c.run(ctx, ch.fn)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[ch.name] = res
+			if res.Status != StatusOK {
+				report.Status = StatusFailing
+			}
+		})
+	}
+	wg.Wait()
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, fn CheckFunc) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	// a check that ignores ctx must not hold up the probe
+	go func() { errc <- fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := Result{Status: StatusOK, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		res.Status = StatusFailing
+		res.Error = err.Error()
+	}
+	return res
+}
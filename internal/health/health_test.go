@@ -0,0 +1,63 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	c := New(50 * time.Millisecond)
+	c.Add("ok", func(ctx context.Context) error { return nil })
+	c.Add("broken", func(ctx context.Context) error { return errors.New("connection refused") })
+	c.Add("stuck", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	report := c.Check(context.Background())
+	if report.Ready() {
+		t.Fatal("Ready() = true with failing checks")
+	}
+
+	want := map[string]string{
+		"ok":     StatusOK,
+		"broken": StatusFailing,
+		"stuck":  StatusFailing,
+	}
+	for name, status := range want {
+		if got := report.Checks[name].Status; got != status {
+			t.Errorf("%s status = %q, want %q", name, got, status)
+		}
+	}
+	if got := report.Checks["broken"].Error; got != "connection refused" {
+		t.Errorf("broken error = %q", got)
+	}
+	if got := report.Checks["stuck"].Error; got != context.DeadlineExceeded.Error() {
+		t.Errorf("stuck error = %q, want deadline exceeded", got)
+	}
+}
+
+func TestCheckShuttingDown(t *testing.T) {
+	ran := false
+	c := New(time.Second)
+	c.Add("db", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+
+	if !c.Check(context.Background()).Ready() {
+		t.Fatal("Ready() = false before shutdown")
+	}
+	ran = false
+
+	c.SetShuttingDown()
+	report := c.Check(context.Background())
+	if report.Ready() || report.Status != StatusShuttingDown {
+		t.Errorf("Status = %q, want %q", report.Status, StatusShuttingDown)
+	}
+	if ran {
+		t.Error("checks ran during shutdown")
+	}
+}
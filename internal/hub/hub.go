@@ -0,0 +1,229 @@
+// Package hub fans events out to the clients streaming them. Every event
+// gets the next sequence number and is kept in a bounded replay buffer,
+// so a client that reconnects can resume from the last event it saw.
+//
+// Publishing never blocks. Each subscription has a bounded queue, and a
+// subscriber that lets its queue fill up is dropped rather than allowed
+// to hold up everyone else. It can reconnect and resume from the replay
+// buffer.
+//
+// A Hub only reaches clients of the process it lives in.
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrSlowConsumer is why a subscription was dropped for not keeping up.
+	ErrSlowConsumer = errors.New("hub: subscriber too slow")
+	// ErrClosed is why a subscription ended when the hub was closed.
+	ErrClosed = errors.New("hub: closed")
+	// ErrFull is returned by Subscribe when MaxSubscribers are connected.
+	ErrFull = errors.New("hub: too many subscribers")
+)
+
+// Event is something that happened. UserID is the user it is about, such
+// as a chirp's author, and Tags any hashtags it carries, so subscribers
+// can filter on them. Ephemeral events, such as typing indicators, only
+// go to current subscribers and are never replayed.
+type Event struct {
+	ID        uint64
+	Type      string
+	UserID    uuid.UUID
+	Tags      []string
+	Ephemeral bool
+	Time      time.Time
+	Data      json.RawMessage
+}
+
+// Options bound a Hub's memory use.
+type Options struct {
+	// Replay is how many recent events are kept for resuming.
+	Replay int
+	// Queue is how many events may wait for one subscriber.
+	Queue int
+	// MaxSubscribers caps concurrent subscriptions; zero means no cap.
+	MaxSubscribers int
+}
+
+// Hub is safe for concurrent use.
+type Hub struct {
+	opts Options
+
+	mu      sync.Mutex
+	lastID  uint64
+	replay  []Event // ring buffer, oldest at replay[start]
+	start   int
+	subs    map[*Subscription]struct{}
+	closed  bool
+	dropped uint64
+}
+
+func New(opts Options) *Hub {
+	return &Hub{
+		opts:   opts,
+		replay: make([]Event, 0, opts.Replay),
+		subs:   map[*Subscription]struct{}{},
+	}
+}
+
+// Subscription receives the events matching its filter on C until C is
+// closed, after which Err says why.
+type Subscription struct {
+	C <-chan Event
+
+	hub    *Hub
+	c      chan Event
+	filter func(Event) bool
+	err    error
+}
+
+// Err returns why C was closed: ErrSlowConsumer, ErrClosed, or nil after
+// Unsubscribe.
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+// Unsubscribe stops delivery and closes C. It is safe to call more than
+// once.
+func (s *Subscription) Unsubscribe() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s, nil)
+}
+
+// Publish assigns e the next ID and the current time, delivers it to every
+// matching subscriber and returns it.
+func (h *Hub) Publish(e Event) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	e.ID = h.lastID
+	e.Time = time.Now()
+	if h.closed {
+		return e
+	}
+
+	if h.opts.Replay > 0 && !e.Ephemeral {
+		if len(h.replay) < h.opts.Replay {
+			h.replay = append(h.replay, e)
+		} else {
+			h.replay[h.start] = e
+			h.start = (h.start + 1) % len(h.replay)
+		}
+	}
+
+	for s := range h.subs {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			h.dropped++
+			h.remove(s, ErrSlowConsumer)
+		}
+	}
+	return e
+}
+
+// Subscribe starts a subscription to the events filter accepts; a nil
+// filter accepts everything. If lastID is not zero, the buffered events
+// after it are queued first. complete is false when some of them have
+// already left the buffer (or won't fit in the queue), so the subscriber
+// has missed events and should catch up some other way.
+func (h *Hub) Subscribe(lastID uint64, filter func(Event) bool) (sub *Subscription, complete bool, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, false, ErrClosed
+	}
+	if h.opts.MaxSubscribers > 0 && len(h.subs) >= h.opts.MaxSubscribers {
+		return nil, false, ErrFull
+	}
+
+	c := make(chan Event, h.opts.Queue)
+	sub = &Subscription{C: c, hub: h, c: c, filter: filter}
+	h.subs[sub] = struct{}{}
+
+	complete = true
+	if lastID == 0 || lastID >= h.lastID {
+		// a fresh subscriber, or one that has seen everything; an ID from
+		// the future means the server restarted and the IDs with it
+		return sub, lastID <= h.lastID, nil
+	}
+
+	var missed []Event
+	for i := range h.replay {
+		e := h.replay[(h.start+i)%len(h.replay)]
+		if e.ID <= lastID || (filter != nil && !filter(e)) {
+			continue
+		}
+		missed = append(missed, e)
+	}
+	if oldest := h.oldestID(); oldest == 0 || oldest > lastID+1 {
+		complete = false
+	}
+	if over := len(missed) - cap(c); over > 0 {
+		missed = missed[over:]
+		complete = false
+	}
+	for _, e := range missed {
+		c <- e
+	}
+	return sub, complete, nil
+}
+
+// oldestID is the ID of the oldest buffered event, or zero.
+func (h *Hub) oldestID() uint64 {
+	if len(h.replay) == 0 {
+		return 0
+	}
+	return h.replay[h.start].ID
+}
+
+// Close ends every subscription with ErrClosed and refuses new ones.
+// Publish still assigns IDs but delivers nothing.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for s := range h.subs {
+		h.remove(s, ErrClosed)
+	}
+}
+
+// Subscribers returns how many subscriptions are open.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Dropped returns how many subscriptions were ended with ErrSlowConsumer.
+func (h *Hub) Dropped() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dropped
+}
+
+// remove must be called with h.mu held.
+func (h *Hub) remove(s *Subscription, err error) {
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+	delete(h.subs, s)
+	s.err = err
+	close(s.c)
+}
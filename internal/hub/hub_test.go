@@ -0,0 +1,145 @@
+package hub
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func ids(t *testing.T, s *Subscription, n int) []uint64 {
+	t.Helper()
+	var got []uint64
+	for range n {
+		select {
+		case e, ok := <-s.C:
+			if !ok {
+				t.Fatalf("subscription closed after %v: %v", got, s.Err())
+			}
+			got = append(got, e.ID)
+		default:
+			t.Fatalf("got %v, want %d events", got, n)
+		}
+	}
+	return got
+}
+
+func TestPublishDeliversMatchingEvents(t *testing.T) {
+	h := New(Options{Replay: 10, Queue: 10})
+	alice, bob := uuid.New(), uuid.New()
+
+	all, _, err := h.Subscribe(0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onlyAlice, _, err := h.Subscribe(0, func(e Event) bool { return e.UserID == alice })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.Publish(Event{Type: "chirp.created", UserID: alice})
+	h.Publish(Event{Type: "chirp.created", UserID: bob})
+
+	if got := ids(t, all, 2); got[0] != 1 || got[1] != 2 {
+		t.Errorf("all got %v, want [1 2]", got)
+	}
+	if got := ids(t, onlyAlice, 1); got[0] != 1 {
+		t.Errorf("onlyAlice got %v, want [1]", got)
+	}
+	if len(onlyAlice.C) != 0 {
+		t.Error("onlyAlice received bob's event")
+	}
+}
+
+func TestSubscribeResumesFromReplayBuffer(t *testing.T) {
+	h := New(Options{Replay: 3, Queue: 10})
+	for range 5 {
+		h.Publish(Event{Type: "chirp.created"})
+	}
+
+	// events 3 to 5 are buffered
+	sub, complete, err := h.Subscribe(2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !complete {
+		t.Error("resume from 2 incomplete, want complete")
+	}
+	if got := ids(t, sub, 3); got[0] != 3 || got[2] != 5 {
+		t.Errorf("resume from 2 got %v, want [3 4 5]", got)
+	}
+
+	sub, complete, _ = h.Subscribe(1, nil)
+	if complete {
+		t.Error("resume from 1 complete, but event 2 has left the buffer")
+	}
+	if got := ids(t, sub, 3); got[0] != 3 {
+		t.Errorf("resume from 1 got %v, want [3 4 5]", got)
+	}
+
+	if _, complete, _ := h.Subscribe(5, nil); !complete {
+		t.Error("resume from the latest event incomplete")
+	}
+	if _, complete, _ := h.Subscribe(99, nil); complete {
+		t.Error("resume from an unknown future ID complete")
+	}
+}
+
+func TestEphemeralEventsAreNotReplayed(t *testing.T) {
+	h := New(Options{Replay: 10, Queue: 10})
+	live, _, _ := h.Subscribe(0, nil)
+	h.Publish(Event{Type: "chirp.created"})
+	h.Publish(Event{Type: "typing", Ephemeral: true})
+	h.Publish(Event{Type: "chirp.created"})
+
+	ids(t, live, 3)
+	resumed, complete, _ := h.Subscribe(1, nil)
+	if got := ids(t, resumed, 1); got[0] != 3 || len(resumed.C) != 0 {
+		t.Errorf("resume from 1 got %v, want only [3]", got)
+	}
+	if !complete {
+		t.Error("resume incomplete, but only an ephemeral event was skipped")
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	h := New(Options{Queue: 2})
+	slow, _, _ := h.Subscribe(0, nil)
+	fast, _, _ := h.Subscribe(0, nil)
+
+	for range 3 {
+		h.Publish(Event{Type: "chirp.created"})
+		<-fast.C
+	}
+
+	ids(t, slow, 2)
+	if _, ok := <-slow.C; ok {
+		t.Fatal("slow subscriber still open")
+	}
+	if !errors.Is(slow.Err(), ErrSlowConsumer) {
+		t.Errorf("Err() = %v, want ErrSlowConsumer", slow.Err())
+	}
+	if h.Subscribers() != 1 || h.Dropped() != 1 {
+		t.Errorf("Subscribers() = %d, Dropped() = %d, want 1 and 1", h.Subscribers(), h.Dropped())
+	}
+}
+
+func TestMaxSubscribersAndClose(t *testing.T) {
+	h := New(Options{Queue: 1, MaxSubscribers: 1})
+	sub, _, err := h.Subscribe(0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := h.Subscribe(0, nil); !errors.Is(err, ErrFull) {
+		t.Errorf("second Subscribe() error = %v, want ErrFull", err)
+	}
+
+	h.Close()
+	if _, ok := <-sub.C; ok || !errors.Is(sub.Err(), ErrClosed) {
+		t.Errorf("after Close: open = %v, Err() = %v; want closed with ErrClosed", ok, sub.Err())
+	}
+	if _, _, err := h.Subscribe(0, nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Subscribe() after Close error = %v, want ErrClosed", err)
+	}
+	sub.Unsubscribe()
+}
@@ -0,0 +1,550 @@
+// Package jobs runs background work queued in a Postgres table.
+//
+// A job is enqueued with a single insert, so it can be added in the same
+// transaction as the change that calls for it and only runs if that
+// change is committed. Runners on any number of replicas claim due jobs
+// with SELECT ... FOR UPDATE SKIP LOCKED, so each job is run by one of
+// them at a time.
+//
+// A job that fails is retried with exponential backoff until it has used
+// its attempts, then kept as failed for inspection; one that succeeds is
+// deleted. Jobs of a periodic kind are instead queued again once they
+// succeed or run out of attempts. A claim leases the job, and a runner
+// that dies mid-job leaves it to be claimed again once the lease runs
+// out, so handlers must be safe to run more than once.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a job is tried unless it is
+	// enqueued with MaxAttempts.
+	DefaultMaxAttempts = 10
+
+	firstBackoff = 10 * time.Second
+	maxBackoff   = 6 * time.Hour
+)
+
+// Execer is satisfied by *sql.DB and *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Kind names a type of job whose arguments are a T, encoded as JSON.
+type Kind[T any] struct {
+	Name string
+}
+
+// Job is a claimed job. Attempt counts from 1.
+type Job[T any] struct {
+	ID          uuid.UUID
+	Attempt     int
+	MaxAttempts int
+	Args        T
+}
+
+// Option changes how a job is enqueued.
+type Option func(*enqueueOptions)
+
+type enqueueOptions struct {
+	delay       time.Duration
+	maxAttempts int
+	uniqueKey   sql.NullString
+}
+
+// Delay holds the job back for d.
+func Delay(d time.Duration) Option {
+	return func(o *enqueueOptions) { o.delay = d }
+}
+
+// RunAt holds the job back until t.
+func RunAt(t time.Time) Option {
+	return Delay(time.Until(t))
+}
+
+// MaxAttempts sets how many times the job is tried before it fails.
+func MaxAttempts(n int) Option {
+	return func(o *enqueueOptions) { o.maxAttempts = n }
+}
+
+// Unique drops the job if one with the same key is already pending or
+// running, so periodic work queued by several replicas runs once.
+func Unique(key string) Option {
+	return func(o *enqueueOptions) { o.uniqueKey = sql.NullString{String: key, Valid: true} }
+}
+
+// Enqueue adds a job of kind k with db, which may be a transaction.
+func (k Kind[T]) Enqueue(ctx context.Context, db Execer, args T, opts ...Option) error {
+	o := enqueueOptions{maxAttempts: DefaultMaxAttempts}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("jobs: encode %s: %w", k.Name, err)
+	}
+	// delays are relative to the database's clock, which decides when
+	// jobs are due
+	if _, err := db.ExecContext(ctx, `insert into jobs (id, created_at, updated_at, kind, payload, status, max_attempts, run_at, unique_key)
+		values ($1, NOW(), NOW(), $2, $3, 'pending', $4, NOW() + make_interval(secs => $5), $6)
+		on conflict (unique_key) where status in ('pending', 'running') do nothing`,
+		uuid.New(), k.Name, payload, o.maxAttempts, max(o.delay, 0).Seconds(), o.uniqueKey,
+	); err != nil {
+		return fmt.Errorf("jobs: enqueue %s: %w", k.Name, err)
+	}
+	return nil
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps a handler's error to fail the job without retrying it,
+// for work that can never succeed.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+type retryError struct {
+	err   error
+	after time.Duration
+}
+
+func (e retryError) Error() string { return e.err.Error() }
+func (e retryError) Unwrap() error { return e.err }
+
+// RetryAfter wraps a handler's error to retry the job after d instead of
+// the usual backoff. It still uses up an attempt.
+func RetryAfter(err error, d time.Duration) error {
+	return retryError{err, d}
+}
+
+// Backoff is the default wait before retrying a job that has failed
+// attempts times: ten seconds doubling up to six hours.
+func Backoff(attempts int) time.Duration {
+	return ExponentialBackoff(attempts, firstBackoff, maxBackoff)
+}
+
+// ExponentialBackoff is the wait after attempts failures: first, doubling
+// with each failure up to limit, plus up to a tenth again so work failed
+// by the same outage doesn't retry together.
+func ExponentialBackoff(attempts int, first, limit time.Duration) time.Duration {
+	d := limit
+	if attempts < 1 {
+		attempts = 1
+	}
+	if shift := attempts - 1; shift < 16 {
+		d = min(first<<shift, limit)
+	}
+	return d + rand.N(d/10+1)
+}
+
+// Outcomes reported in Result.
+const (
+	Succeeded = "succeeded"
+	Retried   = "retried"
+	Failed    = "failed"
+	// Released jobs were interrupted by shutdown and go back in the queue
+	// without using up an attempt.
+	Released = "released"
+)
+
+// Result describes one run of a job.
+type Result struct {
+	Kind     string
+	ID       uuid.UUID
+	Attempt  int
+	Outcome  string
+	Err      error
+	Duration time.Duration
+}
+
+// Options configure a Runner.
+type Options struct {
+	// Concurrency is how many jobs the runner runs at once.
+	Concurrency int
+	// PollInterval is how often an idle runner looks for due jobs.
+	PollInterval time.Duration
+	// Timeout bounds a run of any kind that doesn't set its own.
+	Timeout time.Duration
+	// DrainTimeout is how long Run waits for running jobs once it is
+	// stopped before interrupting them.
+	DrainTimeout time.Duration
+	// Backoff replaces the package's Backoff.
+	Backoff func(attempts int) time.Duration
+	// Done, if set, is called after every run, for metrics.
+	Done func(Result)
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// KindOptions configure how a Runner handles one kind.
+type KindOptions struct {
+	// Concurrency caps how many jobs of the kind the runner runs at once;
+	// zero leaves only the runner's limit.
+	Concurrency int
+	// Timeout bounds each run; zero means the runner's Timeout.
+	Timeout time.Duration
+	// Every makes the kind periodic: rather than being deleted when it
+	// succeeds or failed when it runs out of attempts, a job is queued
+	// again to run Every later. Enqueue it with Unique so replicas share
+	// one job.
+	Every time.Duration
+}
+
+type handler struct {
+	opts    KindOptions
+	run     func(ctx context.Context, c claimed) error
+	running int
+}
+
+// claimed is a job row as a runner sees it.
+type claimed struct {
+	kind        string
+	id          uuid.UUID
+	payload     []byte
+	attempt     int
+	maxAttempts int
+}
+
+// Runner claims and runs due jobs of the kinds registered with Handle.
+type Runner struct {
+	db   *sql.DB
+	opts Options
+	log  *slog.Logger
+	// wake is signalled when a job finishes and frees a slot.
+	wake chan struct{}
+
+	mu       sync.Mutex
+	handlers map[string]*handler
+	running  int
+}
+
+// NewRunner returns a Runner for the jobs table in db. Register handlers
+// before starting it. Unset options default to one job at a time, polling
+// every five seconds and a minute's timeout.
+func NewRunner(db *sql.DB, opts Options) *Runner {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 5 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Minute
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = Backoff
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &Runner{
+		db:       db,
+		opts:     opts,
+		log:      opts.Logger,
+		wake:     make(chan struct{}, 1),
+		handlers: map[string]*handler{},
+	}
+}
+
+// Handle registers fn to run jobs of kind k. A job whose arguments can't
+// be decoded fails without being retried.
+func Handle[T any](r *Runner, k Kind[T], opts KindOptions, fn func(ctx context.Context, job *Job[T]) error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = r.opts.Timeout
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[k.Name] = &handler{
+		opts: opts,
+		run: func(ctx context.Context, c claimed) error {
+			job := &Job[T]{ID: c.id, Attempt: c.attempt, MaxAttempts: c.maxAttempts}
+			if err := json.Unmarshal(c.payload, &job.Args); err != nil {
+				return Permanent(fmt.Errorf("decode arguments: %w", err))
+			}
+			return fn(ctx, job)
+		},
+	}
+}
+
+// Run claims and runs jobs until ctx is cancelled. It then stops claiming
+// and waits up to DrainTimeout for running jobs before interrupting them,
+// and returns once every job has finished or been released.
+func (r *Runner) Run(ctx context.Context) {
+	// jobs outlive ctx while draining
+	jobCtx, interrupt := context.WithCancel(context.WithoutCancel(ctx))
+	defer interrupt()
+	var wg sync.WaitGroup
+
+	ticker := time.NewTicker(r.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		_, backlog, err := r.start(ctx, jobCtx, &wg)
+		if err != nil && ctx.Err() == nil {
+			r.log.ErrorContext(ctx, "claiming jobs failed", "err", err)
+		}
+		// only a runner with a backlog has any use for a freed slot
+		wake := r.wake
+		if !backlog {
+			wake = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			r.drain(&wg, interrupt)
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+func (r *Runner) drain(wg *sync.WaitGroup, interrupt context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-time.After(r.opts.DrainTimeout):
+	}
+	r.log.Warn("Interrupting jobs still running after the drain timeout", "timeout", r.opts.DrainTimeout)
+	interrupt()
+	<-done
+}
+
+// Work claims the jobs due now that the runner has room for, runs them
+// and returns how many it ran. It is for tests and one-off commands; Run
+// is what a server wants.
+func (r *Runner) Work(ctx context.Context) (int, error) {
+	var wg sync.WaitGroup
+	n, _, err := r.start(ctx, ctx, &wg)
+	wg.Wait()
+	return n, err
+}
+
+// start claims jobs into the runner's free slots and runs each in its own
+// goroutine with jobCtx. backlog reports whether any kind filled its
+// slots, so more of it may be due.
+func (r *Runner) start(ctx, jobCtx context.Context, wg *sync.WaitGroup) (n int, backlog bool, err error) {
+	r.mu.Lock()
+	kinds := make([]string, 0, len(r.handlers))
+	for kind := range r.handlers {
+		kinds = append(kinds, kind)
+	}
+	r.mu.Unlock()
+	slices.Sort(kinds)
+
+	for _, kind := range kinds {
+		free := r.reserve(kind)
+		if free == 0 {
+			continue
+		}
+		jobs, err := r.claim(ctx, kind, free)
+		// give back the slots the claim didn't fill
+		r.release(kind, free-len(jobs))
+		if err != nil {
+			return n, backlog, err
+		}
+		backlog = backlog || len(jobs) == free
+		for _, c := range jobs {
+			wg.Go(func() { r.run(jobCtx, c) })
+		}
+		n += len(jobs)
+	}
+	return n, backlog, nil
+}
+
+// reserve takes as many of the runner's free slots as kind may use.
+func (r *Runner) reserve(kind string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := r.handlers[kind]
+	free := r.opts.Concurrency - r.running
+	if h.opts.Concurrency > 0 {
+		free = min(free, h.opts.Concurrency-h.running)
+	}
+	free = max(free, 0)
+	r.running += free
+	h.running += free
+	return free
+}
+
+func (r *Runner) release(kind string, n int) {
+	if n == 0 {
+		return
+	}
+	r.mu.Lock()
+	r.running -= n
+	r.handlers[kind].running -= n
+	r.mu.Unlock()
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// claim leases up to limit due jobs of kind for twice its timeout. Jobs
+// whose lease ran out while they were running are due again.
+func (r *Runner) claim(ctx context.Context, kind string, limit int) ([]claimed, error) {
+	r.mu.Lock()
+	lease := 2 * r.handlers[kind].opts.Timeout
+	r.mu.Unlock()
+
+	rows, err := r.db.QueryContext(ctx, `update jobs
+		set status='running', attempts=attempts + 1, locked_until=NOW() + make_interval(secs => $3), updated_at=NOW()
+		where id in (
+			select id from jobs
+			where kind=$1 and ((status='pending' and run_at <= NOW()) or (status='running' and locked_until < NOW()))
+			order by run_at
+			limit $2
+			for update skip locked
+		)
+		returning id, payload, attempts, max_attempts`,
+		kind, limit, lease.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: claim %s: %w", kind, err)
+	}
+	defer rows.Close()
+	var jobs []claimed
+	for rows.Next() {
+		c := claimed{kind: kind}
+		if err := rows.Scan(&c.id, &c.payload, &c.attempt, &c.maxAttempts); err != nil {
+			return nil, fmt.Errorf("jobs: claim %s: %w", kind, err)
+		}
+		jobs = append(jobs, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("jobs: claim %s: %w", kind, err)
+	}
+	return jobs, nil
+}
+
+// run runs c and records the outcome. ctx is only cancelled to interrupt
+// the job.
+func (r *Runner) run(ctx context.Context, c claimed) {
+	defer r.release(c.kind, 1)
+
+	r.mu.Lock()
+	h := r.handlers[c.kind]
+	r.mu.Unlock()
+
+	start := time.Now()
+	var err error
+	if c.attempt > c.maxAttempts {
+		// its runner died during the last attempt
+		err = Permanent(errors.New("lease expired on the last attempt"))
+	} else {
+		runCtx, cancel := context.WithTimeout(ctx, h.opts.Timeout)
+		err = safeRun(runCtx, h, c)
+		cancel()
+	}
+	res := Result{Kind: c.kind, ID: c.id, Attempt: c.attempt, Err: err, Duration: time.Since(start)}
+
+	var perm permanentError
+	var retry retryError
+	switch {
+	case err == nil:
+		res.Outcome = Succeeded
+	case ctx.Err() != nil:
+		res.Outcome = Released
+	case errors.As(err, &perm) || c.attempt >= c.maxAttempts:
+		res.Outcome = Failed
+	default:
+		res.Outcome = Retried
+		retry.after = r.opts.Backoff(c.attempt)
+		errors.As(err, &retry)
+		res.Err = fmt.Errorf("%w (retrying in %s)", err, retry.after.Round(time.Second))
+	}
+
+	// the outcome is recorded even while the runner is being stopped
+	recCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := r.record(recCtx, c, h.opts.Every, res.Outcome, err, retry.after); errors.Is(err, errLostClaim) {
+		r.log.WarnContext(recCtx, "Job outcome dropped; another runner claimed it", "kind", c.kind, "job_id", c.id, "attempt", c.attempt, "outcome", res.Outcome)
+	} else if err != nil {
+		r.log.ErrorContext(recCtx, "couldn't record job outcome", "kind", c.kind, "job_id", c.id, "err", err)
+	}
+	if res.Outcome == Failed {
+		r.log.WarnContext(recCtx, "Job failed", "kind", c.kind, "job_id", c.id, "attempt", c.attempt, "err", err)
+	}
+	if r.opts.Done != nil {
+		r.opts.Done(res)
+	}
+}
+
+// safeRun turns a handler's panic into an error so it fails one job
+// rather than the process.
+func safeRun(ctx context.Context, h *handler, c claimed) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return h.run(ctx, c)
+}
+
+// errLostClaim is returned by record when the job is no longer the claim
+// it was run under: its lease ran out and another runner took it over.
+var errLostClaim = errors.New("jobs: claim lost to another runner")
+
+// record writes the outcome of the claimed attempt c. Every write is fenced
+// on the job still being that attempt, so a runner whose lease ran out
+// can't overwrite the runner that took the job over.
+func (r *Runner) record(ctx context.Context, c claimed, every time.Duration, outcome string, jobErr error, retryAfter time.Duration) error {
+	var res sql.Result
+	var err error
+	switch {
+	case every > 0 && (outcome == Succeeded || outcome == Failed):
+		var lastError string
+		if jobErr != nil {
+			lastError = jobErr.Error()
+		}
+		res, err = r.db.ExecContext(ctx, `update jobs
+			set status='pending', attempts=0, run_at=NOW() + make_interval(secs => $3), locked_until=null, last_error=$4, updated_at=NOW()
+			where id=$1 and status='running' and attempts=$2`, c.id, c.attempt, every.Seconds(), lastError)
+	case outcome == Succeeded:
+		res, err = r.db.ExecContext(ctx, "delete from jobs where id=$1 and status='running' and attempts=$2", c.id, c.attempt)
+	case outcome == Released:
+		res, err = r.db.ExecContext(ctx, `update jobs
+			set status='pending', attempts=attempts - 1, run_at=NOW(), locked_until=null, updated_at=NOW()
+			where id=$1 and status='running' and attempts=$2`, c.id, c.attempt)
+	case outcome == Retried:
+		res, err = r.db.ExecContext(ctx, `update jobs
+			set status='pending', run_at=NOW() + make_interval(secs => $3), locked_until=null, last_error=$4, updated_at=NOW()
+			where id=$1 and status='running' and attempts=$2`, c.id, c.attempt, retryAfter.Seconds(), jobErr.Error())
+	case outcome == Failed:
+		res, err = r.db.ExecContext(ctx, `update jobs
+			set status='failed', locked_until=null, last_error=$3, updated_at=NOW()
+			where id=$1 and status='running' and attempts=$2`, c.id, c.attempt, jobErr.Error())
+	}
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errLostClaim
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jwoodsiii/chirpy/internal/migrate"
+	"github.com/jwoodsiii/chirpy/sql/schema"
+	_ "github.com/lib/pq"
+)
+
+func TestBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, firstBackoff},
+		{1, firstBackoff},
+		{3, 4 * firstBackoff},
+		{13, maxBackoff},
+		{100, maxBackoff},
+	} {
+		if got := Backoff(tt.attempts); got < tt.want || got > tt.want+tt.want/10 {
+			t.Errorf("Backoff(%d) = %v, want %v plus up to 10%%", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{5, 16 * time.Minute},
+		{11, 12 * time.Hour},
+		{100, 12 * time.Hour},
+	} {
+		if got := ExponentialBackoff(tt.attempts, time.Minute, 12*time.Hour); got < tt.want || got > tt.want+tt.want/10 {
+			t.Errorf("ExponentialBackoff(%d, 1m, 12h) = %v, want %v plus up to 10%%", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	r := NewRunner(nil, Options{Concurrency: 3})
+	noop := func(context.Context, *Job[struct{}]) error { return nil }
+	Handle(r, Kind[struct{}]{Name: "limited"}, KindOptions{Concurrency: 2}, noop)
+	Handle(r, Kind[struct{}]{Name: "open"}, KindOptions{}, noop)
+
+	steps := []struct {
+		kind     string
+		release  int
+		want     int
+		wantBusy int
+	}{
+		{"limited", 0, 2, 2},
+		{"limited", 0, 0, 2},
+		{"open", 0, 1, 3},
+		{"open", 0, 0, 3},
+		{"limited", 1, 1, 3},
+		{"open", 1, 1, 3},
+		{"limited", 0, 0, 3},
+	}
+	for i, s := range steps {
+		if s.release > 0 {
+			r.release(s.kind, s.release)
+		}
+		if got := r.reserve(s.kind); got != s.want || r.running != s.wantBusy {
+			t.Errorf("step %d: reserve(%q) = %d with %d running, want %d with %d", i, s.kind, got, r.running, s.want, s.wantBusy)
+		}
+	}
+}
+
+func TestErrorWrappers(t *testing.T) {
+	base := errors.New("boom")
+	for _, err := range []error{Permanent(base), RetryAfter(base, time.Minute)} {
+		if !errors.Is(err, base) || err.Error() != "boom" {
+			t.Errorf("%#v doesn't wrap %v", err, base)
+		}
+	}
+}
+
+// testDB returns the Postgres database in CHIRPY_TEST_DB_URL, migrated and
+// with an empty jobs table.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dsn == "" || strings.HasPrefix(dsn, "sqlite:") {
+		t.Skip("CHIRPY_TEST_DB_URL not set to a Postgres database")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migrate.New(db, migrate.Postgres, schema.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+	if _, err := db.Exec("delete from jobs"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type echoArgs struct {
+	N int `json:"n"`
+}
+
+var echo = Kind[echoArgs]{Name: "test.echo"}
+
+func TestRunner(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	r := NewRunner(db, Options{Concurrency: 4})
+
+	var got []int
+	var failures atomic.Int32
+	Handle(r, echo, KindOptions{Concurrency: 1}, func(ctx context.Context, job *Job[echoArgs]) error {
+		switch job.Args.N {
+		case -1:
+			failures.Add(1)
+			return RetryAfter(errors.New("try again"), 0)
+		case -2:
+			return Permanent(errors.New("never"))
+		}
+		got = append(got, job.Args.N)
+		return nil
+	})
+
+	work := func(want int) {
+		t.Helper()
+		if n, err := r.Work(ctx); err != nil || n != want {
+			t.Fatalf("Work() = %d, %v; want %d", n, err, want)
+		}
+	}
+
+	// a job enqueued in a rolled back transaction never runs
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := echo.Enqueue(ctx, tx, echoArgs{N: 1}); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+
+	if err := echo.Enqueue(ctx, db, echoArgs{N: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := echo.Enqueue(ctx, db, echoArgs{N: 3}, Delay(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	work(1)
+	if len(got) != 1 || got[0] != 2 {
+		t.Errorf("ran %v, want [2]", got)
+	}
+	work(0)
+
+	// a unique job is only queued once until it has run
+	for range 2 {
+		if err := echo.Enqueue(ctx, db, echoArgs{N: 4}, Unique("four")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	work(1)
+	work(0)
+
+	// failures retry until the attempts run out
+	if err := echo.Enqueue(ctx, db, echoArgs{N: -1}, MaxAttempts(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := echo.Enqueue(ctx, db, echoArgs{N: -2}); err != nil {
+		t.Fatal(err)
+	}
+	work(1)
+	work(1)
+	work(1)
+	work(0)
+	if failures.Load() != 2 {
+		t.Errorf("failing job ran %d times, want 2", failures.Load())
+	}
+	var failed int
+	if err := db.QueryRow("select count(*) from jobs where status='failed'").Scan(&failed); err != nil || failed != 2 {
+		t.Errorf("failed jobs = %d, %v; want 2", failed, err)
+	}
+}
+
+func TestPeriodic(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	r := NewRunner(db, Options{Concurrency: 2})
+
+	var runs atomic.Int32
+	Handle(r, echo, KindOptions{Every: time.Hour}, func(ctx context.Context, job *Job[echoArgs]) error {
+		runs.Add(1)
+		if job.Args.N < 0 {
+			return Permanent(errors.New("never"))
+		}
+		return nil
+	})
+
+	// replicas starting up queue one job between them
+	for range 2 {
+		if err := echo.Enqueue(ctx, db, echoArgs{N: 1}, Unique("periodic")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := echo.Enqueue(ctx, db, echoArgs{N: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Work(ctx); err != nil || n != 2 || runs.Load() != 2 {
+		t.Fatalf("Work() = %d, %v after %d runs; want 2 jobs run", n, err, runs.Load())
+	}
+
+	// succeeded or failed, both are back in the queue an hour out
+	var pending int
+	if err := db.QueryRow("select count(*) from jobs where status='pending' and attempts=0 and run_at > NOW() + interval '59 minutes'").Scan(&pending); err != nil || pending != 2 {
+		t.Errorf("requeued jobs = %d, %v; want 2", pending, err)
+	}
+	if n, err := r.Work(ctx); err != nil || n != 0 {
+		t.Errorf("Work() before they are due = %d, %v; want 0", n, err)
+	}
+}
+
+func TestRecordAfterLostClaim(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	r := NewRunner(db, Options{})
+	Handle(r, echo, KindOptions{}, func(context.Context, *Job[echoArgs]) error { return nil })
+
+	if err := echo.Enqueue(ctx, db, echoArgs{N: 1}); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := r.claim(ctx, echo.Name, 1)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("claim() = %v, %v; want one job", jobs, err)
+	}
+	// the lease runs out and another runner claims the job
+	if _, err := db.Exec("update jobs set attempts=attempts + 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.record(ctx, jobs[0], 0, Succeeded, nil, 0); !errors.Is(err, errLostClaim) {
+		t.Errorf("record() = %v, want errLostClaim", err)
+	}
+	var left int
+	if err := db.QueryRow("select count(*) from jobs where status='running'").Scan(&left); err != nil || left != 1 {
+		t.Errorf("running jobs = %d, %v; want the other runner's claim kept", left, err)
+	}
+}
+
+func TestRunnerDrain(t *testing.T) {
+	db := testDB(t)
+	ctx, stop := context.WithCancel(context.Background())
+	r := NewRunner(db, Options{PollInterval: 10 * time.Millisecond, DrainTimeout: 50 * time.Millisecond})
+
+	started := make(chan struct{})
+	Handle(r, echo, KindOptions{}, func(ctx context.Context, job *Job[echoArgs]) error {
+		if job.Args.N == 0 {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	if err := echo.Enqueue(context.Background(), db, echoArgs{N: 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	<-started
+	stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return after the drain timeout")
+	}
+
+	// the interrupted job is back in the queue with its attempt unused
+	var status string
+	var attempts int
+	if err := db.QueryRow("select status, attempts from jobs").Scan(&status, &attempts); err != nil {
+		t.Fatal(err)
+	}
+	if status != "pending" || attempts != 0 {
+		t.Errorf("interrupted job is %s after %d attempts, want pending after 0", status, attempts)
+	}
+}
@@ -0,0 +1,131 @@
+// Package logging configures structured log/slog output for chirpy. It adds
+// the request ID and authenticated user from the context to every record and
+// redacts attributes that carry credentials.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the value of any attribute whose key names a secret.
+const Redacted = "[REDACTED]"
+
+var secretKeys = []string{
+	"authorization",
+	"password",
+	"token",
+	"secret",
+	"api_key",
+	"apikey",
+	"cookie",
+}
+
+// New returns a logger writing to w. level is one of debug, info, warn or
+// error and format is json or text; empty values default to info and json.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level == "" {
+		level = "info"
+	}
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       lvl,
+		ReplaceAttr: redact,
+	}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "", "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, want json or text", format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// IsSecretKey reports whether an attribute or header with this name holds a
+// credential that must never be logged.
+func IsSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() != slog.KindGroup && IsSecretKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+type requestInfoKey struct{}
+
+// RequestInfo is request scoped data attached to log records. It is stored
+// by pointer so handlers deeper in the chain can fill in the user after
+// authenticating and the access log still sees it.
+type RequestInfo struct {
+	ID     string
+	UserID string
+}
+
+// WithRequestInfo returns a context carrying info.
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom returns the request info stored in ctx, or nil.
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+// RequestID returns the ID of the request being served, if any.
+func RequestID(ctx context.Context) string {
+	if info := RequestInfoFrom(ctx); info != nil {
+		return info.ID
+	}
+	return ""
+}
+
+// SetUserID records the authenticated user for the current request.
+func SetUserID(ctx context.Context, userID string) {
+	if info := RequestInfoFrom(ctx); info != nil {
+		info.UserID = userID
+	}
+}
+
+// contextHandler decorates records logged with a request context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if info := RequestInfoFrom(ctx); info != nil {
+		r.AddAttrs(slog.String("request_id", info.ID))
+		if info.UserID != "" {
+			r.AddAttrs(slog.String("user_id", info.UserID))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
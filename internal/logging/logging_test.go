@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestNewRedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "debug", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithRequestInfo(context.Background(), &RequestInfo{ID: "req-1"})
+	SetUserID(ctx, "user-1")
+	logger.InfoContext(ctx, "hello",
+		"refresh_token", "abc123",
+		"Authorization", "Bearer abc123",
+		"password", "hunter2",
+		"email", "a@example.com",
+	)
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("log output is not JSON: %v\n%s", err, buf.String())
+	}
+
+	want := map[string]any{
+		"msg":           "hello",
+		"refresh_token": Redacted,
+		"Authorization": Redacted,
+		"password":      Redacted,
+		"email":         "a@example.com",
+		"request_id":    "req-1",
+		"user_id":       "user-1",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if bytes.Contains(buf.Bytes(), []byte("abc123")) || bytes.Contains(buf.Bytes(), []byte("hunter2")) {
+		t.Errorf("secret leaked into log output: %s", buf.String())
+	}
+}
+
+func TestNewRejectsBadConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		level  string
+		format string
+	}{
+		{name: "Bad level", level: "verbose", format: "json"},
+		{name: "Bad format", level: "info", format: "xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(&bytes.Buffer{}, tt.level, tt.format); err == nil {
+				t.Errorf("New(%q, %q) succeeded, want error", tt.level, tt.format)
+			}
+		})
+	}
+}
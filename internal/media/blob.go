@@ -0,0 +1,32 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrBlobNotFound is returned by a BlobStore when no blob exists for a key.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore is the storage backend for uploaded media. Keys are slash
+// separated paths such as "avatars/<user id>/<name>.jpg". The local disk
+// implementation lives in this package; an S3-compatible store only needs to
+// satisfy the same interface.
+type BlobStore interface {
+	// Put stores the contents of r under key, replacing any existing blob.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens the blob stored under key. Callers must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is
+	// not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the public URL clients should use to fetch key.
+	URL(key string) string
+}
+
+// Pinger is implemented by blob stores that can report whether they are
+// reachable, for use in readiness checks.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
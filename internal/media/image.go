@@ -0,0 +1,228 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxImagePixels bounds the decoded size of an upload so a small,
+	// highly compressed file can't exhaust memory.
+	MaxImagePixels = 40_000_000
+	// MinImageSize is the shortest side ProcessImage accepts. Thinner
+	// images would be cropped to nothing for the wider variants.
+	MinImageSize = 16
+	jpegQuality  = 85
+)
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image type")
+	ErrImageTooLarge    = errors.New("image dimensions too large")
+	ErrImageTooSmall    = errors.New("image dimensions too small")
+)
+
+// Variant is a fixed output size produced for every processed upload. The
+// source is scaled to cover the box and center cropped to its aspect ratio.
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+var (
+	AvatarVariants = []Variant{
+		{Name: "small", Width: 96, Height: 96},
+		{Name: "large", Width: 400, Height: 400},
+	}
+	BannerVariants = []Variant{
+		{Name: "small", Width: 600, Height: 200},
+		{Name: "large", Width: 1500, Height: 500},
+	}
+)
+
+const (
+	attachmentMaxSize = 2048
+	thumbnailMaxSize  = 400
+)
+
+// Rendition is the encoded output for a single Variant.
+type Rendition struct {
+	Variant     Variant
+	ContentType string
+	Data        []byte
+}
+
+// Attachment is a processed chirp attachment: the full size image, a
+// thumbnail and a BlurHash placeholder clients can render while loading.
+type Attachment struct {
+	Full      Rendition
+	Thumbnail Rendition
+	Width     int
+	Height    int
+	Blurhash  string
+}
+
+// SniffImageType reports the content type of data by inspecting its leading
+// bytes rather than trusting the client supplied header.
+func SniffImageType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return contentType, nil
+	}
+	return "", ErrUnsupportedImage
+}
+
+// DecodeImage sniffs and decodes data, applying any EXIF orientation so the
+// pixels are upright. The returned image carries no metadata, so re-encoding
+// it strips EXIF and any other embedded profiles.
+func DecodeImage(data []byte) (image.Image, error) {
+	contentType, err := SniffImageType(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+
+	if contentType == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	return img, nil
+}
+
+// ProcessImage decodes data and renders each variant as a JPEG. Both
+// sides of the image must be at least MinImageSize.
+func ProcessImage(data []byte, variants []Variant) ([]Rendition, error) {
+	img, err := DecodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	if b := img.Bounds(); min(b.Dx(), b.Dy()) < MinImageSize {
+		return nil, ErrImageTooSmall
+	}
+
+	renditions := make([]Rendition, 0, len(variants))
+	for _, v := range variants {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, Fill(img, v.Width, v.Height), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, Rendition{
+			Variant:     v,
+			ContentType: "image/jpeg",
+			Data:        buf.Bytes(),
+		})
+	}
+	return renditions, nil
+}
+
+// ProcessAttachment decodes data and renders a full size image bounded by
+// 2048px and a thumbnail bounded by 400px, both keeping the aspect ratio.
+func ProcessAttachment(data []byte) (Attachment, error) {
+	img, err := DecodeImage(data)
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	full := Fit(img, attachmentMaxSize, attachmentMaxSize)
+	thumb := Fit(img, thumbnailMaxSize, thumbnailMaxSize)
+
+	xComponents, yComponents := 4, 3
+	if full.Bounds().Dy() > full.Bounds().Dx() {
+		xComponents, yComponents = 3, 4
+	}
+
+	a := Attachment{
+		Width:    full.Bounds().Dx(),
+		Height:   full.Bounds().Dy(),
+		Blurhash: Blurhash(thumb, xComponents, yComponents),
+	}
+	for _, r := range []struct {
+		dst  *Rendition
+		name string
+		img  image.Image
+	}{
+		{&a.Full, "full", full},
+		{&a.Thumbnail, "thumbnail", thumb},
+	} {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, r.img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return Attachment{}, err
+		}
+		b := r.img.Bounds()
+		*r.dst = Rendition{
+			Variant:     Variant{Name: r.name, Width: b.Dx(), Height: b.Dy()},
+			ContentType: "image/jpeg",
+			Data:        buf.Bytes(),
+		}
+	}
+	return a, nil
+}
+
+// Fit scales src down to fit within a maxWidth x maxHeight box, keeping its
+// aspect ratio, and flattens any transparency onto white. Images that already
+// fit are copied at their original size.
+func Fit(src image.Image, maxWidth, maxHeight int) *image.RGBA {
+	b := src.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width > maxWidth {
+		height = max(1, height*maxWidth/width)
+		width = maxWidth
+	}
+	if height > maxHeight {
+		width = max(1, width*maxHeight/height)
+		height = maxHeight
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	if width == b.Dx() && height == b.Dy() {
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Over)
+		return dst
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+	return dst
+}
+
+// Fill scales src to cover a width x height box, crops the overflow evenly
+// from both sides and flattens any transparency onto white.
+func Fill(src image.Image, width, height int) *image.RGBA {
+	b := src.Bounds()
+	crop := b
+	if b.Dx()*height > b.Dy()*width {
+		w := b.Dy() * width / height
+		crop.Min.X = b.Min.X + (b.Dx()-w)/2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		h := b.Dx() * height / width
+		crop.Min.Y = b.Min.Y + (b.Dy()-h)/2
+		crop.Max.Y = crop.Min.Y + h
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+	return dst
+}
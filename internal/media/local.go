@@ -0,0 +1,132 @@
+package media
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// LocalBlobStore keeps blobs as files under a root directory on local disk.
+type LocalBlobStore struct {
+	root    *os.Root
+	baseURL string
+}
+
+// NewLocalBlobStore opens (creating if needed) dir as a blob store whose
+// blobs are served from baseURL, e.g. "/media/".
+func NewLocalBlobStore(dir, baseURL string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating media dir: %w", err)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("opening media dir: %w", err)
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return &LocalBlobStore{root: root, baseURL: baseURL}, nil
+}
+
+// Ping checks the media directory is still there.
+func (s *LocalBlobStore) Ping(ctx context.Context) error {
+	info, err := s.root.Stat(".")
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("media dir is not a directory")
+	}
+	return nil
+}
+
+// Put writes the blob to a temporary file and renames it into place so
+// readers never observe a partially written blob.
+func (s *LocalBlobStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	name, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	if dir := path.Dir(name); dir != "." {
+		if err := s.root.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	tmp := name + ".tmp-" + hex.EncodeToString(suffix)
+
+	f, err := s.root.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		s.root.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		s.root.Remove(tmp)
+		return err
+	}
+	if err := s.root.Rename(tmp, name); err != nil {
+		s.root.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := cleanKey(key)
+	if err != nil {
+		return nil, ErrBlobNotFound
+	}
+	f, err := s.root.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, ErrBlobNotFound
+	}
+	return f, nil
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	name, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	err = s.root.Remove(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalBlobStore) URL(key string) string {
+	return s.baseURL + key
+}
+
+func cleanKey(key string) (string, error) {
+	if key == "" || !fs.ValidPath(key) || strings.Contains(key, ".tmp-") {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return key, nil
+}
@@ -0,0 +1,205 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withOrientation inserts a minimal big-endian EXIF APP1 segment carrying the
+// given orientation right after the JPEG SOI marker.
+func withOrientation(jpg []byte, orientation uint16) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8, // header, IFD0 at offset 8
+		0, 1, // one entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, byte(orientation >> 8), byte(orientation), 0, 0,
+		0, 0, 0, 0, // no next IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	size := len(payload) + 2
+	segment := append([]byte{0xFF, 0xE1, byte(size >> 8), byte(size)}, payload...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestSniffImageType(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "PNG", data: encodePNG(t, 4, 4), want: "image/png"},
+		{name: "Text", data: []byte("hello, definitely not an image"), wantErr: true},
+		{name: "HTML", data: []byte("<html><script>alert(1)</script></html>"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SniffImageType(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SniffImageType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SniffImageType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessImage(t *testing.T) {
+	renditions, err := ProcessImage(encodePNG(t, 300, 120), BannerVariants)
+	if err != nil {
+		t.Fatalf("ProcessImage() error = %v", err)
+	}
+	if len(renditions) != len(BannerVariants) {
+		t.Fatalf("ProcessImage() returned %d renditions, want %d", len(renditions), len(BannerVariants))
+	}
+
+	for i, r := range renditions {
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(r.Data))
+		if err != nil {
+			t.Fatalf("decoding %s rendition: %v", r.Variant.Name, err)
+		}
+		want := BannerVariants[i]
+		if format != "jpeg" || cfg.Width != want.Width || cfg.Height != want.Height {
+			t.Errorf("%s rendition = %s %dx%d, want jpeg %dx%d", r.Variant.Name, format, cfg.Width, cfg.Height, want.Width, want.Height)
+		}
+	}
+}
+
+func TestProcessImageStripsEXIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 20)), nil); err != nil {
+		t.Fatal(err)
+	}
+	src := withOrientation(buf.Bytes(), 6)
+	if got := jpegOrientation(src); got != 6 {
+		t.Fatalf("jpegOrientation() = %d, want 6", got)
+	}
+
+	img, err := DecodeImage(src)
+	if err != nil {
+		t.Fatalf("DecodeImage() error = %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 40 {
+		t.Errorf("DecodeImage() = %dx%d, want rotated 20x40", b.Dx(), b.Dy())
+	}
+
+	renditions, err := ProcessImage(src, AvatarVariants)
+	if err != nil {
+		t.Fatalf("ProcessImage() error = %v", err)
+	}
+	for _, r := range renditions {
+		if bytes.Contains(r.Data, []byte("Exif\x00\x00")) {
+			t.Errorf("%s rendition still contains EXIF data", r.Variant.Name)
+		}
+	}
+}
+
+func TestProcessImageRejectsTinyImages(t *testing.T) {
+	for _, size := range [][2]int{{1, 1}, {2000, MinImageSize - 1}} {
+		if _, err := ProcessImage(encodePNG(t, size[0], size[1]), BannerVariants); !errors.Is(err, ErrImageTooSmall) {
+			t.Errorf("ProcessImage(%dx%d) error = %v, want ErrImageTooSmall", size[0], size[1], err)
+		}
+	}
+	if _, err := ProcessImage(encodePNG(t, MinImageSize, MinImageSize), BannerVariants); err != nil {
+		t.Errorf("ProcessImage(%[1]dx%[1]d) error = %[2]v", MinImageSize, err)
+	}
+}
+
+func TestProcessImageRejectsUnsupported(t *testing.T) {
+	_, err := ProcessImage([]byte("GIF89a\x01\x00\x01\x00"), AvatarVariants)
+	if !errors.Is(err, ErrUnsupportedImage) {
+		t.Errorf("ProcessImage() error = %v, want ErrUnsupportedImage", err)
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalBlobStore(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "avatars/abc/def_small.jpg"
+	if err := store.Put(ctx, key, strings.NewReader("pixels"), "image/jpeg"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "pixels" {
+		t.Errorf("Get() = %q, want %q", got, "pixels")
+	}
+
+	if url := store.URL(key); url != "/media/"+key {
+		t.Errorf("URL() = %q", url)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrBlobNotFound", err)
+	}
+
+	for _, bad := range []string{"../escape", "/abs/path", "a/../../b"} {
+		if err := store.Put(ctx, bad, strings.NewReader("x"), "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestBlurhash(t *testing.T) {
+	solid := image.NewUniform(color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(img, img.Bounds(), solid, image.Point{}, draw.Src)
+
+	got := Blurhash(img, 4, 3)
+	// size flag, max AC, 4 chars of DC and 2 per AC component
+	if len(got) != 1+1+4+2*(4*3-1) {
+		t.Fatalf("Blurhash() = %q, unexpected length %d", got, len(got))
+	}
+	if got[:1] != encode83(3+2*9, 1) {
+		t.Errorf("Blurhash() size flag = %q, want %q", got[:1], encode83(3+2*9, 1))
+	}
+	if dc := got[2:6]; dc != encode83(0xFFFFFF, 4) {
+		t.Errorf("Blurhash() DC = %q, want white %q", dc, encode83(0xFFFFFF, 4))
+	}
+
+	for _, c := range got {
+		if !strings.ContainsRune(base83Chars, c) {
+			t.Errorf("Blurhash() = %q contains %q outside the base83 alphabet", got, c)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+// Package metrics is a small in-process implementation of the Prometheus
+// text exposition format (version 0.0.4). It supports counters, gauges and
+// histograms, optionally partitioned by labels, and gauges or counters whose
+// value is read at scrape time.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default histogram buckets, in seconds, suited to
+// request latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics exposed by a single endpoint, written in the
+// order they were registered.
+type Registry struct {
+	mu         sync.Mutex
+	names      map[string]bool
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes every registered metric in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the registry for Prometheus to scrape.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteTo(w)
+	})
+}
+
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.typ)
+}
+
+// Counter is a monotonically increasing integer.
+type Counter struct {
+	desc
+	v atomic.Uint64
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{desc: desc{name: name, help: help, typ: "counter"}}
+	r.register(name, c)
+	return c
+}
+
+func (c *Counter) Inc()         { c.v.Add(1) }
+func (c *Counter) Add(n uint64) { c.v.Add(n) }
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	writeSample(w, c.name, nil, nil, float64(c.v.Load()))
+}
+
+// Gauge is an integer that can go up and down.
+type Gauge struct {
+	desc
+	v atomic.Int64
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{desc: desc{name: name, help: help, typ: "gauge"}}
+	r.register(name, g)
+	return g
+}
+
+func (g *Gauge) Inc()        { g.v.Add(1) }
+func (g *Gauge) Dec()        { g.v.Add(-1) }
+func (g *Gauge) Set(n int64) { g.v.Store(n) }
+func (g *Gauge) Value() int64 {
+	return g.v.Load()
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	writeSample(w, g.name, nil, nil, float64(g.v.Load()))
+}
+
+// valueFunc is a gauge or counter whose value is computed at scrape time,
+// for example from sql.DB.Stats.
+type valueFunc struct {
+	desc
+	fn func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &valueFunc{desc: desc{name: name, help: help, typ: "gauge"}, fn: fn})
+}
+
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, &valueFunc{desc: desc{name: name, help: help, typ: "counter"}, fn: fn})
+}
+
+func (f *valueFunc) write(w *bufio.Writer) {
+	f.writeHeader(w)
+	writeSample(w, f.name, nil, nil, f.fn())
+}
+
+// vec tracks one child per distinct combination of label values.
+type vec[T any] struct {
+	desc
+	mu       sync.RWMutex
+	children map[string]*T
+	values   map[string][]string
+	newChild func() *T
+}
+
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok := v.children[key]; ok {
+		return child
+	}
+	child = v.newChild()
+	v.children[key] = child
+	v.values[key] = slices.Clone(values)
+	return child
+}
+
+// each visits children sorted by label values so output is stable.
+func (v *vec[T]) each(fn func(values []string, child *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	v.mu.RUnlock()
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		v.mu.RLock()
+		child, values := v.children[k], v.values[k]
+		v.mu.RUnlock()
+		fn(values, child)
+	}
+}
+
+// CounterVec is a Counter partitioned by labels.
+type CounterVec struct {
+	vec[Counter]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec[Counter]{
+		desc:     desc{name: name, help: help, typ: "counter", labels: labels},
+		children: map[string]*Counter{},
+		values:   map[string][]string{},
+		newChild: func() *Counter { return &Counter{} },
+	}}
+	r.register(name, c)
+	return c
+}
+
+// With returns the counter for the given label values, in the order the
+// labels were declared.
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.with(values)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	c.each(func(values []string, child *Counter) {
+		writeSample(w, c.name, c.labels, values, float64(child.v.Load()))
+	})
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) writeSamples(w *bufio.Writer, name string, labels, values []string) {
+	h.mu.Lock()
+	counts := slices.Clone(h.counts)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+
+	bucketLabels := append(slices.Clone(labels), "le")
+	for i, upper := range h.buckets {
+		writeSample(w, name+"_bucket", bucketLabels, append(slices.Clone(values), formatFloat(upper)), float64(counts[i]))
+	}
+	writeSample(w, name+"_bucket", bucketLabels, append(slices.Clone(values), "+Inf"), float64(count))
+	writeSample(w, name+"_sum", labels, values, sum)
+	writeSample(w, name+"_count", labels, values, float64(count))
+}
+
+// HistogramVec is a Histogram partitioned by labels.
+type HistogramVec struct {
+	vec[Histogram]
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	h := &HistogramVec{vec[Histogram]{
+		desc:     desc{name: name, help: help, typ: "histogram", labels: labels},
+		children: map[string]*Histogram{},
+		values:   map[string][]string{},
+		newChild: func() *Histogram { return newHistogram(buckets) },
+	}}
+	r.register(name, h)
+	return h
+}
+
+// With returns the histogram for the given label values, in the order the
+// labels were declared.
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.with(values)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w)
+	h.each(func(values []string, child *Histogram) {
+		child.writeSamples(w, h.name, h.labels, values)
+	})
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label)
+			w.WriteString(`="`)
+			w.WriteString(escapeLabel(values[i]))
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+
+	logins := r.NewCounter("logins_total", "Successful logins.")
+	logins.Add(3)
+
+	inFlight := r.NewGauge("in_flight", "Requests in flight.")
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+
+	r.NewGaugeFunc("pool_open", "Open connections.", func() float64 { return 4 })
+
+	requests := r.NewCounterVec("requests_total", "Requests by route.", "route", "code")
+	requests.With("GET /b", "2xx").Inc()
+	requests.With("GET /a", "4xx").Add(2)
+	requests.With("GET /a", "2xx").Inc()
+
+	latency := r.NewHistogramVec("latency_seconds", "Latency.\nSecond line.", []float64{0.5, 0.1}, "route")
+	latency.With(`GET /"q"`).Observe(0.05)
+	latency.With(`GET /"q"`).Observe(0.3)
+	latency.With(`GET /"q"`).Observe(2)
+
+	var sb strings.Builder
+	if _, err := r.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	want := `# HELP logins_total Successful logins.
+# TYPE logins_total counter
+logins_total 3
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP pool_open Open connections.
+# TYPE pool_open gauge
+pool_open 4
+# HELP requests_total Requests by route.
+# TYPE requests_total counter
+requests_total{route="GET /a",code="2xx"} 1
+requests_total{route="GET /a",code="4xx"} 2
+requests_total{route="GET /b",code="2xx"} 1
+# HELP latency_seconds Latency.\nSecond line.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="GET /\"q\"",le="0.1"} 1
+latency_seconds_bucket{route="GET /\"q\"",le="0.5"} 2
+latency_seconds_bucket{route="GET /\"q\"",le="+Inf"} 3
+latency_seconds_sum{route="GET /\"q\""} 2.35
+latency_seconds_count{route="GET /\"q\""} 3
+`
+	if got := sb.String(); got != want {
+		t.Errorf("WriteTo() mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistryDuplicatePanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("dup_total", "first")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate metric did not panic")
+		}
+	}()
+	r.NewGauge("dup_total", "second")
+}
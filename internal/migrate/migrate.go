@@ -0,0 +1,413 @@
+// Package migrate applies goose-annotated SQL migrations to Postgres or
+// SQLite. It keeps its bookkeeping in goose's goose_db_version table, so
+// databases migrated with the goose CLI can be taken over by the chirpy
+// binary and vice versa.
+//
+// Only the subset of goose used by sql/schema is supported: one "-- +goose
+// Up" and one "-- +goose Down" section per file, each run as a whole inside
+// a transaction.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect holds the database specific SQL the migrator runs.
+type Dialect struct {
+	// lock and unlock bracket every change; empty when the database
+	// serializes writers itself.
+	lock        string
+	unlock      string
+	tableExists string
+	createTable string
+	// insertVersion takes the version and whether it is being applied.
+	insertVersion string
+}
+
+var (
+	// Postgres holds a session advisory lock while migrating so replicas
+	// starting at the same time take turns. The key is "chirpy" in hex.
+	Postgres = Dialect{
+		lock:        "select pg_advisory_lock(109300096856185)",
+		unlock:      "select pg_advisory_unlock(109300096856185)",
+		tableExists: "select to_regclass('goose_db_version') is not null",
+		createTable: `create table goose_db_version (
+			id serial not null,
+			version_id bigint not null,
+			is_applied boolean not null,
+			tstamp timestamp null default now(),
+			primary key(id)
+		)`,
+		insertVersion: "insert into goose_db_version (version_id, is_applied) values ($1, $2)",
+	}
+
+	// SQLite databases are only ever opened by one process, and SQLite
+	// serializes writers, so no lock is needed.
+	SQLite = Dialect{
+		tableExists: "select count(*) > 0 from sqlite_master where type = 'table' and name = 'goose_db_version'",
+		createTable: `create table goose_db_version (
+			id integer primary key autoincrement,
+			version_id integer not null,
+			is_applied integer not null,
+			tstamp timestamp default (datetime('now'))
+		)`,
+		insertVersion: "insert into goose_db_version (version_id, is_applied) values (?, ?)",
+	}
+)
+
+var (
+	// ErrUnknownVersion means the database was migrated by a newer build.
+	ErrUnknownVersion = errors.New("database schema version is unknown to this build")
+	// ErrPending means migrations need to be applied.
+	ErrPending = errors.New("database schema has pending migrations")
+	// ErrNoApplied is returned by Down when there is nothing to roll back.
+	ErrNoApplied = errors.New("no migrations to roll back")
+)
+
+// Migration is one NNN_name.sql file.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Parse reads every *.sql file at the root of fsys, sorted by version.
+func Parse(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := map[int64]string{}
+	for _, name := range names {
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("%s: migration files must be named NNN_description.sql", name)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("%s and %s share version %d", other, name, version)
+		}
+		seen[version] = name
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		up, down, err := parseSections(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    strings.TrimSuffix(path.Base(name), ".sql"),
+			Up:      up,
+			Down:    down,
+		})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return int(a.Version - b.Version)
+	})
+	return migrations, nil
+}
+
+func parseSections(src string) (up, down string, err error) {
+	var cur *strings.Builder
+	var upB, downB strings.Builder
+	var sawUp bool
+	for line := range strings.Lines(src) {
+		switch directive := strings.TrimSpace(line); {
+		case strings.EqualFold(directive, "-- +goose Up"):
+			cur, sawUp = &upB, true
+			continue
+		case strings.EqualFold(directive, "-- +goose Down"):
+			cur = &downB
+			continue
+		case strings.HasPrefix(directive, "-- +goose"):
+			return "", "", fmt.Errorf("unsupported directive %q", directive)
+		}
+		if cur != nil {
+			cur.WriteString(line)
+		}
+	}
+	if !sawUp {
+		return "", "", errors.New("missing -- +goose Up")
+	}
+	return strings.TrimSpace(upB.String()), strings.TrimSpace(downB.String()), nil
+}
+
+// Migrator applies a fixed set of migrations to a database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// New returns a Migrator applying the migrations in fsys to db, which
+// speaks dialect.
+func New(db *sql.DB, dialect Dialect, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Parse(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, errors.New("no migrations found")
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Latest is the newest version this build knows about.
+func (m *Migrator) Latest() int64 {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	i, ok := slices.BinarySearchFunc(m.migrations, version, func(mig Migration, v int64) int {
+		return int(mig.Version - v)
+	})
+	if !ok {
+		return Migration{}, false
+	}
+	return m.migrations[i], true
+}
+
+// Status describes one known migration.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Version returns the newest applied version, or 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	applied, err := m.appliedVersions(ctx, m.db)
+	if err != nil {
+		return 0, err
+	}
+	return current(applied), nil
+}
+
+// Check returns ErrUnknownVersion if the database is ahead of this build
+// and ErrPending if it is behind.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if _, known := m.find(version); version > m.Latest() || (version != 0 && !known) {
+		return fmt.Errorf("%w: database is at %d, newest known is %d", ErrUnknownVersion, version, m.Latest())
+	}
+	if version < m.Latest() {
+		return fmt.Errorf("%w: database is at %d, want %d", ErrPending, version, m.Latest())
+	}
+	return nil
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.appliedVersions(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		at, ok := applied[mig.Version]
+		statuses[i] = Status{Migration: mig, Applied: ok, AppliedAt: at}
+	}
+	return statuses, nil
+}
+
+// Up applies every migration newer than the current version and returns
+// the ones it ran.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var ran []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		version := current(applied)
+		if version > m.Latest() {
+			return fmt.Errorf("%w: database is at %d, newest known is %d", ErrUnknownVersion, version, m.Latest())
+		}
+		for _, mig := range m.migrations {
+			if mig.Version <= version {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig.Version, mig.Up, true); err != nil {
+				return fmt.Errorf("applying %s: %w", mig.Name, err)
+			}
+			ran = append(ran, mig)
+		}
+		return nil
+	})
+	return ran, err
+}
+
+// Down rolls back the newest applied migration.
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	var mig Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		mig, err = m.down(ctx, conn)
+		return err
+	})
+	return mig, err
+}
+
+// Redo rolls back the newest applied migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) (Migration, error) {
+	var mig Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		if mig, err = m.down(ctx, conn); err != nil {
+			return err
+		}
+		if err := m.apply(ctx, conn, mig.Version, mig.Up, true); err != nil {
+			return fmt.Errorf("applying %s: %w", mig.Name, err)
+		}
+		return nil
+	})
+	return mig, err
+}
+
+func (m *Migrator) down(ctx context.Context, conn *sql.Conn) (Migration, error) {
+	applied, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return Migration{}, err
+	}
+	version := current(applied)
+	if version == 0 {
+		return Migration{}, ErrNoApplied
+	}
+	mig, ok := m.find(version)
+	if !ok {
+		return Migration{}, fmt.Errorf("%w: can't roll back version %d", ErrUnknownVersion, version)
+	}
+	if err := m.apply(ctx, conn, mig.Version, mig.Down, false); err != nil {
+		return Migration{}, fmt.Errorf("rolling back %s: %w", mig.Name, err)
+	}
+	return mig, nil
+}
+
+// locked runs fn on a single connection holding the advisory lock, after
+// making sure the version table exists.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect.lock != "" {
+		if _, err := conn.ExecContext(ctx, m.dialect.lock); err != nil {
+			return fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		// unlock even if ctx was cancelled mid-migration
+		defer conn.ExecContext(context.WithoutCancel(ctx), m.dialect.unlock)
+	}
+
+	if err := m.ensureVersionTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// querier is satisfied by both *sql.DB and *sql.Conn.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (m *Migrator) versionTableExists(ctx context.Context, q querier) (bool, error) {
+	var exists bool
+	err := q.QueryRowContext(ctx, m.dialect.tableExists).Scan(&exists)
+	return exists, err
+}
+
+// ensureVersionTable creates goose_db_version the way goose does.
+func (m *Migrator) ensureVersionTable(ctx context.Context, q querier) error {
+	exists, err := m.versionTableExists(ctx, q)
+	if err != nil || exists {
+		return err
+	}
+	if _, err := q.ExecContext(ctx, m.dialect.createTable); err != nil {
+		return fmt.Errorf("creating goose_db_version: %w", err)
+	}
+	_, err = q.ExecContext(ctx, m.dialect.insertVersion, 0, true)
+	return err
+}
+
+// appliedVersions returns when each currently applied version was applied.
+// A version is applied if its most recent row has is_applied set; rolling
+// back inserts a row with is_applied false, like goose.
+func (m *Migrator) appliedVersions(ctx context.Context, q querier) (map[int64]time.Time, error) {
+	applied := map[int64]time.Time{}
+	// an unmigrated database has no version table yet
+	if exists, err := m.versionTableExists(ctx, q); err != nil || !exists {
+		return applied, err
+	}
+
+	rows, err := q.QueryContext(ctx, "select version_id, is_applied, tstamp from goose_db_version order by id desc")
+	if err != nil {
+		return nil, fmt.Errorf("reading goose_db_version: %w", err)
+	}
+	defer rows.Close()
+
+	seen := map[int64]bool{}
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var at sql.NullTime
+		if err := rows.Scan(&version, &isApplied, &at); err != nil {
+			return nil, err
+		}
+		if seen[version] {
+			continue
+		}
+		seen[version] = true
+		if isApplied && version != 0 {
+			applied[version] = at.Time
+		}
+	}
+	return applied, rows.Err()
+}
+
+func current(applied map[int64]time.Time) int64 {
+	var version int64
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, version int64, stmts string, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if stmts != "" {
+		if _, err := tx.ExecContext(ctx, stmts); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, m.dialect.insertVersion, version, up); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/jwoodsiii/chirpy/sql/schema"
+)
+
+func TestParse(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_chirps.sql": {Data: []byte("-- +goose Up\ncreate table chirps (id uuid);\n\n-- +goose Down\ndrop table chirps;\n")},
+		"001_users.sql":  {Data: []byte("-- +goose Up\ncreate table users (id uuid);\n-- +goose Down\ndrop table users;\n")},
+		"README.md":      {Data: []byte("not a migration")},
+	}
+
+	migrations, err := Parse(fsys)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations, want 2", len(migrations))
+	}
+
+	first := migrations[0]
+	if first.Version != 1 || first.Name != "001_users" {
+		t.Errorf("first migration = %d %s, want 1 001_users", first.Version, first.Name)
+	}
+	if first.Up != "create table users (id uuid);" {
+		t.Errorf("Up = %q", first.Up)
+	}
+	if first.Down != "drop table users;" {
+		t.Errorf("Down = %q", first.Down)
+	}
+	if migrations[1].Version != 2 {
+		t.Errorf("migrations not sorted by version: %+v", migrations)
+	}
+}
+
+func TestParseRejectsBadFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "Bad name",
+			fsys: fstest.MapFS{"users.sql": {Data: []byte("-- +goose Up\nselect 1;")}},
+		},
+		{
+			name: "Duplicate version",
+			fsys: fstest.MapFS{
+				"001_a.sql": {Data: []byte("-- +goose Up\nselect 1;")},
+				"1_b.sql":   {Data: []byte("-- +goose Up\nselect 1;")},
+			},
+		},
+		{
+			name: "Missing up",
+			fsys: fstest.MapFS{"001_a.sql": {Data: []byte("select 1;")}},
+		},
+		{
+			name: "Unsupported directive",
+			fsys: fstest.MapFS{"001_a.sql": {Data: []byte("-- +goose Up\n-- +goose StatementBegin\nselect 1;")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.fsys); err == nil {
+				t.Error("Parse() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestEmbeddedSchema(t *testing.T) {
+	migrations, err := Parse(schema.FS)
+	if err != nil {
+		t.Fatalf("Parse(schema.FS) error = %v", err)
+	}
+	for i, mig := range migrations {
+		if mig.Version != int64(i+1) {
+			t.Errorf("%s: version %d, want %d with no gaps", mig.Name, mig.Version, i+1)
+		}
+		if mig.Up == "" || mig.Down == "" {
+			t.Errorf("%s: missing up or down section", mig.Name)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Package problem turns handler errors into RFC 9457 (formerly RFC 7807)
+// problem details responses. Each Code is a stable identifier clients can
+// match on; the detail is written for the client, and the underlying
+// cause is only ever logged.
+//
+// The package only knows the standard library's errors. Errors from
+// drivers and other packages get their problems from a Mapper registered
+// by the program.
+package problem
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// ContentType is the media type of problem details responses.
+const ContentType = "application/problem+json"
+
+// TypePrefix is prepended to a Code to form the problem type URI.
+const TypePrefix = "urn:chirpy:problem:"
+
+type Code string
+
+const (
+	BadRequest           Code = "bad_request"
+	ValidationFailed     Code = "validation_failed"
+	Unauthorized         Code = "unauthorized"
+	Forbidden            Code = "forbidden"
+	NotFound             Code = "not_found"
+	Conflict             Code = "conflict"
+	PayloadTooLarge      Code = "payload_too_large"
+	UnsupportedMediaType Code = "unsupported_media_type"
+	TooManyRequests      Code = "rate_limited"
+	Internal             Code = "internal"
+	NotImplemented       Code = "not_implemented"
+	Unavailable          Code = "unavailable"
+)
+
+type codeInfo struct {
+	status int
+	title  string
+}
+
+var codes = map[Code]codeInfo{
+	BadRequest:           {http.StatusBadRequest, "Malformed request"},
+	ValidationFailed:     {http.StatusBadRequest, "Validation failed"},
+	Unauthorized:         {http.StatusUnauthorized, "Authentication required"},
+	Forbidden:            {http.StatusForbidden, "Forbidden"},
+	NotFound:             {http.StatusNotFound, "Not found"},
+	Conflict:             {http.StatusConflict, "Conflict"},
+	PayloadTooLarge:      {http.StatusRequestEntityTooLarge, "Payload too large"},
+	UnsupportedMediaType: {http.StatusUnsupportedMediaType, "Unsupported media type"},
+	TooManyRequests:      {http.StatusTooManyRequests, "Too many requests"},
+	Internal:             {http.StatusInternalServerError, "Internal server error"},
+	NotImplemented:       {http.StatusNotImplemented, "Not implemented"},
+	Unavailable:          {http.StatusServiceUnavailable, "Service unavailable"},
+}
+
+// Error is a handler error with a client-facing detail and an optional
+// internal cause.
+type Error struct {
+	Code   Code
+	Detail string
+	Cause  error
+}
+
+// New returns a problem with no internal cause.
+func New(code Code, detail string) *Error {
+	return &Error{Code: code, Detail: detail}
+}
+
+// Newf is New with a formatted detail.
+func Newf(code Code, format string, args ...any) *Error {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+// Wrap returns a problem caused by err. err is logged but never sent to
+// the client.
+func Wrap(code Code, err error, detail string) *Error {
+	return &Error{Code: code, Detail: detail, Cause: err}
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// A Mapper returns the problem for the errors it recognizes and nil for
+// any other.
+type Mapper func(err error) *Error
+
+var mappers []Mapper
+
+// Register adds m to the mappers From consults, in the order they were
+// registered. It is not safe to call while errors are being converted,
+// so call it from an init function.
+func Register(m Mapper) {
+	mappers = append(mappers, m)
+}
+
+// FieldError describes one invalid field. Limit and Count are set by
+// handlers that measure a value themselves, so a client can show how far
+// over the limit it is.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Limit   int    `json:"limit,omitempty"`
+	Count   int    `json:"count,omitempty"`
+}
+
+// InvalidFields is implemented by errors that report invalid request
+// fields. From makes them ValidationFailed problems, and Write lists the
+// fields in the response.
+type InvalidFields interface {
+	error
+	InvalidFields() []FieldError
+}
+
+// From converts err into a problem. Problems pass through unchanged;
+// invalid fields, missing rows and errors a registered Mapper recognizes
+// get their matching code; anything else is an internal error with a
+// generic detail.
+func From(err error) *Error {
+	var p *Error
+	if errors.As(err, &p) {
+		// A handler that gave up because its deadline passed reports an
+		// internal error; tell the client it may retry.
+		if p.Code == Internal && errors.Is(p.Cause, context.DeadlineExceeded) {
+			return Wrap(Unavailable, p.Cause, "the request timed out")
+		}
+		return p
+	}
+
+	var invalid InvalidFields
+	switch {
+	case errors.As(err, &invalid):
+		return Wrap(ValidationFailed, err, "the request has invalid fields")
+	case errors.Is(err, sql.ErrNoRows):
+		return Wrap(NotFound, err, "resource not found")
+	}
+	for _, m := range mappers {
+		if p := m(err); p != nil {
+			return p
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Wrap(Unavailable, err, "the request timed out")
+	}
+	return Wrap(Internal, err, "an unexpected error occurred")
+}
+
+// CodeOf returns the code From assigns to err.
+func CodeOf(err error) Code {
+	return From(err).Code
+}
+
+// Details is the problem details document. Errors lists the invalid
+// fields when the problem's cause has InvalidFields, and RequestID is the
+// response's X-Request-ID header so clients can quote it in bug reports.
+type Details struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      Code         `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// Write responds to r with err as problem details and logs its cause:
+// at error level for server errors, at debug level otherwise.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	p := From(err)
+	info, ok := codes[p.Code]
+	if !ok {
+		info = codes[Internal]
+	}
+
+	if info.status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "request failed", "code", p.Code, "detail", p.Detail, "err", p.Cause)
+	} else if p.Cause != nil {
+		slog.DebugContext(r.Context(), "request rejected", "code", p.Code, "detail", p.Detail, "err", p.Cause)
+	}
+
+	var fields []FieldError
+	var invalid InvalidFields
+	if errors.As(p, &invalid) {
+		fields = invalid.InvalidFields()
+	}
+
+	body, _ := json.Marshal(Details{
+		Type:      TypePrefix + string(p.Code),
+		Title:     info.title,
+		Status:    info.status,
+		Detail:    p.Detail,
+		Instance:  r.URL.Path,
+		Code:      p.Code,
+		Errors:    fields,
+		RequestID: w.Header().Get("X-Request-ID"),
+	})
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(info.status)
+	w.Write(body)
+}
@@ -0,0 +1,128 @@
+package problem
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fieldErrors stands in for the errors of package validate.
+type fieldErrors []FieldError
+
+func (e fieldErrors) Error() string               { return "invalid fields" }
+func (e fieldErrors) InvalidFields() []FieldError { return e }
+
+func TestFrom(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{"problem", New(Forbidden, "no"), Forbidden},
+		{"wrapped problem", fmt.Errorf("handler: %w", New(Conflict, "taken")), Conflict},
+		{"no rows", fmt.Errorf("get user: %w", sql.ErrNoRows), NotFound},
+		{"field errors", fieldErrors{{Field: "email", Message: "is required"}}, ValidationFailed},
+		{"unknown", errors.New("boom"), Internal},
+		{"deadline", context.DeadlineExceeded, Unavailable},
+		{"internal after deadline", Wrap(Internal, fmt.Errorf("query: %w", context.DeadlineExceeded), "couldn't list chirps"), Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CodeOf(tt.err); got != tt.want {
+				t.Errorf("CodeOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	errTeapot := errors.New("short and stout")
+	Register(func(err error) *Error {
+		if errors.Is(err, errTeapot) {
+			return Wrap(Conflict, err, "I'm a teapot")
+		}
+		return nil
+	})
+
+	if got := CodeOf(fmt.Errorf("brew: %w", errTeapot)); got != Conflict {
+		t.Errorf("CodeOf(registered error) = %q, want %q", got, Conflict)
+	}
+	if got := CodeOf(errors.New("boom")); got != Internal {
+		t.Errorf("CodeOf(unknown) = %q, want %q", got, Internal)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/chirps/123", nil)
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Request-ID", "req-1")
+	Write(w, r, Wrap(NotFound, errors.New("pq: secret table detail"), "chirp not found"))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+	}
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("response leaked the cause: %s", w.Body)
+	}
+
+	var got Details
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := Details{
+		Type:      TypePrefix + "not_found",
+		Title:     "Not found",
+		Status:    http.StatusNotFound,
+		Detail:    "chirp not found",
+		Instance:  "/api/chirps/123",
+		Code:      NotFound,
+		RequestID: "req-1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("body = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteListsFieldErrors(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/users", nil)
+	w := httptest.NewRecorder()
+	fields := fieldErrors{
+		{Field: "email", Message: "must be a valid email address"},
+		{Field: "password", Message: "is required"},
+	}
+	Write(w, r, fmt.Errorf("decoding signup: %w", fields))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+	var got Details
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != ValidationFailed || !reflect.DeepEqual(got.Errors, []FieldError(fields)) {
+		t.Errorf("body = %+v, want validation_failed with %+v", got, fields)
+	}
+}
+
+func TestWriteHidesUnknownErrors(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/users", nil)
+	w := httptest.NewRecorder()
+	Write(w, r, errors.New("dial tcp 10.0.0.5:5432: connection refused"))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "10.0.0.5") {
+		t.Errorf("response leaked the cause: %s", w.Body)
+	}
+}
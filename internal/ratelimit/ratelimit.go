@@ -0,0 +1,134 @@
+// Package ratelimit implements token bucket rate limiting. Buckets live in
+// a Store, so a store shared between replicas can replace the in-memory one
+// without changing callers.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Per on average, in bursts of up to Requests.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// rate is the refill rate in tokens per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed bool
+	// Limit is the bucket size and Remaining the whole tokens left in it.
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again, and RetryAfter how
+	// long until the next token is available; zero if Allowed.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store holds token buckets by key.
+type Store interface {
+	// Take removes a token from the bucket for key, creating a full one if
+	// there is none, and reports whether there was a token to take.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// bucket is a token bucket as of last.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills b up to now and tries to remove a token.
+func (b *bucket) take(limit Limit, now time.Time) Result {
+	rate := limit.rate()
+	burst := float64(limit.Requests)
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((burst - b.tokens) / rate)
+	return res
+}
+
+// full reports whether b will have refilled completely by now, at which
+// point it is no different from a bucket that doesn't exist.
+func (b *bucket) full(limit Limit, now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*limit.rate() >= float64(limit.Requests)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// sweepInterval is how often Memory forgets buckets that have refilled.
+const sweepInterval = time.Minute
+
+// Memory is a Store for a single process.
+type Memory struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	limits    map[string]Limit
+	lastSweep time.Time
+}
+
+// NewMemory returns an empty in-memory Store.
+func NewMemory() *Memory {
+	return &Memory{
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+		limits:  map[string]Limit{},
+	}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), last: now}
+		m.buckets[key] = b
+	}
+	m.limits[key] = limit
+	return b.take(limit, now), nil
+}
+
+// sweep drops full buckets so idle clients don't use memory forever.
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if b.full(m.limits[key], now) {
+			delete(m.buckets, key)
+			delete(m.limits, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+// Len returns the number of buckets held.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.buckets)
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestMemory() (*Memory, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := NewMemory()
+	m.now = clock.now
+	return m, clock
+}
+
+func TestMemoryBurstThenRefill(t *testing.T) {
+	m, clock := newTestMemory()
+	limit := Limit{Requests: 3, Per: 3 * time.Second}
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		res, _ := m.Take(ctx, "alice", limit)
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("take %d: %+v, want allowed with %d remaining", 3-i, res, i)
+		}
+	}
+
+	res, _ := m.Take(ctx, "alice", limit)
+	if res.Allowed {
+		t.Fatalf("fourth take allowed: %+v", res)
+	}
+	if res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Errorf("RetryAfter = %v, Reset = %v, want 1s and 3s", res.RetryAfter, res.Reset)
+	}
+
+	clock.advance(time.Second)
+	if res, _ := m.Take(ctx, "alice", limit); !res.Allowed {
+		t.Errorf("take after refill: %+v, want allowed", res)
+	}
+}
+
+func TestMemoryKeysAreIndependent(t *testing.T) {
+	m, _ := newTestMemory()
+	limit := Limit{Requests: 1, Per: time.Minute}
+	ctx := context.Background()
+
+	m.Take(ctx, "alice", limit)
+	if res, _ := m.Take(ctx, "alice", limit); res.Allowed {
+		t.Error("alice's second request allowed")
+	}
+	if res, _ := m.Take(ctx, "bob", limit); !res.Allowed {
+		t.Error("bob limited by alice's bucket")
+	}
+}
+
+func TestMemorySweepsFullBuckets(t *testing.T) {
+	m, clock := newTestMemory()
+	ctx := context.Background()
+
+	m.Take(ctx, "short", Limit{Requests: 1, Per: time.Second})
+	m.Take(ctx, "long", Limit{Requests: 1, Per: time.Hour})
+	clock.advance(sweepInterval)
+	m.Take(ctx, "other", Limit{Requests: 1, Per: time.Second})
+
+	// short has refilled and is forgotten; long is still draining.
+	if got := m.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+}
@@ -0,0 +1,421 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/jobs"
+)
+
+// ErrConstraint is returned by Memory where Postgres would report a unique,
+// foreign key or check constraint violation.
+var ErrConstraint = errors.New("store: constraint violation")
+
+type relationship struct {
+	from, to uuid.UUID
+}
+
+// Memory is a thread-safe in-process Store. The zero value is not usable;
+// call NewMemory.
+type Memory struct {
+	mu     sync.RWMutex
+	users  map[uuid.UUID]database.User
+	chirps []database.Chirp // in creation order
+	tokens map[string]database.RefreshToken
+	blocks map[relationship]bool
+	mutes  map[relationship]bool
+}
+
+var _ Store = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:  map[uuid.UUID]database.User{},
+		tokens: map[string]database.RefreshToken{},
+		blocks: map[relationship]bool{},
+		mutes:  map[relationship]bool{},
+	}
+}
+
+// InTx runs fn against m itself, with a nil exec. If fn fails, m is put
+// back as it was before fn ran, undoing any writes made meanwhile by
+// others too; that is good enough for tests.
+func (m *Memory) InTx(ctx context.Context, fn func(tx Store, exec jobs.Execer) error) error {
+	m.mu.RLock()
+	users, chirps, tokens := maps.Clone(m.users), slices.Clone(m.chirps), maps.Clone(m.tokens)
+	blocks, mutes := maps.Clone(m.blocks), maps.Clone(m.mutes)
+	m.mu.RUnlock()
+
+	if err := fn(m, nil); err != nil {
+		m.mu.Lock()
+		m.users, m.chirps, m.tokens = users, chirps, tokens
+		m.blocks, m.mutes = blocks, mutes
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(arg.Email, uuid.Nil) {
+		return database.User{}, fmt.Errorf("%w: email %s already exists", ErrConstraint, arg.Email)
+	}
+	t := now()
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      t,
+		UpdatedAt:      t,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Role:           "user",
+	}
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) emailTaken(email string, except uuid.UUID) bool {
+	for _, u := range m.users {
+		if u.Email == email && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) GetUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+// updateUser applies fn to the stored user and returns the result.
+func (m *Memory) updateUser(id uuid.UUID, touch bool, fn func(*database.User) error) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	if err := fn(&user); err != nil {
+		return database.User{}, err
+	}
+	if touch {
+		user.UpdatedAt = now()
+	}
+	m.users[id] = user
+	return user, nil
+}
+
+func (m *Memory) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	return m.updateUser(arg.ID, true, func(u *database.User) error {
+		if m.emailTaken(arg.Email, arg.ID) {
+			return fmt.Errorf("%w: email %s already exists", ErrConstraint, arg.Email)
+		}
+		u.Email = arg.Email
+		u.HashedPassword = arg.HashedPassword
+		return nil
+	})
+}
+
+func (m *Memory) UpdateUserAvatar(ctx context.Context, arg database.UpdateUserAvatarParams) (database.User, error) {
+	return m.updateUser(arg.ID, true, func(u *database.User) error {
+		u.AvatarKey = arg.AvatarKey
+		return nil
+	})
+}
+
+func (m *Memory) UpdateUserBanner(ctx context.Context, arg database.UpdateUserBannerParams) (database.User, error) {
+	return m.updateUser(arg.ID, true, func(u *database.User) error {
+		u.BannerKey = arg.BannerKey
+		return nil
+	})
+}
+
+var validRoles = []string{"user", "moderator", "admin"}
+
+func (m *Memory) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (database.User, error) {
+	return m.updateUser(arg.ID, true, func(u *database.User) error {
+		if !slices.Contains(validRoles, arg.Role) {
+			return fmt.Errorf("%w: invalid role %q", ErrConstraint, arg.Role)
+		}
+		u.Role = arg.Role
+		u.RoleUpdatedAt = arg.RoleUpdatedAt
+		return nil
+	})
+}
+
+func (m *Memory) SuspendUser(ctx context.Context, arg database.SuspendUserParams) (database.User, error) {
+	return m.updateUser(arg.ID, true, func(u *database.User) error {
+		u.SuspendedUntil = arg.SuspendedUntil
+		return nil
+	})
+}
+
+func (m *Memory) BanUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return m.updateUser(id, true, func(u *database.User) error {
+		u.BannedAt = sql.NullTime{Time: now(), Valid: true}
+		return nil
+	})
+}
+
+func (m *Memory) UpgradeUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	// like the SQL, upgrading leaves updated_at alone
+	return m.updateUser(id, false, func(u *database.User) error {
+		u.IsChirpyRed = true
+		return nil
+	})
+}
+
+func (m *Memory) DeleteUsers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clear(m.users)
+	clear(m.tokens)
+	clear(m.blocks)
+	clear(m.mutes)
+	m.chirps = nil
+	return nil
+}
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.Chirp{}, fmt.Errorf("%w: no user %s", ErrConstraint, arg.UserID)
+	}
+	t := now()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+	}
+	m.chirps = append(m.chirps, chirp)
+	return chirp, nil
+}
+
+func (m *Memory) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, c := range m.chirps {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetChirps(ctx context.Context, viewerID uuid.UUID) ([]database.Chirp, error) {
+	return m.listChirps(viewerID, func(database.Chirp) bool { return true }), nil
+}
+
+func (m *Memory) GetChirpsByAuthor(ctx context.Context, arg database.GetChirpsByAuthorParams) ([]database.Chirp, error) {
+	return m.listChirps(arg.ViewerID, func(c database.Chirp) bool { return c.UserID == arg.UserID }), nil
+}
+
+func (m *Memory) listChirps(viewerID uuid.UUID, keep func(database.Chirp) bool) []database.Chirp {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	chirps := []database.Chirp{}
+	for _, c := range m.chirps {
+		hidden := relationship{from: viewerID, to: c.UserID}
+		if keep(c) && !m.blocks[hidden] && !m.mutes[hidden] {
+			chirps = append(chirps, c)
+		}
+	}
+	return chirps
+}
+
+func (m *Memory) DeleteChirp(ctx context.Context, arg database.DeleteChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.chirps, func(c database.Chirp) bool {
+		return c.ID == arg.ID && c.UserID == arg.UserID
+	})
+	if i < 0 {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	chirp := m.chirps[i]
+	m.chirps = slices.Delete(m.chirps, i, i+1)
+	return chirp, nil
+}
+
+func (m *Memory) RemoveChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.chirps)
+	m.chirps = slices.DeleteFunc(m.chirps, func(c database.Chirp) bool { return c.ID == id })
+	return int64(before - len(m.chirps)), nil
+}
+
+func (m *Memory) relate(set map[relationship]bool, from, to uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if from == to {
+		return fmt.Errorf("%w: a user can't block or mute themselves", ErrConstraint)
+	}
+	for _, id := range []uuid.UUID{from, to} {
+		if _, ok := m.users[id]; !ok {
+			return fmt.Errorf("%w: no user %s", ErrConstraint, id)
+		}
+	}
+	set[relationship{from: from, to: to}] = true
+	return nil
+}
+
+func (m *Memory) unrelate(set map[relationship]bool, from, to uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(set, relationship{from: from, to: to})
+	return nil
+}
+
+func (m *Memory) BlockUser(ctx context.Context, arg database.BlockUserParams) error {
+	return m.relate(m.blocks, arg.BlockerID, arg.BlockedID)
+}
+
+func (m *Memory) UnblockUser(ctx context.Context, arg database.UnblockUserParams) error {
+	return m.unrelate(m.blocks, arg.BlockerID, arg.BlockedID)
+}
+
+func (m *Memory) IsBlocked(ctx context.Context, arg database.IsBlockedParams) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.blocks[relationship{from: arg.BlockerID, to: arg.BlockedID}], nil
+}
+
+func (m *Memory) MuteUser(ctx context.Context, arg database.MuteUserParams) error {
+	return m.relate(m.mutes, arg.MuterID, arg.MutedID)
+}
+
+func (m *Memory) UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error {
+	return m.unrelate(m.mutes, arg.MuterID, arg.MutedID)
+}
+
+func (m *Memory) ListHiddenUsers(ctx context.Context, viewerID uuid.UUID) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var hidden []uuid.UUID
+	for _, set := range []map[relationship]bool{m.blocks, m.mutes} {
+		for rel := range set {
+			if rel.from == viewerID && !slices.Contains(hidden, rel.to) {
+				hidden = append(hidden, rel.to)
+			}
+		}
+	}
+	return hidden, nil
+}
+
+func (m *Memory) CreateToken(ctx context.Context, arg database.CreateTokenParams) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.RefreshToken{}, fmt.Errorf("%w: no user %s", ErrConstraint, arg.UserID)
+	}
+	if _, ok := m.tokens[arg.Token]; ok {
+		return database.RefreshToken{}, fmt.Errorf("%w: duplicate refresh token", ErrConstraint)
+	}
+	t := now()
+	token := database.RefreshToken{
+		Token:     arg.Token,
+		CreatedAt: t,
+		UpdatedAt: t,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt.UTC().Truncate(time.Microsecond),
+	}
+	m.tokens[token.Token] = token
+	return token, nil
+}
+
+func (m *Memory) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.tokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+func (m *Memory) GetUserFromRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	t, err := m.GetRefreshToken(ctx, token)
+	if err != nil {
+		return t, err
+	}
+	if t.RevokedAt.Valid || !t.ExpiresAt.After(now()) {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+func (m *Memory) RevokeToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	revoked := now()
+	t.RevokedAt = sql.NullTime{Time: revoked, Valid: true}
+	t.UpdatedAt = revoked
+	m.tokens[token] = t
+	return t, nil
+}
+
+func (m *Memory) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	revoked := now()
+	for k, t := range m.tokens {
+		if t.UserID == userID && !t.RevokedAt.Valid {
+			t.RevokedAt = sql.NullTime{Time: revoked, Valid: true}
+			t.UpdatedAt = revoked
+			m.tokens[k] = t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/jobs"
+)
+
+// Postgres is the Store in a Postgres database: the sqlc queries, which
+// also serve the features the other stores lack, and transactions.
+type Postgres struct {
+	*database.Queries
+	db *sql.DB
+	// tx is set on the Store InTx hands to its function.
+	tx *sql.Tx
+}
+
+var _ Store = (*Postgres)(nil)
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{Queries: database.New(db), db: db}
+}
+
+func (p *Postgres) InTx(ctx context.Context, fn func(tx Store, exec jobs.Execer) error) error {
+	if p.tx != nil {
+		return fn(p, p.tx)
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(&Postgres{Queries: p.Queries.WithTx(tx), db: p.db, tx: tx}, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
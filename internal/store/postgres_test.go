@@ -0,0 +1,47 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jwoodsiii/chirpy/internal/migrate"
+	"github.com/jwoodsiii/chirpy/internal/store"
+	"github.com/jwoodsiii/chirpy/internal/store/storetest"
+	"github.com/jwoodsiii/chirpy/sql/schema"
+	_ "github.com/lib/pq"
+)
+
+// TestPostgres runs the store conformance suite against the database
+// in CHIRPY_TEST_DB_URL. Every table is wiped, so never point it at real
+// data.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dsn == "" || strings.HasPrefix(dsn, "sqlite:") {
+		t.Skip("CHIRPY_TEST_DB_URL not set to a Postgres database")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migrate.New(db, migrate.Postgres, schema.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s := store.NewPostgres(db)
+		if err := s.DeleteUsers(context.Background()); err != nil {
+			t.Fatalf("DeleteUsers() error = %v", err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,308 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/jobs"
+	"github.com/jwoodsiii/chirpy/internal/sqlitedb"
+)
+
+// SQLite is the Store for single-binary deployments. SQLite has no UUID
+// generator and no timestamp type, so IDs and times are produced here and
+// times are kept as Unix microseconds; rows are converted to the Postgres
+// models on the way out.
+type SQLite struct {
+	q  *sqlitedb.Queries
+	db *sql.DB
+	// tx is set on the Store InTx hands to its function.
+	tx *sql.Tx
+}
+
+var _ Store = (*SQLite)(nil)
+
+func NewSQLite(db *sql.DB) *SQLite {
+	return &SQLite{q: sqlitedb.New(db), db: db}
+}
+
+func (s *SQLite) InTx(ctx context.Context, fn func(tx Store, exec jobs.Execer) error) error {
+	if s.tx != nil {
+		return fn(s, s.tx)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(&SQLite{q: s.q.WithTx(tx), db: s.db, tx: tx}, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func fromMicros(us int64) time.Time {
+	return time.UnixMicro(us).UTC()
+}
+
+func fromNullMicros(us sql.NullInt64) sql.NullTime {
+	if !us.Valid {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: fromMicros(us.Int64), Valid: true}
+}
+
+func toNullMicros(t sql.NullTime) sql.NullInt64 {
+	if !t.Valid {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Time.UnixMicro(), Valid: true}
+}
+
+func sqliteUser(u sqlitedb.User, err error) (database.User, error) {
+	if err != nil {
+		return database.User{}, err
+	}
+	return database.User{
+		ID:             u.ID,
+		CreatedAt:      fromMicros(u.CreatedAt),
+		UpdatedAt:      fromMicros(u.UpdatedAt),
+		Email:          u.Email,
+		HashedPassword: u.HashedPassword,
+		IsChirpyRed:    u.IsChirpyRed,
+		AvatarKey:      u.AvatarKey,
+		BannerKey:      u.BannerKey,
+		Role:           u.Role,
+		SuspendedUntil: fromNullMicros(u.SuspendedUntil),
+		BannedAt:       fromNullMicros(u.BannedAt),
+		RoleUpdatedAt:  fromNullMicros(u.RoleUpdatedAt),
+	}, nil
+}
+
+func sqliteChirp(c sqlitedb.Chirp) database.Chirp {
+	return database.Chirp{
+		ID:        c.ID,
+		CreatedAt: fromMicros(c.CreatedAt),
+		UpdatedAt: fromMicros(c.UpdatedAt),
+		Body:      c.Body,
+		UserID:    c.UserID,
+	}
+}
+
+func sqliteChirps(rows []sqlitedb.Chirp, err error) ([]database.Chirp, error) {
+	if err != nil {
+		return nil, err
+	}
+	chirps := make([]database.Chirp, len(rows))
+	for i, c := range rows {
+		chirps[i] = sqliteChirp(c)
+	}
+	return chirps, nil
+}
+
+func sqliteToken(t sqlitedb.RefreshToken, err error) (database.RefreshToken, error) {
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+	return database.RefreshToken{
+		Token:     t.Token,
+		CreatedAt: fromMicros(t.CreatedAt),
+		UpdatedAt: fromMicros(t.UpdatedAt),
+		UserID:    t.UserID,
+		ExpiresAt: fromMicros(t.ExpiresAt),
+		RevokedAt: fromNullMicros(t.RevokedAt),
+	}, nil
+}
+
+func (s *SQLite) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	t := now().UnixMicro()
+	return sqliteUser(s.q.CreateUser(ctx, sqlitedb.CreateUserParams{
+		ID:             uuid.New(),
+		CreatedAt:      t,
+		UpdatedAt:      t,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+	}))
+}
+
+func (s *SQLite) GetUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return sqliteUser(s.q.GetUser(ctx, id))
+}
+
+func (s *SQLite) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	return sqliteUser(s.q.GetUserByEmail(ctx, email))
+}
+
+func (s *SQLite) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	return sqliteUser(s.q.UpdateUser(ctx, sqlitedb.UpdateUserParams{
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		UpdatedAt:      now().UnixMicro(),
+		ID:             arg.ID,
+	}))
+}
+
+func (s *SQLite) UpdateUserAvatar(ctx context.Context, arg database.UpdateUserAvatarParams) (database.User, error) {
+	return sqliteUser(s.q.UpdateUserAvatar(ctx, sqlitedb.UpdateUserAvatarParams{
+		AvatarKey: arg.AvatarKey,
+		UpdatedAt: now().UnixMicro(),
+		ID:        arg.ID,
+	}))
+}
+
+func (s *SQLite) UpdateUserBanner(ctx context.Context, arg database.UpdateUserBannerParams) (database.User, error) {
+	return sqliteUser(s.q.UpdateUserBanner(ctx, sqlitedb.UpdateUserBannerParams{
+		BannerKey: arg.BannerKey,
+		UpdatedAt: now().UnixMicro(),
+		ID:        arg.ID,
+	}))
+}
+
+func (s *SQLite) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (database.User, error) {
+	return sqliteUser(s.q.SetUserRole(ctx, sqlitedb.SetUserRoleParams{
+		Role:          arg.Role,
+		RoleUpdatedAt: toNullMicros(arg.RoleUpdatedAt),
+		UpdatedAt:     now().UnixMicro(),
+		ID:            arg.ID,
+	}))
+}
+
+func (s *SQLite) SuspendUser(ctx context.Context, arg database.SuspendUserParams) (database.User, error) {
+	return sqliteUser(s.q.SuspendUser(ctx, sqlitedb.SuspendUserParams{
+		SuspendedUntil: toNullMicros(arg.SuspendedUntil),
+		UpdatedAt:      now().UnixMicro(),
+		ID:             arg.ID,
+	}))
+}
+
+func (s *SQLite) BanUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return sqliteUser(s.q.BanUser(ctx, sqlitedb.BanUserParams{
+		Now: now().UnixMicro(),
+		ID:  id,
+	}))
+}
+
+func (s *SQLite) UpgradeUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return sqliteUser(s.q.UpgradeUser(ctx, id))
+}
+
+func (s *SQLite) DeleteUsers(ctx context.Context) error {
+	return s.q.DeleteUsers(ctx)
+}
+
+func (s *SQLite) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	t := now().UnixMicro()
+	c, err := s.q.CreateChirp(ctx, sqlitedb.CreateChirpParams{
+		ID:        uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+	})
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return sqliteChirp(c), nil
+}
+
+func (s *SQLite) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	c, err := s.q.GetChirp(ctx, id)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return sqliteChirp(c), nil
+}
+
+func (s *SQLite) GetChirps(ctx context.Context, viewerID uuid.UUID) ([]database.Chirp, error) {
+	return sqliteChirps(s.q.GetChirps(ctx, viewerID))
+}
+
+func (s *SQLite) GetChirpsByAuthor(ctx context.Context, arg database.GetChirpsByAuthorParams) ([]database.Chirp, error) {
+	return sqliteChirps(s.q.GetChirpsByAuthor(ctx, sqlitedb.GetChirpsByAuthorParams{
+		UserID:   arg.UserID,
+		ViewerID: arg.ViewerID,
+	}))
+}
+
+func (s *SQLite) DeleteChirp(ctx context.Context, arg database.DeleteChirpParams) (database.Chirp, error) {
+	c, err := s.q.DeleteChirp(ctx, sqlitedb.DeleteChirpParams{ID: arg.ID, UserID: arg.UserID})
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return sqliteChirp(c), nil
+}
+
+func (s *SQLite) RemoveChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.RemoveChirp(ctx, id)
+}
+
+func (s *SQLite) BlockUser(ctx context.Context, arg database.BlockUserParams) error {
+	return s.q.BlockUser(ctx, sqlitedb.BlockUserParams{
+		BlockerID: arg.BlockerID,
+		BlockedID: arg.BlockedID,
+		CreatedAt: now().UnixMicro(),
+	})
+}
+
+func (s *SQLite) UnblockUser(ctx context.Context, arg database.UnblockUserParams) error {
+	return s.q.UnblockUser(ctx, sqlitedb.UnblockUserParams{BlockerID: arg.BlockerID, BlockedID: arg.BlockedID})
+}
+
+func (s *SQLite) IsBlocked(ctx context.Context, arg database.IsBlockedParams) (bool, error) {
+	n, err := s.q.IsBlocked(ctx, sqlitedb.IsBlockedParams{BlockerID: arg.BlockerID, BlockedID: arg.BlockedID})
+	return n > 0, err
+}
+
+func (s *SQLite) MuteUser(ctx context.Context, arg database.MuteUserParams) error {
+	return s.q.MuteUser(ctx, sqlitedb.MuteUserParams{
+		MuterID:   arg.MuterID,
+		MutedID:   arg.MutedID,
+		CreatedAt: now().UnixMicro(),
+	})
+}
+
+func (s *SQLite) UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error {
+	return s.q.UnmuteUser(ctx, sqlitedb.UnmuteUserParams{MuterID: arg.MuterID, MutedID: arg.MutedID})
+}
+
+func (s *SQLite) ListHiddenUsers(ctx context.Context, viewerID uuid.UUID) ([]uuid.UUID, error) {
+	return s.q.ListHiddenUsers(ctx, viewerID)
+}
+
+func (s *SQLite) CreateToken(ctx context.Context, arg database.CreateTokenParams) (database.RefreshToken, error) {
+	t := now().UnixMicro()
+	return sqliteToken(s.q.CreateToken(ctx, sqlitedb.CreateTokenParams{
+		Token:     arg.Token,
+		CreatedAt: t,
+		UpdatedAt: t,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt.UnixMicro(),
+	}))
+}
+
+func (s *SQLite) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	return sqliteToken(s.q.GetRefreshToken(ctx, token))
+}
+
+func (s *SQLite) GetUserFromRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	return sqliteToken(s.q.GetUserFromRefreshToken(ctx, sqlitedb.GetUserFromRefreshTokenParams{
+		Token: token,
+		Now:   now().UnixMicro(),
+	}))
+}
+
+func (s *SQLite) RevokeToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	return sqliteToken(s.q.RevokeToken(ctx, sqlitedb.RevokeTokenParams{
+		Now:   now().UnixMicro(),
+		Token: token,
+	}))
+}
+
+func (s *SQLite) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	return s.q.RevokeUserTokens(ctx, sqlitedb.RevokeUserTokensParams{
+		Now:    now().UnixMicro(),
+		UserID: userID,
+	})
+}
@@ -0,0 +1,34 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/jwoodsiii/chirpy/internal/migrate"
+	"github.com/jwoodsiii/chirpy/internal/store"
+	"github.com/jwoodsiii/chirpy/internal/store/storetest"
+	sqliteschema "github.com/jwoodsiii/chirpy/sql/sqlite/schema"
+	_ "modernc.org/sqlite"
+)
+
+func TestSQLite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		dsn := "file:" + filepath.Join(t.TempDir(), "chirpy.db") + "?_pragma=foreign_keys(1)"
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		m, err := migrate.New(db, migrate.SQLite, sqliteschema.FS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Up(context.Background()); err != nil {
+			t.Fatalf("migrating test database: %v", err)
+		}
+		return store.NewSQLite(db)
+	})
+}
@@ -0,0 +1,100 @@
+// Package store defines the persistence interface the HTTP handlers use for
+// users, chirps, refresh tokens and Chirpy Red subscriptions. Postgres is
+// the main implementation, SQLite serves single-binary deployments and
+// Memory keeps everything in process for tests. All of them must pass the
+// suite in package storetest.
+//
+// The interface reuses the sqlc generated models and parameter types so
+// *database.Queries implements Queries without an adapter; Postgres only
+// adds transactions to it. Lookups that find nothing return
+// sql.ErrNoRows, as database/sql does.
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/jobs"
+)
+
+type Users interface {
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error)
+	GetUser(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error)
+	UpdateUserAvatar(ctx context.Context, arg database.UpdateUserAvatarParams) (database.User, error)
+	UpdateUserBanner(ctx context.Context, arg database.UpdateUserBannerParams) (database.User, error)
+	SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (database.User, error)
+	SuspendUser(ctx context.Context, arg database.SuspendUserParams) (database.User, error)
+	BanUser(ctx context.Context, id uuid.UUID) (database.User, error)
+	// DeleteUsers removes every user along with everything they own.
+	DeleteUsers(ctx context.Context) error
+}
+
+// Subscriptions covers Chirpy Red, granted by the Polka webhook.
+type Subscriptions interface {
+	UpgradeUser(ctx context.Context, id uuid.UUID) (database.User, error)
+}
+
+// Chirps lists chirps oldest first, hiding authors the viewer has blocked
+// or muted. A uuid.Nil viewer sees everything.
+type Chirps interface {
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	GetChirps(ctx context.Context, viewerID uuid.UUID) ([]database.Chirp, error)
+	GetChirpsByAuthor(ctx context.Context, arg database.GetChirpsByAuthorParams) ([]database.Chirp, error)
+	// DeleteChirp only deletes the chirp if arg.UserID wrote it.
+	DeleteChirp(ctx context.Context, arg database.DeleteChirpParams) (database.Chirp, error)
+	RemoveChirp(ctx context.Context, id uuid.UUID) (int64, error)
+}
+
+// Relationships are the blocks and mutes that filter chirp listings.
+// Adding an existing relationship or removing a missing one is not an
+// error.
+type Relationships interface {
+	BlockUser(ctx context.Context, arg database.BlockUserParams) error
+	UnblockUser(ctx context.Context, arg database.UnblockUserParams) error
+	IsBlocked(ctx context.Context, arg database.IsBlockedParams) (bool, error)
+	MuteUser(ctx context.Context, arg database.MuteUserParams) error
+	UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error
+	// ListHiddenUsers returns the users viewerID has blocked or muted.
+	ListHiddenUsers(ctx context.Context, viewerID uuid.UUID) ([]uuid.UUID, error)
+}
+
+type RefreshTokens interface {
+	CreateToken(ctx context.Context, arg database.CreateTokenParams) (database.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	// GetUserFromRefreshToken only finds tokens that are neither expired
+	// nor revoked.
+	GetUserFromRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	RevokeToken(ctx context.Context, token string) (database.RefreshToken, error)
+	RevokeUserTokens(ctx context.Context, userID uuid.UUID) error
+}
+
+// Queries are the reads and writes a Store offers.
+type Queries interface {
+	Users
+	Subscriptions
+	Chirps
+	Relationships
+	RefreshTokens
+}
+
+var _ Queries = (*database.Queries)(nil)
+
+type Store interface {
+	Queries
+	// InTx runs fn in a transaction, committing its writes through tx if
+	// it returns nil and rolling them back otherwise. exec is the same
+	// transaction, for writes outside the Store such as queued jobs; it
+	// is nil for stores that aren't in a SQL database. Calling InTx on tx
+	// runs within the transaction already open.
+	InTx(ctx context.Context, fn func(tx Store, exec jobs.Execer) error) error
+}
+
+// now matches the precision Postgres stores timestamps with.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
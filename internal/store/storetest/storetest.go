@@ -0,0 +1,423 @@
+// Package storetest is the conformance suite every store.Store
+// implementation must pass, so the in-memory store used by handler tests
+// behaves like Postgres.
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/jobs"
+	"github.com/jwoodsiii/chirpy/internal/store"
+)
+
+// Run runs the suite. newStore must return an empty store; it is called
+// once per subtest.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store)
+	}{
+		{"Users", testUsers},
+		{"UserModeration", testUserModeration},
+		{"Subscriptions", testSubscriptions},
+		{"Chirps", testChirps},
+		{"Relationships", testRelationships},
+		{"RefreshTokens", testRefreshTokens},
+		{"DeleteUsers", testDeleteUsers},
+		{"Transactions", testTransactions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func createUser(t *testing.T, s store.Store, email string) database.User {
+	t.Helper()
+	user, err := s.CreateUser(context.Background(), database.CreateUserParams{Email: email, HashedPassword: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser(%s) error = %v", email, err)
+	}
+	return user
+}
+
+func createChirp(t *testing.T, s store.Store, userID uuid.UUID, body string) database.Chirp {
+	t.Helper()
+	chirp, err := s.CreateChirp(context.Background(), database.CreateChirpParams{Body: body, UserID: userID})
+	if err != nil {
+		t.Fatalf("CreateChirp() error = %v", err)
+	}
+	return chirp
+}
+
+func wantNoRows(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("%s error = %v, want sql.ErrNoRows", what, err)
+	}
+}
+
+func chirpBodies(chirps []database.Chirp) []string {
+	bodies := make([]string, len(chirps))
+	for i, c := range chirps {
+		bodies[i] = c.Body
+	}
+	return bodies
+}
+
+func testUsers(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	user := createUser(t, s, "saul@bettercall.com")
+	if user.ID == uuid.Nil || user.CreatedAt.IsZero() {
+		t.Errorf("CreateUser() = %+v, want an ID and timestamps", user)
+	}
+	if user.Role != "user" || user.IsChirpyRed || user.AvatarKey.Valid || user.BannedAt.Valid {
+		t.Errorf("CreateUser() = %+v, want defaults", user)
+	}
+
+	if _, err := s.CreateUser(ctx, database.CreateUserParams{Email: user.Email, HashedPassword: "x"}); err == nil {
+		t.Error("CreateUser() with a duplicate email succeeded")
+	}
+
+	got, err := s.GetUser(ctx, user.ID)
+	if err != nil || got.Email != user.Email {
+		t.Errorf("GetUser() = %+v, %v", got, err)
+	}
+	got, err = s.GetUserByEmail(ctx, user.Email)
+	if err != nil || got.ID != user.ID {
+		t.Errorf("GetUserByEmail() = %+v, %v", got, err)
+	}
+
+	_, err = s.GetUser(ctx, uuid.New())
+	wantNoRows(t, "GetUser(unknown)", err)
+	_, err = s.GetUserByEmail(ctx, "nobody@example.com")
+	wantNoRows(t, "GetUserByEmail(unknown)", err)
+
+	updated, err := s.UpdateUser(ctx, database.UpdateUserParams{ID: user.ID, Email: "jimmy@bettercall.com", HashedPassword: "new"})
+	if err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if updated.Email != "jimmy@bettercall.com" || updated.HashedPassword != "new" {
+		t.Errorf("UpdateUser() = %+v", updated)
+	}
+	if updated.UpdatedAt.Before(user.UpdatedAt) {
+		t.Errorf("UpdateUser() moved updated_at backwards")
+	}
+
+	other := createUser(t, s, "kim@wexlermcgill.com")
+	if _, err := s.UpdateUser(ctx, database.UpdateUserParams{ID: other.ID, Email: updated.Email, HashedPassword: "x"}); err == nil {
+		t.Error("UpdateUser() to a taken email succeeded")
+	}
+	_, err = s.UpdateUser(ctx, database.UpdateUserParams{ID: uuid.New(), Email: "ghost@example.com", HashedPassword: "x"})
+	wantNoRows(t, "UpdateUser(unknown)", err)
+
+	withAvatar, err := s.UpdateUserAvatar(ctx, database.UpdateUserAvatarParams{ID: user.ID, AvatarKey: sql.NullString{String: "avatars/a", Valid: true}})
+	if err != nil || withAvatar.AvatarKey.String != "avatars/a" {
+		t.Errorf("UpdateUserAvatar() = %+v, %v", withAvatar, err)
+	}
+	withBanner, err := s.UpdateUserBanner(ctx, database.UpdateUserBannerParams{ID: user.ID, BannerKey: sql.NullString{String: "banners/b", Valid: true}})
+	if err != nil || withBanner.BannerKey.String != "banners/b" || withBanner.AvatarKey.String != "avatars/a" {
+		t.Errorf("UpdateUserBanner() = %+v, %v", withBanner, err)
+	}
+}
+
+func testUserModeration(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "nacho@example.com")
+
+	changedAt := time.Now().UTC().Truncate(time.Second)
+	promoted, err := s.SetUserRole(ctx, database.SetUserRoleParams{
+		ID:            user.ID,
+		Role:          "moderator",
+		RoleUpdatedAt: sql.NullTime{Time: changedAt, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("SetUserRole() error = %v", err)
+	}
+	if promoted.Role != "moderator" || !promoted.RoleUpdatedAt.Time.Equal(changedAt) {
+		t.Errorf("SetUserRole() = %+v", promoted)
+	}
+	if _, err := s.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: "overlord"}); err == nil {
+		t.Error("SetUserRole() accepted an invalid role")
+	}
+
+	until := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second)
+	suspended, err := s.SuspendUser(ctx, database.SuspendUserParams{ID: user.ID, SuspendedUntil: sql.NullTime{Time: until, Valid: true}})
+	if err != nil || !suspended.SuspendedUntil.Time.Equal(until) {
+		t.Errorf("SuspendUser() = %+v, %v", suspended, err)
+	}
+
+	banned, err := s.BanUser(ctx, user.ID)
+	if err != nil || !banned.BannedAt.Valid {
+		t.Errorf("BanUser() = %+v, %v", banned, err)
+	}
+	_, err = s.BanUser(ctx, uuid.New())
+	wantNoRows(t, "BanUser(unknown)", err)
+}
+
+func testSubscriptions(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "lalo@example.com")
+
+	upgraded, err := s.UpgradeUser(ctx, user.ID)
+	if err != nil || !upgraded.IsChirpyRed {
+		t.Errorf("UpgradeUser() = %+v, %v", upgraded, err)
+	}
+	got, err := s.GetUser(ctx, user.ID)
+	if err != nil || !got.IsChirpyRed {
+		t.Errorf("GetUser() after upgrade = %+v, %v", got, err)
+	}
+	_, err = s.UpgradeUser(ctx, uuid.New())
+	wantNoRows(t, "UpgradeUser(unknown)", err)
+}
+
+func testChirps(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	alice := createUser(t, s, "alice@example.com")
+	bob := createUser(t, s, "bob@example.com")
+
+	if _, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "orphan", UserID: uuid.New()}); err == nil {
+		t.Error("CreateChirp() for an unknown user succeeded")
+	}
+
+	first := createChirp(t, s, alice.ID, "one")
+	// keep created_at strictly increasing on coarse clocks
+	time.Sleep(2 * time.Millisecond)
+	createChirp(t, s, bob.ID, "two")
+	time.Sleep(2 * time.Millisecond)
+	createChirp(t, s, alice.ID, "three")
+
+	got, err := s.GetChirp(ctx, first.ID)
+	if err != nil || got.Body != "one" || got.UserID != alice.ID {
+		t.Errorf("GetChirp() = %+v, %v", got, err)
+	}
+	_, err = s.GetChirp(ctx, uuid.New())
+	wantNoRows(t, "GetChirp(unknown)", err)
+
+	all, err := s.GetChirps(ctx, uuid.Nil)
+	if err != nil || !slices.Equal(chirpBodies(all), []string{"one", "two", "three"}) {
+		t.Errorf("GetChirps() = %v, %v; want one, two, three", chirpBodies(all), err)
+	}
+	byAlice, err := s.GetChirpsByAuthor(ctx, database.GetChirpsByAuthorParams{UserID: alice.ID})
+	if err != nil || !slices.Equal(chirpBodies(byAlice), []string{"one", "three"}) {
+		t.Errorf("GetChirpsByAuthor() = %v, %v; want one, three", chirpBodies(byAlice), err)
+	}
+
+	_, err = s.DeleteChirp(ctx, database.DeleteChirpParams{ID: first.ID, UserID: bob.ID})
+	wantNoRows(t, "DeleteChirp(not the author)", err)
+	deleted, err := s.DeleteChirp(ctx, database.DeleteChirpParams{ID: first.ID, UserID: alice.ID})
+	if err != nil || deleted.ID != first.ID {
+		t.Errorf("DeleteChirp() = %+v, %v", deleted, err)
+	}
+	_, err = s.GetChirp(ctx, first.ID)
+	wantNoRows(t, "GetChirp(deleted)", err)
+
+	three := byAlice[1]
+	if n, err := s.RemoveChirp(ctx, three.ID); err != nil || n != 1 {
+		t.Errorf("RemoveChirp() = %d, %v; want 1", n, err)
+	}
+	if n, err := s.RemoveChirp(ctx, three.ID); err != nil || n != 0 {
+		t.Errorf("RemoveChirp() again = %d, %v; want 0", n, err)
+	}
+}
+
+func testRelationships(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	viewer := createUser(t, s, "viewer@example.com")
+	blocked := createUser(t, s, "blocked@example.com")
+	muted := createUser(t, s, "muted@example.com")
+	createChirp(t, s, blocked.ID, "from blocked")
+	createChirp(t, s, muted.ID, "from muted")
+
+	block := database.BlockUserParams{BlockerID: viewer.ID, BlockedID: blocked.ID}
+	for range 2 {
+		if err := s.BlockUser(ctx, block); err != nil {
+			t.Fatalf("BlockUser() error = %v", err)
+		}
+	}
+	if err := s.MuteUser(ctx, database.MuteUserParams{MuterID: viewer.ID, MutedID: muted.ID}); err != nil {
+		t.Fatalf("MuteUser() error = %v", err)
+	}
+
+	hidden, err := s.ListHiddenUsers(ctx, viewer.ID)
+	if err != nil || len(hidden) != 2 || !slices.Contains(hidden, blocked.ID) || !slices.Contains(hidden, muted.ID) {
+		t.Errorf("ListHiddenUsers(viewer) = %v, %v; want the blocked and muted users", hidden, err)
+	}
+	if hidden, err := s.ListHiddenUsers(ctx, blocked.ID); err != nil || len(hidden) != 0 {
+		t.Errorf("ListHiddenUsers(blocked user) = %v, %v; want nothing", hidden, err)
+	}
+
+	visible, err := s.GetChirps(ctx, viewer.ID)
+	if err != nil || len(visible) != 0 {
+		t.Errorf("GetChirps(viewer) = %v, %v; want nothing", chirpBodies(visible), err)
+	}
+	byBlocked, err := s.GetChirpsByAuthor(ctx, database.GetChirpsByAuthorParams{UserID: blocked.ID, ViewerID: viewer.ID})
+	if err != nil || len(byBlocked) != 0 {
+		t.Errorf("GetChirpsByAuthor(blocked) = %v, %v; want nothing", chirpBodies(byBlocked), err)
+	}
+	// blocking is one way
+	if visible, _ := s.GetChirps(ctx, blocked.ID); len(visible) != 2 {
+		t.Errorf("GetChirps(blocked user) = %v, want both chirps", chirpBodies(visible))
+	}
+	for _, tt := range []struct {
+		blocker, blocked uuid.UUID
+		want             bool
+	}{
+		{viewer.ID, blocked.ID, true},
+		{blocked.ID, viewer.ID, false},
+		{viewer.ID, muted.ID, false},
+	} {
+		if got, err := s.IsBlocked(ctx, database.IsBlockedParams{BlockerID: tt.blocker, BlockedID: tt.blocked}); err != nil || got != tt.want {
+			t.Errorf("IsBlocked(%v, %v) = %v, %v; want %v", tt.blocker, tt.blocked, got, err, tt.want)
+		}
+	}
+
+	if err := s.UnblockUser(ctx, database.UnblockUserParams{BlockerID: viewer.ID, BlockedID: blocked.ID}); err != nil {
+		t.Fatalf("UnblockUser() error = %v", err)
+	}
+	if err := s.UnmuteUser(ctx, database.UnmuteUserParams{MuterID: viewer.ID, MutedID: muted.ID}); err != nil {
+		t.Fatalf("UnmuteUser() error = %v", err)
+	}
+	if err := s.UnmuteUser(ctx, database.UnmuteUserParams{MuterID: viewer.ID, MutedID: muted.ID}); err != nil {
+		t.Errorf("UnmuteUser() when not muted error = %v", err)
+	}
+	if visible, _ := s.GetChirps(ctx, viewer.ID); len(visible) != 2 {
+		t.Errorf("GetChirps(viewer) after unblock = %v, want both chirps", chirpBodies(visible))
+	}
+	if got, _ := s.IsBlocked(ctx, database.IsBlockedParams{BlockerID: viewer.ID, BlockedID: blocked.ID}); got {
+		t.Error("IsBlocked() after unblock = true")
+	}
+
+	if err := s.BlockUser(ctx, database.BlockUserParams{BlockerID: viewer.ID, BlockedID: viewer.ID}); err == nil {
+		t.Error("BlockUser() on yourself succeeded")
+	}
+	if err := s.MuteUser(ctx, database.MuteUserParams{MuterID: viewer.ID, MutedID: uuid.New()}); err == nil {
+		t.Error("MuteUser() of an unknown user succeeded")
+	}
+}
+
+func testRefreshTokens(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "howard@example.com")
+	expires := time.Now().UTC().Add(time.Hour)
+
+	token, err := s.CreateToken(ctx, database.CreateTokenParams{Token: "live", UserID: user.ID, ExpiresAt: expires})
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+	if token.UserID != user.ID || token.RevokedAt.Valid || token.ExpiresAt.Sub(expires).Abs() > time.Millisecond {
+		t.Errorf("CreateToken() = %+v", token)
+	}
+	if _, err := s.CreateToken(ctx, database.CreateTokenParams{Token: "orphan", UserID: uuid.New(), ExpiresAt: expires}); err == nil {
+		t.Error("CreateToken() for an unknown user succeeded")
+	}
+
+	if got, err := s.GetUserFromRefreshToken(ctx, "live"); err != nil || got.UserID != user.ID {
+		t.Errorf("GetUserFromRefreshToken() = %+v, %v", got, err)
+	}
+	_, err = s.GetUserFromRefreshToken(ctx, "missing")
+	wantNoRows(t, "GetUserFromRefreshToken(missing)", err)
+
+	if _, err := s.CreateToken(ctx, database.CreateTokenParams{Token: "expired", UserID: user.ID, ExpiresAt: time.Now().UTC().Add(-time.Hour)}); err != nil {
+		t.Fatalf("CreateToken(expired) error = %v", err)
+	}
+	_, err = s.GetUserFromRefreshToken(ctx, "expired")
+	wantNoRows(t, "GetUserFromRefreshToken(expired)", err)
+	if _, err := s.GetRefreshToken(ctx, "expired"); err != nil {
+		t.Errorf("GetRefreshToken(expired) error = %v, want the row", err)
+	}
+
+	revoked, err := s.RevokeToken(ctx, "live")
+	if err != nil || !revoked.RevokedAt.Valid {
+		t.Errorf("RevokeToken() = %+v, %v", revoked, err)
+	}
+	_, err = s.GetUserFromRefreshToken(ctx, "live")
+	wantNoRows(t, "GetUserFromRefreshToken(revoked)", err)
+	_, err = s.RevokeToken(ctx, "missing")
+	wantNoRows(t, "RevokeToken(missing)", err)
+
+	for _, tok := range []string{"a", "b"} {
+		if _, err := s.CreateToken(ctx, database.CreateTokenParams{Token: tok, UserID: user.ID, ExpiresAt: expires}); err != nil {
+			t.Fatalf("CreateToken(%s) error = %v", tok, err)
+		}
+	}
+	if err := s.RevokeUserTokens(ctx, user.ID); err != nil {
+		t.Fatalf("RevokeUserTokens() error = %v", err)
+	}
+	for _, tok := range []string{"a", "b"} {
+		_, err := s.GetUserFromRefreshToken(ctx, tok)
+		wantNoRows(t, "GetUserFromRefreshToken after RevokeUserTokens", err)
+	}
+}
+
+func testDeleteUsers(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "chuck@example.com")
+	chirp := createChirp(t, s, user.ID, "hhm")
+	if _, err := s.CreateToken(ctx, database.CreateTokenParams{Token: "tok", UserID: user.ID, ExpiresAt: time.Now().UTC().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteUsers(ctx); err != nil {
+		t.Fatalf("DeleteUsers() error = %v", err)
+	}
+
+	_, err := s.GetUser(ctx, user.ID)
+	wantNoRows(t, "GetUser after DeleteUsers", err)
+	_, err = s.GetChirp(ctx, chirp.ID)
+	wantNoRows(t, "GetChirp after DeleteUsers", err)
+	_, err = s.GetRefreshToken(ctx, "tok")
+	wantNoRows(t, "GetRefreshToken after DeleteUsers", err)
+
+	// emails are free again
+	createUser(t, s, user.Email)
+}
+
+func testTransactions(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	alice := createUser(t, s, "alice@example.com")
+
+	errAbort := errors.New("abort")
+	err := s.InTx(ctx, func(tx store.Store, _ jobs.Execer) error {
+		createChirp(t, tx, alice.ID, "rolled back")
+		if _, err := tx.UpgradeUser(ctx, alice.ID); err != nil {
+			t.Errorf("UpgradeUser() in a transaction error = %v", err)
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("InTx() error = %v, want fn's error", err)
+	}
+	if chirps, err := s.GetChirps(ctx, uuid.Nil); err != nil || len(chirps) != 0 {
+		t.Errorf("GetChirps() after a rollback = %v, %v; want none", chirpBodies(chirps), err)
+	}
+	if got, err := s.GetUser(ctx, alice.ID); err != nil || got.IsChirpyRed {
+		t.Errorf("GetUser() after a rollback = %+v, %v; want not upgraded", got, err)
+	}
+
+	err = s.InTx(ctx, func(tx store.Store, _ jobs.Execer) error {
+		createChirp(t, tx, alice.ID, "committed")
+		// a nested call joins the open transaction
+		return tx.InTx(ctx, func(tx store.Store, _ jobs.Execer) error {
+			createChirp(t, tx, alice.ID, "nested")
+			return nil
+		})
+	})
+	if err != nil {
+		t.Errorf("InTx() error = %v", err)
+	}
+	// both chirps can share a timestamp, so their order isn't checked
+	chirps, err := s.GetChirps(ctx, uuid.Nil)
+	if bodies := chirpBodies(chirps); err != nil || !slices.Equal(slices.Sorted(slices.Values(bodies)), []string{"committed", "nested"}) {
+		t.Errorf("GetChirps() after a commit = %v, %v; want committed and nested", bodies, err)
+	}
+}
@@ -0,0 +1,36 @@
+// Package textlen measures text the way a reader sees it. Count counts
+// user-perceived characters (extended grapheme clusters), so "é" written
+// as e plus a combining accent, a flag and a family emoji each count as
+// one, however many bytes or code points they take. Links count as a
+// fixed URLLength, since clients shorten them for display anyway.
+package textlen
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rivo/uniseg"
+)
+
+// URLLength is what every link counts as, whatever its real length.
+const URLLength = 23
+
+// urlPattern finds http and https links. Bare domains aren't links: too
+// much ordinary text ("e.g.", "node.js") would look like one.
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://\S+`)
+
+// trailingPunctuation is trimmed from the end of a link, so the full stop
+// ending "see https://example.com." isn't counted as part of the URL.
+const trailingPunctuation = `.,:;!?'")]}`
+
+// Count returns the length of s in user-perceived characters, with each
+// link counted as URLLength.
+func Count(s string) int {
+	n, last := 0, 0
+	for _, loc := range urlPattern.FindAllStringIndex(s, -1) {
+		url := strings.TrimRight(s[loc[0]:loc[1]], trailingPunctuation)
+		n += uniseg.GraphemeClusterCount(s[last:loc[0]]) + URLLength
+		last = loc[0] + len(url)
+	}
+	return n + uniseg.GraphemeClusterCount(s[last:])
+}
@@ -0,0 +1,48 @@
+package textlen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{"empty", "", 0},
+		{"ascii", "hello", 5},
+		{"precomposed accent", "caf\u00e9", 4},
+		{"combining accent", "cafe\u0301", 4},
+		{"cjk", "你好世界", 4},
+		{"emoji", "👍👍", 2},
+		{"skin tone", "👍🏽", 1},
+		{"family", "👨\u200d👩\u200d👧\u200d👦", 1},
+		{"flag", "🇳🇿", 1},
+		{"crlf", "a\r\nb", 3},
+		{"url", "https://example.com/a/very/long/path/that/goes/on/and/on", URLLength},
+		{"url in text", "see http://example.com now", 4 + URLLength + 4},
+		{"url before punctuation", "(https://example.com).", 1 + URLLength + 2},
+		{"two urls", "https://a.example https://b.example", 2*URLLength + 1},
+		{"uppercase scheme", "HTTPS://EXAMPLE.COM", URLLength},
+		{"short url", "http://x.co", URLLength},
+		{"bare domain", "example.com", 11},
+		{"scheme only", "https:// x", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Count(tt.in); got != tt.want {
+				t.Errorf("Count(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountIgnoresEncodedSize(t *testing.T) {
+	// 140 emoji are 560 bytes but only 140 characters.
+	s := strings.Repeat("🐦", 140)
+	if got := Count(s); got != 140 {
+		t.Errorf("Count = %d, want 140", got)
+	}
+}
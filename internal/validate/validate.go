@@ -0,0 +1,197 @@
+// Package validate checks request structs against rules declared in
+// `validate` struct tags and reports every failing field at once, named
+// by its JSON path (e.g. media[1].alt_text).
+//
+// Rules are comma separated:
+//
+//	required     not the zero value; strings must not be blank
+//	email        a bare address such as alice@example.com
+//	password     8 to 72 bytes, the range bcrypt can hash
+//	uuid         a UUID in canonical form
+//	min=N, max=N bounds on the value of integers and the length of
+//	             strings (in characters) and slices
+//	oneof=a b c  one of the space separated values
+//
+// Every rule except required passes on an empty value, so optional
+// fields only need checking when they are set.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+)
+
+const (
+	minPasswordBytes = 8
+	// bcrypt ignores anything after 72 bytes
+	maxPasswordBytes = 72
+	maxEmailLength   = 254
+)
+
+// FieldError describes one invalid field.
+type FieldError = problem.FieldError
+
+// Errors is every FieldError found in a value.
+type Errors []FieldError
+
+// InvalidFields makes Errors a ValidationFailed problem that lists them.
+func (e Errors) InvalidFields() []FieldError {
+	return e
+}
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + " " + fe.Message
+	}
+	return "invalid request: " + strings.Join(msgs, "; ")
+}
+
+// Struct validates the struct v points to, returning Errors or nil.
+func Struct(v any) error {
+	var errs Errors
+	walk(reflect.Indirect(reflect.ValueOf(v)), "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func walk(v reflect.Value, prefix string, errs *Errors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := fieldName(f, prefix)
+		if tag := f.Tag.Get("validate"); tag != "" {
+			if msg := check(fv, tag); msg != "" {
+				*errs = append(*errs, FieldError{Field: name, Message: msg})
+				continue
+			}
+		}
+
+		switch {
+		case fv.Kind() == reflect.Struct:
+			walk(fv, name, errs)
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Struct:
+			for j := 0; j < fv.Len(); j++ {
+				walk(fv.Index(j), fmt.Sprintf("%s[%d]", name, j), errs)
+			}
+		}
+	}
+}
+
+func fieldName(f reflect.StructField, prefix string) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		name = f.Name
+	}
+	if prefix != "" {
+		return prefix + "." + name
+	}
+	return name
+}
+
+// check returns the message for the first rule in tag that v breaks.
+func check(v reflect.Value, tag string) string {
+	for rule := range strings.SplitSeq(tag, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		if name == "required" {
+			if isBlank(v) {
+				return "is required"
+			}
+			continue
+		}
+		if isBlank(v) {
+			continue
+		}
+		if msg := apply(name, arg, v); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+func isBlank(v reflect.Value) bool {
+	if v.Kind() == reflect.String {
+		return strings.TrimSpace(v.String()) == ""
+	}
+	return v.IsZero()
+}
+
+func apply(rule, arg string, v reflect.Value) string {
+	switch rule {
+	case "email":
+		s := v.String()
+		addr, err := mail.ParseAddress(s)
+		if err != nil || addr.Address != s || len(s) > maxEmailLength {
+			return "must be a valid email address"
+		}
+	case "password":
+		if n := len(v.String()); n < minPasswordBytes || n > maxPasswordBytes {
+			return fmt.Sprintf("must be between %d and %d bytes long", minPasswordBytes, maxPasswordBytes)
+		}
+	case "uuid":
+		if err := uuid.Validate(v.String()); err != nil {
+			return "must be a UUID"
+		}
+	case "min":
+		if size(v) < mustAtoi(rule, arg) {
+			return "must be at least " + arg + unit(v)
+		}
+	case "max":
+		if size(v) > mustAtoi(rule, arg) {
+			return "must be at most " + arg + unit(v)
+		}
+	case "oneof":
+		allowed := strings.Fields(arg)
+		s := fmt.Sprint(v.Interface())
+		for _, a := range allowed {
+			if s == a {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(allowed, ", ")
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q", rule))
+	}
+	return ""
+}
+
+// size is the length of strings and slices and the value of integers.
+func size(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String())
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return int(v.Int())
+	}
+	return v.Len()
+}
+
+func unit(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return " characters"
+	case reflect.Slice:
+		return " items"
+	}
+	return ""
+}
+
+func mustAtoi(rule, arg string) int {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		panic(fmt.Sprintf("validate: %s needs an integer, got %q", rule, arg))
+	}
+	return n
+}
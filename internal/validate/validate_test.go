@@ -0,0 +1,86 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type attachment struct {
+	ID      string `json:"id" validate:"required,uuid"`
+	AltText string `json:"alt_text" validate:"required,max=5"`
+}
+
+type request struct {
+	Email    string       `json:"email" validate:"required,email"`
+	Password string       `json:"password" validate:"required,password"`
+	Role     string       `json:"role" validate:"oneof=user admin"`
+	Hours    int          `json:"hours" validate:"min=1,max=24"`
+	Media    []attachment `json:"media" validate:"max=2"`
+	Ignored  string       `json:"-"`
+}
+
+func valid() request {
+	return request{
+		Email:    "alice@example.com",
+		Password: "correct horse",
+		Media:    []attachment{{ID: "0b9d3f4e-8a8c-4f63-9d38-6f1f2c1f6a10", AltText: "cat"}},
+	}
+}
+
+func TestStructValid(t *testing.T) {
+	r := valid()
+	if err := Struct(&r); err != nil {
+		t.Fatalf("Struct() = %v, want nil", err)
+	}
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*request)
+		want   Errors
+	}{
+		{"missing email", func(r *request) { r.Email = "" }, Errors{{Field: "email", Message: "is required"}}},
+		{"blank email", func(r *request) { r.Email = "   " }, Errors{{Field: "email", Message: "is required"}}},
+		{"email with name", func(r *request) { r.Email = "Alice <alice@example.com>" }, Errors{{Field: "email", Message: "must be a valid email address"}}},
+		{"not an email", func(r *request) { r.Email = "alice" }, Errors{{Field: "email", Message: "must be a valid email address"}}},
+		{"short password", func(r *request) { r.Password = "hunter2" }, Errors{{Field: "password", Message: "must be between 8 and 72 bytes long"}}},
+		{"long password", func(r *request) { r.Password = strings.Repeat("a", 73) }, Errors{{Field: "password", Message: "must be between 8 and 72 bytes long"}}},
+		{"unknown role", func(r *request) { r.Role = "root" }, Errors{{Field: "role", Message: "must be one of user, admin"}}},
+		{"hours too low", func(r *request) { r.Hours = -1 }, Errors{{Field: "hours", Message: "must be at least 1"}}},
+		{"hours too high", func(r *request) { r.Hours = 25 }, Errors{{Field: "hours", Message: "must be at most 24"}}},
+		{"too many attachments", func(r *request) { r.Media = make([]attachment, 3) }, Errors{{Field: "media", Message: "must be at most 2 items"}}},
+		{"bad attachment", func(r *request) { r.Media[0] = attachment{ID: "42", AltText: "a tabby"} }, Errors{
+			{Field: "media[0].id", Message: "must be a UUID"},
+			{Field: "media[0].alt_text", Message: "must be at most 5 characters"},
+		}},
+		{"several fields", func(r *request) { r.Email, r.Password = "", "" }, Errors{
+			{Field: "email", Message: "is required"},
+			{Field: "password", Message: "is required"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.modify(&r)
+			err := Struct(&r)
+			var got Errors
+			if !errors.As(err, &got) {
+				t.Fatalf("Struct() = %v, want Errors", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Struct() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxCountsCharacters(t *testing.T) {
+	r := valid()
+	r.Media[0].AltText = "crème"
+	if err := Struct(&r); err != nil {
+		t.Errorf("Struct() = %v, want nil for 5 characters", err)
+	}
+}
@@ -0,0 +1,186 @@
+// Package webhook signs and sends outbound webhook deliveries.
+//
+// Every delivery carries a Chirpy-Signature header of the form
+// "t=<unix seconds>,v1=<hex HMAC-SHA256>". The MAC is computed with the
+// endpoint's secret over the timestamp, a dot and the body, so a receiver
+// can check with Verify that a request came from us and is not a replay
+// of an old one.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	SignatureHeader = "Chirpy-Signature"
+	EventHeader     = "Chirpy-Event"
+	DeliveryHeader  = "Chirpy-Delivery"
+)
+
+var (
+	// ErrPrivateAddress is returned for endpoints on loopback, private or
+	// otherwise internal addresses unless they are allowed.
+	ErrPrivateAddress = errors.New("webhook: endpoint address is not public")
+	// ErrBadSignature is returned by Verify for a missing, malformed,
+	// stale or wrong signature.
+	ErrBadSignature = errors.New("webhook: bad signature")
+)
+
+// sharedAddressSpace is carrier-grade NAT space, which netip doesn't count
+// as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// NewSecret returns a random signing secret for a new endpoint.
+func NewSecret() string {
+	b := make([]byte, 32)
+	crand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// Sign returns the Chirpy-Signature header value for body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + mac(secret, ts, body)
+}
+
+// Verify checks header against body, rejecting signatures made more than
+// tolerance before or after now.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var ts, sig string
+	for part := range strings.SplitSeq(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return ErrBadSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrBadSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(mac(secret, ts, body))) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+func mac(secret, ts string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(ts))
+	m.Write([]byte("."))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// CheckURL reports whether rawURL may be registered as an endpoint: an
+// absolute https URL, or http too when allowPrivate is set. Hosts are
+// only resolved when sending, so a name pointing at a private address is
+// caught by the Sender.
+func CheckURL(rawURL string, allowPrivate bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.User != nil {
+		return errors.New("must be an absolute URL without credentials")
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && allowPrivate:
+	default:
+		return errors.New("must use https")
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !allowPrivate && !isPublic(addr) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// Sender posts deliveries. Redirects are not followed, so an endpoint
+// can't bounce a delivery to an internal address.
+type Sender struct {
+	client *http.Client
+}
+
+// NewSender returns a Sender whose requests time out after timeout. Unless
+// allowPrivate is set it refuses to connect to anything but public
+// addresses, checked after DNS resolution.
+func NewSender(timeout time.Duration, allowPrivate bool) *Sender {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if addr, err := netip.ParseAddr(host); err != nil || !isPublic(addr) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	return &Sender{client: &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// a proxy would be dialled instead of the endpoint
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// Send posts body, signed with secret, to endpoint. It returns the status
+// the endpoint answered with, if any, and an error unless it was a 2xx.
+func (s *Sender) Send(ctx context.Context, endpoint, secret, event, deliveryID string, body []byte) (status int, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(SignatureHeader, Sign(secret, time.Now(), body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drain a little so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jwoodsiii/chirpy/internal/config"
+	"github.com/jwoodsiii/chirpy/internal/jobs"
+)
+
+// newJobRunner returns a runner for the jobs table with a handler for
+// every kind of background job.
+func (cfg *apiConfig) newJobRunner(conf config.Jobs) *jobs.Runner {
+	runner := jobs.NewRunner(cfg.conn, jobs.Options{
+		Concurrency:  conf.Concurrency,
+		PollInterval: conf.PollInterval,
+		DrainTimeout: conf.DrainTimeout,
+		Done: func(res jobs.Result) {
+			cfg.metrics.jobRuns.With(res.Kind, res.Outcome).Inc()
+			cfg.metrics.jobDuration.With(res.Kind).Observe(res.Duration.Seconds())
+		},
+	})
+
+	// deliveries back off on the webhook schedule, which deliverWebhook
+	// asks for with jobs.RetryAfter
+	jobs.Handle(runner, deliverWebhookJob, jobs.KindOptions{
+		Concurrency: webhookConcurrency,
+		Timeout:     2 * cfg.webhookTimeout,
+	}, cfg.deliverWebhook)
+
+	jobs.Handle(runner, sweepMediaJob, jobs.KindOptions{Every: mediaSweepInterval}, cfg.sweepMedia)
+
+	return runner
+}
+
+// scheduleJobs queues the first run of each periodic job. Every replica
+// does this at startup, and Unique keeps one of each between them.
+func (cfg *apiConfig) scheduleJobs(ctx context.Context) error {
+	return sweepMediaJob.Enqueue(ctx, cfg.conn, struct{}{}, jobs.Unique("media-sweep"))
+}
@@ -1,100 +1,329 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
+	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/config"
 	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/filter"
+	"github.com/jwoodsiii/chirpy/internal/health"
+	"github.com/jwoodsiii/chirpy/internal/hub"
+	"github.com/jwoodsiii/chirpy/internal/jobs"
+	"github.com/jwoodsiii/chirpy/internal/logging"
+	"github.com/jwoodsiii/chirpy/internal/media"
+	"github.com/jwoodsiii/chirpy/internal/migrate"
+	"github.com/jwoodsiii/chirpy/internal/ratelimit"
+	"github.com/jwoodsiii/chirpy/internal/store"
+	"github.com/jwoodsiii/chirpy/internal/webhook"
 	_ "github.com/lib/pq"
 )
 
+const dbPingTimeout = 5 * time.Second
+
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	db             *database.Queries
-	platform       string
-	jwtSecret      string
-	polkaKey       string
+	metrics      *appMetrics
+	metricsToken string
+	db           *database.Queries
+	store        store.Store
+	conn         *sql.DB
+	platform     string
+	jwtSecret    string
+	polkaKey     string
+	blobs        media.BlobStore
+	health       *health.Checker
+	migrator     *migrate.Migrator
+
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	maxChirpLength  int
+	// redMaxChirpLength replaces maxChirpLength for Chirpy Red members.
+	redMaxChirpLength int
+	// filterTerms are the configured words; filter adds the ones admins
+	// manage in the database.
+	filterTerms []filter.Term
+	filter      atomic.Pointer[filter.Filter]
+
+	requestTimeout        time.Duration
+	uploadTimeout         time.Duration
+	maxConcurrentRequests int
+
+	// events feeds the real-time streams; streamEpoch prefixes the IDs of
+	// the events this process sends.
+	events      *hub.Hub
+	streamEpoch string
+
+	// jobs runs background work; it is nil without Postgres.
+	jobs *jobs.Runner
+
+	// webhooks sends the deliveries queued in the webhook outbox.
+	webhooks            *webhook.Sender
+	webhookMaxAttempts  int
+	webhookTimeout      time.Duration
+	webhookAllowPrivate bool
+
+	// rateLimits is nil when rate limiting is disabled.
+	rateLimits     ratelimit.Store
+	trustedProxies []netip.Prefix
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileserverHits.Add(1)
+		cfg.metrics.fileserverHits.Inc()
 		next.ServeHTTP(w, r)
 	})
 }
 
 func main() {
+	configPath := flag.String("config", os.Getenv("CHIRPY_CONFIG"), "path to a YAML config `file`")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	migrateOnStart := flag.Bool("migrate-on-start", false, "apply pending migrations before serving")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: chirpy [flags]\n       chirpy [flags] migrate up|down|status|redo\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	godotenv.Load()
 
-	dbUrl := os.Getenv("DB_URL")
-	platform := os.Getenv("PLATFORM")
-	jwt := os.Getenv("JWT_SECRET")
-	polkaKey := os.Getenv("POLKA_KEY")
-	if jwt == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrateCommand(*configPath, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	} else if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
 	}
 
-	db, err := sql.Open("postgres", dbUrl)
+	conf, err := config.Load(*configPath, os.LookupEnv)
+	if *printConfig {
+		conf.Print(os.Stdout)
+	}
 	if err != nil {
-		log.Fatalf("Failed to connect to db: %v", err)
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	if *printConfig {
+		return
 	}
 
-	dbQueries := database.New(db)
+	logger, err := logging.New(os.Stdout, conf.Log.Level, conf.Log.Format)
+	if err != nil {
+		fatal("Invalid logging configuration", err)
+	}
+	slog.SetDefault(logger)
 
-	apiConfig := apiConfig{
-		fileserverHits: atomic.Int32{},
-		db:             dbQueries,
-		platform:       platform,
-		jwtSecret:      jwt,
-		polkaKey:       polkaKey,
+	backend := parseDatabaseURL(conf.DatabaseURL)
+	db, err := openDB(backend)
+	if err != nil {
+		fatal("Database is unreachable, check DB_URL", err)
 	}
+	defer db.Close()
+	slog.Info("Connected to database", "backend", backend.name)
 
-	const filePathRoot = "."
-	const port = "8080"
-	mux := http.NewServeMux()
+	migrator, err := migrate.New(db, backend.dialect, backend.schema)
+	if err != nil {
+		fatal("Invalid embedded migrations", err)
+	}
+	if err := prepareSchema(context.Background(), migrator, conf.MigrateOnStart || *migrateOnStart); err != nil {
+		fatal("Database schema is not usable", err)
+	}
 
-	mux.Handle("/app/", http.StripPrefix("/app", apiConfig.middlewareMetricsInc(http.FileServer(http.Dir(filePathRoot)))))
-	mux.HandleFunc("GET /api/healthz", handlerReadiness)
-	mux.HandleFunc("GET /admin/metrics", apiConfig.handlerRequestCounter)
-	mux.HandleFunc("POST /admin/reset", apiConfig.handlerReset)
-	mux.HandleFunc("POST /api/refresh", apiConfig.handlerRefreshToken)
+	blobs, err := media.NewLocalBlobStore(conf.MediaDir, "/media/")
+	if err != nil {
+		fatal("Failed to open media store", err)
+	}
 
-	mux.HandleFunc("POST /api/users", apiConfig.handlerCreateUser)
-	mux.HandleFunc("PUT /api/users", apiConfig.handlerUserUpdates)
-	mux.HandleFunc("POST /api/login", apiConfig.handlerLogin)
-	mux.HandleFunc("POST /api/revoke", apiConfig.handlerRevokeToken)
+	apiConfig := newAPIConfig(conf, backend.newStore(db), db, migrator, blobs)
 
-	mux.HandleFunc("GET /api/chirps", apiConfig.handlerGetChirps)
-	mux.HandleFunc("POST /api/chirps", apiConfig.handlerCreateChirp)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiConfig.handlerGetChirp)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiConfig.handlerDeleteChirp)
+	if conf.AdminEmail != "" {
+		if err := apiConfig.bootstrapAdmin(context.Background(), conf.AdminEmail, conf.AdminPassword); err != nil {
+			fatal("Failed to bootstrap admin", err)
+		}
+	}
 
-	mux.HandleFunc("POST /api/polka/webhooks", apiConfig.handlerUpgradeChirpy)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	server := http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+	if apiConfig.db != nil {
+		if err := apiConfig.reloadFilter(ctx); err != nil {
+			fatal("Failed to load filter terms", err)
+		}
+		go apiConfig.runFilterRefresher(ctx, filterRefreshInterval)
+	}
+	// on shutdown the runner stops claiming and drains its running jobs
+	// alongside the server's requests
+	var jobsDone sync.WaitGroup
+	if apiConfig.jobs != nil {
+		if err := apiConfig.scheduleJobs(ctx); err != nil {
+			fatal("Failed to schedule jobs", err)
+		}
+		jobsDone.Go(func() { apiConfig.jobs.Run(ctx) })
 	}
 
-	server.ListenAndServe()
+	server := newServer(conf.Server, apiConfig.routes())
+	draining := func() {
+		apiConfig.health.SetShuttingDown()
+		// streams never finish on their own; end them so clients
+		// reconnect elsewhere and shutdown isn't held up
+		apiConfig.events.Close()
+	}
+	if err := runServer(ctx, server, conf.Server, draining); err != nil {
+		slog.Error("Server error", "err", err)
+		db.Close()
+		os.Exit(1)
+	}
+	jobsDone.Wait()
+	slog.Info("Server stopped")
+}
+
+func fatal(msg string, err error) {
+	if err != nil {
+		slog.Error(msg, "err", err)
+	} else {
+		slog.Error(msg)
+	}
+	os.Exit(1)
+}
 
+// newAPIConfig wires the handlers to conf and their dependencies. conn and
+// migrator are nil when st doesn't live in a SQL database, as with the
+// in-memory store. Features outside the Store interface are only
+// available when st is the Postgres store.
+func newAPIConfig(conf config.Config, st store.Store, conn *sql.DB, migrator *migrate.Migrator, blobs media.BlobStore) *apiConfig {
+	db := postgresQueries(st)
+	cfg := &apiConfig{
+		metrics:           newAppMetrics(conn),
+		metricsToken:      conf.MetricsToken,
+		db:                db,
+		store:             st,
+		conn:              conn,
+		platform:          conf.Platform,
+		jwtSecret:         conf.JWTSecret,
+		polkaKey:          conf.PolkaKey,
+		blobs:             blobs,
+		health:            health.New(healthCheckTimeout),
+		migrator:          migrator,
+		accessTokenTTL:    conf.Auth.AccessTokenTTL,
+		refreshTokenTTL:   conf.Auth.RefreshTokenTTL,
+		maxChirpLength:    conf.Chirps.MaxLength,
+		redMaxChirpLength: conf.Chirps.RedMaxLength,
+		filterTerms:       configFilterTerms(conf.Chirps),
+
+		requestTimeout:        conf.Server.RequestTimeout,
+		uploadTimeout:         conf.Server.UploadTimeout,
+		maxConcurrentRequests: conf.Server.MaxConcurrentRequests,
+
+		webhooks:            webhook.NewSender(conf.Webhooks.Timeout, conf.Webhooks.AllowPrivate),
+		webhookMaxAttempts:  conf.Webhooks.MaxAttempts,
+		webhookTimeout:      conf.Webhooks.Timeout,
+		webhookAllowPrivate: conf.Webhooks.AllowPrivate,
+	}
+	cfg.filter.Store(filter.New(cfg.filterTerms))
+	cfg.events = hub.New(hub.Options{
+		Replay:         conf.Stream.Replay,
+		Queue:          conf.Stream.QueueSize,
+		MaxSubscribers: conf.Stream.MaxClients,
+	})
+	cfg.streamEpoch = newStreamEpoch()
+	cfg.metrics.registry.NewGaugeFunc("chirpy_stream_clients", "Open event streams.",
+		func() float64 { return float64(cfg.events.Subscribers()) })
+	cfg.metrics.registry.NewCounterFunc("chirpy_stream_clients_dropped_total", "Event streams closed for falling behind.",
+		func() float64 { return float64(cfg.events.Dropped()) })
+	if conf.RateLimit.Enabled {
+		cfg.rateLimits = ratelimit.NewMemory()
+	}
+	// config.Load has already rejected malformed entries
+	cfg.trustedProxies, _ = conf.Server.TrustedProxyPrefixes()
+	if db != nil {
+		cfg.jobs = cfg.newJobRunner(conf.Jobs)
+	}
+	cfg.registerHealthChecks()
+	return cfg
 }
 
-func (cfg *apiConfig) handlerRequestCounter(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	res := fmt.Sprintf(
-		`<html>
-  			<body>
-     			<h1>Welcome, Chirpy Admin</h1>
-        			<p>Chirpy has been visited %d times!</p>
-           </body>
-        </html>`,
-		int(cfg.fileserverHits.Load()))
-	w.Write([]byte(res))
+// routes builds the full HTTP handler, middleware included.
+func (cfg *apiConfig) routes() http.Handler {
+	const filePathRoot = "."
+	mux := http.NewServeMux()
+	// handle registers an API route with the default request timeout.
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.HandleFunc(pattern, middlewareTimeout(cfg.requestTimeout, h))
+	}
+
+	mux.Handle("/app/", http.StripPrefix("/app", cfg.middlewareMetricsInc(http.FileServer(http.Dir(filePathRoot)))))
+	handle("GET /media/{key...}", cfg.handlerServeMedia)
+	handle("GET /api/livez", handlerLivez)
+	handle("GET /api/readyz", cfg.handlerReadyz)
+	// kept for existing probes; liveness only
+	handle("GET /api/healthz", handlerLivez)
+	handle("GET /metrics", cfg.handlerMetrics)
+	handle("POST /admin/reset", cfg.middlewareRequireRole(auth.RoleAdmin, cfg.handlerReset))
+	handle("PUT /admin/users/{id}/role", cfg.middlewareRequireRole(auth.RoleAdmin, cfg.middlewareRequirePostgres(cfg.handlerSetUserRole)))
+	handle("GET /admin/reports", cfg.middlewareRequireRole(auth.RoleModerator, cfg.middlewareRequirePostgres(cfg.handlerListReports)))
+	handle("GET /admin/reports/{reportID}", cfg.middlewareRequireRole(auth.RoleModerator, cfg.middlewareRequirePostgres(cfg.handlerGetReport)))
+	handle("POST /admin/reports/{reportID}/triage", cfg.middlewareRequireRole(auth.RoleModerator, cfg.middlewareRequirePostgres(cfg.handlerTriageReport)))
+	handle("POST /admin/reports/{reportID}/resolve", cfg.middlewareRequireRole(auth.RoleModerator, cfg.middlewareRequirePostgres(cfg.handlerResolveReport)))
+	handle("GET /admin/filter/terms", cfg.middlewareRequireRole(auth.RoleAdmin, cfg.middlewareRequirePostgres(cfg.handlerListFilterTerms)))
+	handle("PUT /admin/filter/terms/{word}", cfg.middlewareRequireRole(auth.RoleAdmin, cfg.middlewareRequirePostgres(cfg.handlerPutFilterTerm)))
+	handle("DELETE /admin/filter/terms/{word}", cfg.middlewareRequireRole(auth.RoleAdmin, cfg.middlewareRequirePostgres(cfg.handlerDeleteFilterTerm)))
+	handle("GET /admin/moderation/actions", cfg.middlewareRequireRole(auth.RoleModerator, cfg.middlewareRequirePostgres(cfg.handlerListModerationActions)))
+	handle("POST /api/refresh", cfg.middlewareRateLimit(refreshRateLimit, cfg.handlerRefreshToken))
+
+	handle("POST /api/users", cfg.middlewareRateLimit(signupRateLimit, cfg.handlerCreateUser))
+	handle("PUT /api/users", cfg.handlerUserUpdates)
+	mux.HandleFunc("POST /api/users/avatar", middlewareTimeout(cfg.uploadTimeout, cfg.middlewareRateLimit(uploadRateLimit, cfg.handlerUploadAvatar)))
+	mux.HandleFunc("POST /api/users/banner", middlewareTimeout(cfg.uploadTimeout, cfg.middlewareRateLimit(uploadRateLimit, cfg.handlerUploadBanner)))
+	handle("POST /api/users/{id}/block", cfg.handlerBlockUser)
+	handle("DELETE /api/users/{id}/block", cfg.handlerUnblockUser)
+	handle("POST /api/users/{id}/mute", cfg.handlerMuteUser)
+	handle("DELETE /api/users/{id}/mute", cfg.handlerUnmuteUser)
+	handle("POST /api/login", cfg.middlewareRateLimit(loginRateLimit, cfg.handlerLogin))
+	handle("POST /api/revoke", cfg.handlerRevokeToken)
+
+	handle("GET /api/chirps", cfg.handlerGetChirps)
+	// streams stay open, so they have no request timeout
+	mux.HandleFunc("GET /api/stream/chirps", cfg.handlerStreamChirps)
+	mux.HandleFunc("GET /api/ws", cfg.handlerWebSocket)
+	handle("POST /api/chirps", cfg.middlewareRateLimit(chirpRateLimit, cfg.handlerCreateChirp))
+	handle("GET /api/chirps/{chirpID}", cfg.handlerGetChirp)
+	handle("DELETE /api/chirps/{chirpID}", cfg.handlerDeleteChirp)
+
+	handle("POST /api/chirps/{chirpID}/report", cfg.middlewareRequirePostgres(cfg.middlewareRateLimit(reportRateLimit, cfg.handlerReportChirp)))
+	mux.HandleFunc("POST /api/media", middlewareTimeout(cfg.uploadTimeout, cfg.middlewareRequirePostgres(cfg.middlewareRateLimit(uploadRateLimit, cfg.handlerUploadMedia))))
+
+	handle("GET /api/notifications", cfg.middlewareRequirePostgres(cfg.handlerListNotifications))
+	handle("POST /api/notifications/read", cfg.middlewareRequirePostgres(cfg.handlerMarkNotificationsRead))
+	handle("GET /api/notifications/preferences", cfg.middlewareRequirePostgres(cfg.handlerGetNotificationPreferences))
+	handle("PUT /api/notifications/preferences/{type}", cfg.middlewareRequirePostgres(cfg.handlerPutNotificationPreference))
+
+	handle("POST /api/webhooks", cfg.middlewareRequirePostgres(cfg.handlerCreateWebhook))
+	handle("GET /api/webhooks", cfg.middlewareRequirePostgres(cfg.handlerListWebhooks))
+	handle("DELETE /api/webhooks/{webhookID}", cfg.middlewareRequirePostgres(cfg.handlerDeleteWebhook))
+	handle("POST /api/webhooks/{webhookID}/ping", cfg.middlewareRequirePostgres(cfg.handlerPingWebhook))
+	handle("GET /api/webhooks/{webhookID}/deliveries", cfg.middlewareRequirePostgres(cfg.handlerListWebhookDeliveries))
+	handle("POST /api/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", cfg.middlewareRequirePostgres(cfg.handlerRedeliverWebhook))
+
+	handle("POST /api/polka/webhooks", cfg.handlerUpgradeChirpy)
+
+	var h http.Handler = mux
+	h = cfg.middlewareLimitConcurrency(cfg.maxConcurrentRequests, h)
+	h = cfg.middlewareRecover(h)
+	h = cfg.middlewareInstrument(h)
+	return middlewareRequestLogging(h)
 }
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/jobs"
+	"github.com/jwoodsiii/chirpy/internal/media"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+)
+
+const (
+	maxImageUploadBytes = 10 << 20
+	imageFormField      = "image"
+	orphanedMediaMaxAge = 24 * time.Hour
+	mediaSweepInterval  = time.Hour
+)
+
+type imageURLs map[string]string
+
+// MediaAttachment is an uploaded image as returned to clients, either on its
+// own after upload or attached to a Chirp along with its alt text.
+type MediaAttachment struct {
+	ID           uuid.UUID `json:"id"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+	Blurhash     string    `json:"blurhash"`
+	AltText      string    `json:"alt_text,omitempty"`
+}
+
+func (cfg *apiConfig) handlerUploadMedia(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	data, err := readImageUpload(w, r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	attachment, err := media.ProcessAttachment(data)
+	if err != nil {
+		respondWithImageError(w, r, err)
+		return
+	}
+
+	id := uuid.New()
+	base := path.Join("attachments", userID.String(), id.String())
+	fullKey, thumbKey := base+".jpg", base+"_thumb.jpg"
+	for key, rendition := range map[string]media.Rendition{fullKey: attachment.Full, thumbKey: attachment.Thumbnail} {
+		if err := cfg.blobs.Put(r.Context(), key, bytes.NewReader(rendition.Data), rendition.ContentType); err != nil {
+			slog.ErrorContext(r.Context(), "blob store error", "err", err)
+			cfg.deleteBlobs(r.Context(), fullKey, thumbKey)
+			respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't store image"))
+			return
+		}
+	}
+
+	upload, err := cfg.db.CreateMediaUpload(r.Context(), database.CreateMediaUploadParams{
+		ID:           id,
+		UserID:       userID,
+		ContentType:  attachment.Full.ContentType,
+		Width:        int32(attachment.Width),
+		Height:       int32(attachment.Height),
+		Key:          fullKey,
+		ThumbnailKey: thumbKey,
+		Blurhash:     attachment.Blurhash,
+	})
+	if err != nil {
+		cfg.deleteBlobs(r.Context(), fullKey, thumbKey)
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't save image"))
+		return
+	}
+
+	respondWithJson(w, http.StatusCreated, MediaAttachment{
+		ID:           upload.ID,
+		URL:          cfg.blobs.URL(upload.Key),
+		ThumbnailURL: cfg.blobs.URL(upload.ThumbnailKey),
+		ContentType:  upload.ContentType,
+		Width:        upload.Width,
+		Height:       upload.Height,
+		Blurhash:     upload.Blurhash,
+	})
+}
+
+// loadChirpMedia fills in the Media field of every chirp with a single query.
+func (cfg *apiConfig) loadChirpMedia(ctx context.Context, chirps []Chirp) error {
+	return cfg.loadChirpMediaWith(ctx, cfg.db, chirps)
+}
+
+// loadChirpMediaWith is loadChirpMedia reading with q, which may be a
+// transaction that attached the media.
+func (cfg *apiConfig) loadChirpMediaWith(ctx context.Context, q *database.Queries, chirps []Chirp) error {
+	ids := make([]uuid.UUID, len(chirps))
+	index := make(map[uuid.UUID]int, len(chirps))
+	for i := range chirps {
+		chirps[i].Media = []MediaAttachment{}
+		ids[i] = chirps[i].Id
+		index[chirps[i].Id] = i
+	}
+	// the SQLite backend has no attachments
+	if len(ids) == 0 || q == nil {
+		return nil
+	}
+
+	rows, err := q.GetChirpMedia(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		i := index[row.ChirpID]
+		chirps[i].Media = append(chirps[i].Media, MediaAttachment{
+			ID:           row.ID,
+			URL:          cfg.blobs.URL(row.Key),
+			ThumbnailURL: cfg.blobs.URL(row.ThumbnailKey),
+			ContentType:  row.ContentType,
+			Width:        row.Width,
+			Height:       row.Height,
+			Blurhash:     row.Blurhash,
+			AltText:      row.AltText,
+		})
+	}
+	return nil
+}
+
+// sweepMediaJob deletes uploads that were never attached to a chirp, or
+// whose chirp has since been deleted, once they are older than
+// orphanedMediaMaxAge. It runs every mediaSweepInterval.
+var sweepMediaJob = jobs.Kind[struct{}]{Name: "media.sweep"}
+
+func (cfg *apiConfig) sweepMedia(ctx context.Context, job *jobs.Job[struct{}]) error {
+	n, err := cfg.sweepOrphanedMedia(ctx, time.Now().UTC().Add(-orphanedMediaMaxAge))
+	if n > 0 {
+		slog.InfoContext(ctx, "media sweep removed orphaned uploads", "count", n)
+	}
+	return err
+}
+
+func (cfg *apiConfig) sweepOrphanedMedia(ctx context.Context, olderThan time.Time) (int, error) {
+	uploads, err := cfg.db.DeleteOrphanedMediaUploads(ctx, olderThan)
+	if err != nil {
+		return 0, err
+	}
+	for _, upload := range uploads {
+		cfg.deleteBlobs(ctx, upload.Key, upload.ThumbnailKey)
+	}
+	return len(uploads), nil
+}
+
+func (cfg *apiConfig) handlerUploadAvatar(w http.ResponseWriter, r *http.Request) {
+	cfg.handleProfileImage(w, r, "avatars", media.AvatarVariants,
+		func(userID uuid.UUID, key sql.NullString) (database.User, error) {
+			return cfg.store.UpdateUserAvatar(r.Context(), database.UpdateUserAvatarParams{ID: userID, AvatarKey: key})
+		},
+		func(u database.User) sql.NullString { return u.AvatarKey },
+	)
+}
+
+func (cfg *apiConfig) handlerUploadBanner(w http.ResponseWriter, r *http.Request) {
+	cfg.handleProfileImage(w, r, "banners", media.BannerVariants,
+		func(userID uuid.UUID, key sql.NullString) (database.User, error) {
+			return cfg.store.UpdateUserBanner(r.Context(), database.UpdateUserBannerParams{ID: userID, BannerKey: key})
+		},
+		func(u database.User) sql.NullString { return u.BannerKey },
+	)
+}
+
+// handleProfileImage processes a multipart image upload into the given
+// variants, stores them and swaps the user's key, deleting the previous
+// renditions once the new ones are in place.
+func (cfg *apiConfig) handleProfileImage(
+	w http.ResponseWriter,
+	r *http.Request,
+	kind string,
+	variants []media.Variant,
+	save func(uuid.UUID, sql.NullString) (database.User, error),
+	current func(database.User) sql.NullString,
+) {
+	defer r.Body.Close()
+
+	type responseBody struct {
+		Images imageURLs `json:"images"`
+	}
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	data, err := readImageUpload(w, r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	renditions, err := media.ProcessImage(data, variants)
+	if err != nil {
+		respondWithImageError(w, r, err)
+		return
+	}
+
+	user, err := cfg.store.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.NotFound, err, "user not found"))
+		return
+	}
+
+	base := path.Join(kind, userID.String(), randomName())
+	for _, rendition := range renditions {
+		key := renditionKey(base, rendition.Variant.Name)
+		if err := cfg.blobs.Put(r.Context(), key, bytes.NewReader(rendition.Data), rendition.ContentType); err != nil {
+			cfg.deleteRenditions(r, base, variants)
+			respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't store image"))
+			return
+		}
+	}
+
+	if _, err := save(userID, sql.NullString{String: base, Valid: true}); err != nil {
+		cfg.deleteRenditions(r, base, variants)
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't save image"))
+		return
+	}
+
+	if old := current(user); old.Valid {
+		cfg.deleteRenditions(r, old.String, variants)
+	}
+
+	respondWithJson(w, http.StatusOK, responseBody{
+		Images: cfg.renditionURLs(base, variants),
+	})
+}
+
+func (cfg *apiConfig) handlerServeMedia(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+
+	blob, err := cfg.blobs.Get(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, media.ErrBlobNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't load media"))
+		return
+	}
+	defer blob.Close()
+
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// keys are random and never reused, so the content can be cached forever
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	if rs, ok := blob.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", time.Time{}, rs)
+		return
+	}
+	io.Copy(w, blob)
+}
+
+// readImageUpload returns the image field of a multipart upload. Its
+// errors are problems, since anything that goes wrong reading the
+// request is the client's.
+func readImageUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageUploadBytes)
+	if err := r.ParseMultipartForm(maxImageUploadBytes); err != nil {
+		return nil, uploadProblem(err)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile(imageFormField)
+	if err != nil {
+		return nil, uploadProblem(err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, uploadProblem(err)
+	}
+	return data, nil
+}
+
+func uploadProblem(err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return problem.Wrap(problem.PayloadTooLarge, err, "image is too large")
+	}
+	return problem.Wrap(problem.BadRequest, err, "expected a multipart form with an image field")
+}
+
+func (cfg *apiConfig) renditionURLs(base string, variants []media.Variant) imageURLs {
+	urls := imageURLs{}
+	for _, v := range variants {
+		urls[v.Name] = cfg.blobs.URL(renditionKey(base, v.Name))
+	}
+	return urls
+}
+
+func (cfg *apiConfig) deleteRenditions(r *http.Request, base string, variants []media.Variant) {
+	for _, v := range variants {
+		cfg.deleteBlobs(r.Context(), renditionKey(base, v.Name))
+	}
+}
+
+func (cfg *apiConfig) deleteBlobs(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := cfg.blobs.Delete(ctx, key); err != nil {
+			slog.ErrorContext(ctx, "blob store error", "key", key, "err", err)
+		}
+	}
+}
+
+// respondWithImageError reports an error from processing an uploaded
+// image. Anything but a rejected image is the server's fault.
+func respondWithImageError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, media.ErrUnsupportedImage):
+		respondWithError(w, r, problem.Wrap(problem.UnsupportedMediaType, err, "image must be a JPEG, PNG, GIF or WebP"))
+	case errors.Is(err, media.ErrImageTooLarge):
+		respondWithError(w, r, problem.Wrap(problem.PayloadTooLarge, err, "image dimensions are too large"))
+	case errors.Is(err, media.ErrImageTooSmall):
+		respondWithError(w, r, problem.Wrap(problem.ValidationFailed, err,
+			fmt.Sprintf("image must be at least %dx%d pixels", media.MinImageSize, media.MinImageSize)))
+	default:
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't process image"))
+	}
+}
+
+func renditionKey(base, variant string) string {
+	return base + "_" + variant + ".jpg"
+}
+
+func randomName() string {
+	data := make([]byte, 16)
+	rand.Read(data)
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// upload posts data to path as a multipart form with one file in field.
+func (c *apiClient) upload(path, authorization, field string, data []byte) (int, []byte) {
+	c.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile(field, "upload")
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req, err := http.NewRequest("POST", c.server.URL+path, &body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := c.server.Client().Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	dat, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp.StatusCode, dat
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadImageErrors(t *testing.T) {
+	c := newTestAPI(t)
+	alice := c.signup("alice@example.com")
+	img := testPNG(t, 64, 48)
+
+	tests := []struct {
+		name  string
+		field string
+		data  []byte
+		want  int
+	}{
+		{"too large", imageFormField, bytes.Repeat([]byte{0}, maxImageUploadBytes+1), http.StatusRequestEntityTooLarge},
+		{"not an image", imageFormField, []byte("just some text, not a picture"), http.StatusUnsupportedMediaType},
+		{"missing image field", "file", img, http.StatusBadRequest},
+	}
+	for _, path := range []string{"/api/users/avatar", "/api/users/banner", "/api/media"} {
+		for _, tt := range tests {
+			status, body := c.upload(path, alice.auth, tt.field, tt.data)
+			if status == http.StatusNotImplemented {
+				// uploads for chirps need Postgres
+				break
+			}
+			if status != tt.want {
+				t.Errorf("%s %s: %d %s, want %d", path, tt.name, status, body, tt.want)
+			}
+		}
+	}
+	// chirp attachments keep small images at their size
+	for _, path := range []string{"/api/users/avatar", "/api/users/banner"} {
+		if status, body := c.upload(path, alice.auth, imageFormField, testPNG(t, 1, 1)); status != http.StatusBadRequest {
+			t.Errorf("%s too small: %d %s, want 400", path, status, body)
+		}
+	}
+}
+
+func TestProfileImageReplacesRenditions(t *testing.T) {
+	c := newTestAPI(t)
+	alice := c.signup("alice@example.com")
+	img := testPNG(t, 64, 48)
+
+	for _, path := range []string{"/api/users/avatar", "/api/users/banner"} {
+		var urls [2]imageURLs
+		for i := range urls {
+			status, body := c.upload(path, alice.auth, imageFormField, img)
+			var resp struct {
+				Images imageURLs `json:"images"`
+			}
+			if err := json.Unmarshal(body, &resp); status != http.StatusOK || err != nil || len(resp.Images) == 0 {
+				t.Fatalf("%s: %d %s", path, status, body)
+			}
+			urls[i] = resp.Images
+		}
+
+		for name, url := range urls[0] {
+			if status, _ := c.do("GET", url, "", nil); status != http.StatusNotFound {
+				t.Errorf("%s: replaced %s rendition: %d, want 404", path, name, status)
+			}
+			if url == urls[1][name] || !strings.HasPrefix(url, "/media/") {
+				t.Errorf("%s: %s rendition URLs %q and %q, want two distinct media URLs", path, name, url, urls[1][name])
+			}
+		}
+		for name, url := range urls[1] {
+			if status, _ := c.do("GET", url, "", nil); status != http.StatusOK {
+				t.Errorf("%s: new %s rendition: %d, want 200", path, name, status)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+
+	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/metrics"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+)
+
+// appMetrics are the metrics exposed on /metrics.
+type appMetrics struct {
+	registry *metrics.Registry
+
+	requests        *metrics.CounterVec
+	requestDuration *metrics.HistogramVec
+	inFlight        *metrics.Gauge
+	requestsShed    *metrics.Counter
+	panics          *metrics.Counter
+	rateLimited     *metrics.CounterVec
+
+	fileserverHits *metrics.Counter
+	chirpsCreated  *metrics.Counter
+	chirpsDeleted  *metrics.Counter
+	usersCreated   *metrics.Counter
+	logins         *metrics.Counter
+	failedLogins   *metrics.CounterVec
+
+	webhookAttempts *metrics.CounterVec
+	jobRuns         *metrics.CounterVec
+	jobDuration     *metrics.HistogramVec
+}
+
+func newAppMetrics(db *sql.DB) *appMetrics {
+	r := metrics.NewRegistry()
+	m := &appMetrics{
+		registry: r,
+
+		requests: r.NewCounterVec("chirpy_http_requests_total",
+			"HTTP requests by route pattern, method and status class.", "route", "method", "status"),
+		requestDuration: r.NewHistogramVec("chirpy_http_request_duration_seconds",
+			"HTTP request latency by route pattern and method.", metrics.DefBuckets, "route", "method"),
+		inFlight: r.NewGauge("chirpy_http_requests_in_flight",
+			"HTTP requests currently being served."),
+		requestsShed: r.NewCounter("chirpy_http_requests_shed_total",
+			"Requests turned away with 503 because MAX_CONCURRENT_REQUESTS were already in flight."),
+		panics: r.NewCounter("chirpy_http_panics_total",
+			"Handler panics recovered."),
+		rateLimited: r.NewCounterVec("chirpy_http_rate_limited_total",
+			"Requests rejected with 429 by rate limit policy.", "policy"),
+
+		fileserverHits: r.NewCounter("chirpy_fileserver_hits_total",
+			"Requests served from /app/."),
+		chirpsCreated: r.NewCounter("chirpy_chirps_created_total",
+			"Chirps created."),
+		chirpsDeleted: r.NewCounter("chirpy_chirps_deleted_total",
+			"Chirps deleted by their author."),
+		usersCreated: r.NewCounter("chirpy_users_created_total",
+			"User accounts created."),
+		logins: r.NewCounter("chirpy_logins_total",
+			"Successful logins."),
+		failedLogins: r.NewCounterVec("chirpy_login_failures_total",
+			"Failed logins by reason.", "reason"),
+
+		webhookAttempts: r.NewCounterVec("chirpy_webhook_attempts_total",
+			"Webhook delivery attempts by outcome: delivered, retry or dead.", "outcome"),
+		jobRuns: r.NewCounterVec("chirpy_jobs_total",
+			"Background job runs by kind and outcome: succeeded, retried, failed or released.", "kind", "outcome"),
+		jobDuration: r.NewHistogramVec("chirpy_job_duration_seconds",
+			"Background job run time by kind.", metrics.DefBuckets, "kind"),
+	}
+
+	if db != nil {
+		stats := func(fn func(sql.DBStats) float64) func() float64 {
+			return func() float64 { return fn(db.Stats()) }
+		}
+		r.NewGaugeFunc("chirpy_db_max_open_connections", "Maximum number of open connections to the database.",
+			stats(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+		r.NewGaugeFunc("chirpy_db_open_connections", "Established connections, both in use and idle.",
+			stats(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+		r.NewGaugeFunc("chirpy_db_in_use_connections", "Connections currently in use.",
+			stats(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+		r.NewGaugeFunc("chirpy_db_idle_connections", "Idle connections.",
+			stats(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+		r.NewCounterFunc("chirpy_db_wait_count_total", "Connections waited for.",
+			stats(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+		r.NewCounterFunc("chirpy_db_wait_duration_seconds_total", "Time spent waiting for a connection.",
+			stats(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+		r.NewCounterFunc("chirpy_db_max_idle_closed_total", "Connections closed due to SetMaxIdleConns.",
+			stats(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+		r.NewCounterFunc("chirpy_db_max_lifetime_closed_total", "Connections closed due to SetConnMaxLifetime.",
+			stats(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+	}
+
+	return m
+}
+
+// handlerMetrics serves the Prometheus text format. When METRICS_TOKEN is
+// set scrapers must send it as a bearer token; otherwise only admins can
+// read the metrics.
+func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
+	serve := cfg.metrics.registry.Handler().ServeHTTP
+	if cfg.metricsToken == "" {
+		cfg.middlewareRequireRole(auth.RoleAdmin, serve)(w, r)
+		return
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.metricsToken)) != 1 {
+		respondWithError(w, r, problem.New(problem.Unauthorized, "invalid token"))
+		return
+	}
+	serve(w, r)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/jwoodsiii/chirpy/internal/logging"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+	// loadShedRetryAfter is the Retry-After, in seconds, sent with a 503
+	// when the server is at MaxConcurrentRequests.
+	loadShedRetryAfter = "1"
+)
+
+// responseRecorder captures the status code written by a handler. Unwrap
+// lets http.ResponseController reach the underlying writer for flushing.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+func (rec *responseRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// middlewareInstrument records request counts, latency and in-flight
+// requests for every route. It must wrap the ServeMux itself: the mux sets
+// r.Pattern on the request it is handed, which is how unmatched requests are
+// kept from exploding the route label.
+func (cfg *apiConfig) middlewareInstrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := cfg.metrics
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		m.requests.With(route, r.Method, statusClass(rec.statusCode())).Inc()
+		m.requestDuration.With(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// middlewareRequestLogging assigns every request an ID, echoed back in the
+// X-Request-ID header and attached to everything logged with the request
+// context, then writes one access log line once the handler returns. A
+// well-formed X-Request-ID from the client is reused so requests can be
+// traced across services.
+func middlewareRequestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		info := &logging.RequestInfo{ID: id}
+		r = r.WithContext(logging.WithRequestInfo(r.Context(), info))
+
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.statusCode()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("route", r.Pattern),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int("bytes", rec.bytes),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
+
+// middlewareRecover turns a panicking handler into a 500 problem response
+// instead of a dropped connection, and logs the panic with its stack. If the
+// handler had already started its response, all that can be done is log.
+func (cfg *apiConfig) middlewareRecover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				// the handler wants the connection dropped, see net/http
+				panic(v)
+			}
+
+			cfg.metrics.panics.Inc()
+			slog.ErrorContext(r.Context(), "handler panicked", "panic", v, "stack", string(debug.Stack()))
+			if rec.status == 0 {
+				respondWithError(w, r, problem.Wrap(problem.Internal, fmt.Errorf("panic: %v", v), "an unexpected error occurred"))
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// middlewareTimeout gives next a context that expires after d, so database
+// calls still running at the deadline fail and the client gets a 503. A
+// zero d leaves the request unbounded.
+func middlewareTimeout(d time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	if d <= 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// middlewareLimitConcurrency serves at most limit requests at a time and
+// answers the rest with 503 and Retry-After rather than queueing them, so
+// an overloaded server sheds load instead of falling further behind.
+// Health probes and /metrics are never shed, so the orchestrator doesn't
+// restart a busy instance. Event streams don't count either: they stay
+// open, and STREAM_MAX_CLIENTS caps them instead. A limit of zero
+// disables the check.
+func (cfg *apiConfig) middlewareLimitConcurrency(limit int, next http.Handler) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+	slots := make(chan struct{}, limit)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isProbe(r) || isStream(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			next.ServeHTTP(w, r)
+		default:
+			cfg.metrics.requestsShed.Inc()
+			w.Header().Set("Retry-After", loadShedRetryAfter)
+			respondWithError(w, r, problem.New(problem.Unavailable, "the server is busy, try again shortly"))
+		}
+	})
+}
+
+func isProbe(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/api/livez", "/api/readyz", "/api/healthz", "/metrics":
+		return true
+	}
+	return false
+}
+
+// validRequestID only accepts short IDs of printable, non-space ASCII so a
+// client can't inject anything odd into logs or response headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func statusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
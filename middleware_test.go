@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jwoodsiii/chirpy/internal/problem"
+)
+
+func TestMiddlewareRecover(t *testing.T) {
+	cfg := &apiConfig{metrics: newAppMetrics(nil)}
+	h := middlewareRequestLogging(cfg.middlewareRecover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/chirps", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	var body problem.Details
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.RequestID == "" || body.RequestID != w.Header().Get(requestIDHeader) {
+		t.Errorf("request_id = %q, want the X-Request-ID header %q", body.RequestID, w.Header().Get(requestIDHeader))
+	}
+	if got := cfg.metrics.panics.Value(); got != 1 {
+		t.Errorf("panics = %v, want 1", got)
+	}
+}
+
+func TestMiddlewareRecoverAfterWrite(t *testing.T) {
+	cfg := &apiConfig{metrics: newAppMetrics(nil)}
+	h := cfg.middlewareRecover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusAccepted || w.Body.Len() != 0 {
+		t.Errorf("got %d %q, want the handler's 202 left alone", w.Code, w.Body)
+	}
+}
+
+func TestMiddlewareTimeout(t *testing.T) {
+	h := middlewareTimeout(10*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		respondWithError(w, r, problem.Wrap(problem.Internal, r.Context().Err(), "couldn't list chirps"))
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/chirps", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+}
+
+func TestMiddlewareLimitConcurrency(t *testing.T) {
+	cfg := &apiConfig{metrics: newAppMetrics(nil)}
+	started, release := make(chan struct{}), make(chan struct{})
+	h := cfg.middlewareLimitConcurrency(1, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+		close(done)
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/chirps", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("got %d with Retry-After %q, want 503 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/livez", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("livez status = %d, want probes to bypass the limit", w.Code)
+	}
+
+	close(release)
+	<-done
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/chirps", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status after release = %d, want 200", w.Code)
+	}
+}
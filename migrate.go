@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jwoodsiii/chirpy/internal/config"
+	"github.com/jwoodsiii/chirpy/internal/migrate"
+)
+
+const migrateUsage = "usage: chirpy migrate up|down|status|redo"
+
+// openDB connects to the backend and pings it, since sql.Open only
+// validates its arguments.
+func openDB(b backend) (*sql.DB, error) {
+	db, err := sql.Open(b.driver, b.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// runMigrateCommand implements `chirpy migrate`. It only needs DB_URL, so
+// the rest of the configuration isn't validated.
+func runMigrateCommand(configPath string, args []string) error {
+	if len(args) != 1 || !slices.Contains([]string{"up", "down", "status", "redo"}, args[0]) {
+		return errors.New(migrateUsage)
+	}
+
+	conf, err := config.Parse(configPath, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	if conf.DatabaseURL == "" {
+		return errors.New("DB_URL is required")
+	}
+
+	b := parseDatabaseURL(conf.DatabaseURL)
+	db, err := openDB(b)
+	if err != nil {
+		return fmt.Errorf("database is unreachable: %w", err)
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, b.dialect, b.schema)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		ran, err := m.Up(ctx)
+		for _, mig := range ran {
+			fmt.Printf("applied %s\n", mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(ran) == 0 {
+			fmt.Println("already up to date")
+		}
+	case "down":
+		mig, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %s\n", mig.Name)
+	case "redo":
+		mig, err := m.Redo(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("redid %s\n", mig.Name)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "MIGRATION\tAPPLIED AT")
+		for _, st := range statuses {
+			appliedAt := "pending"
+			if st.Applied {
+				appliedAt = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", st.Name, appliedAt)
+		}
+		return tw.Flush()
+	}
+	return nil
+}
+
+// prepareSchema applies pending migrations when asked to and then refuses
+// to start against a schema this build doesn't match.
+func prepareSchema(ctx context.Context, m *migrate.Migrator, migrateOnStart bool) error {
+	if migrateOnStart {
+		ran, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, mig := range ran {
+			slog.InfoContext(ctx, "Applied migration", "migration", mig.Name)
+		}
+	}
+
+	err := m.Check(ctx)
+	if errors.Is(err, migrate.ErrPending) {
+		return fmt.Errorf("%w; run `chirpy migrate up` or set MIGRATE_ON_START", err)
+	}
+	return err
+}
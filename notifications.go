@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/hub"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+	"github.com/jwoodsiii/chirpy/internal/validate"
+)
+
+const (
+	notificationChirpRemoved     = "chirp_removed"
+	notificationAccountSuspended = "account_suspended"
+	notificationReportReviewed   = "report_reviewed"
+	notificationChirpyRed        = "chirpy_red"
+
+	eventNotificationCreated = notificationEventPrefix + "created"
+	eventNotificationUpdated = notificationEventPrefix + "updated"
+)
+
+// notificationTypes lists every type with how it reads on its own and,
+// if it reads differently, when several events have been grouped into one
+// notification. Users can turn each of them off.
+var notificationTypes = []struct {
+	name      string
+	one, many string
+}{
+	{notificationChirpRemoved, "A moderator removed your chirp", "Moderators removed %d of your chirps"},
+	{notificationAccountSuspended, "Your account has been suspended", ""},
+	{notificationReportReviewed, "A moderator reviewed your report", "Moderators reviewed %d of your reports"},
+	{notificationChirpyRed, "Welcome to Chirpy Red", ""},
+}
+
+type Notification struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Type      string    `json:"type"`
+	Message   string    `json:"message"`
+	// Count is how many events were grouped into the notification.
+	Count     int        `json:"count"`
+	SubjectID *uuid.UUID `json:"subject_id"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+type NotificationPreference struct {
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+}
+
+// notification is something to tell a user about. While a notification is
+// unread, later ones with the same group are merged into it, so removing
+// three chirps makes one "Moderators removed 3 of your chirps". A key the
+// user has been notified of before, whether or not they have read it, is
+// a repeat of the same event and is ignored.
+type notification struct {
+	userID  uuid.UUID
+	typ     string
+	group   string
+	key     string
+	subject uuid.NullUUID
+}
+
+// notify records n with q, which may be a transaction. ok is false when n
+// was a repeat or the user has turned its type off, and when q is nil for
+// a store without notifications. Publish the result with
+// publishNotification once it is committed.
+func notify(ctx context.Context, q *database.Queries, n notification) (_ database.Notification, ok bool, err error) {
+	if q == nil {
+		return database.Notification{}, false, nil
+	}
+	dbNotification, err := q.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:    n.userID,
+		Type:      n.typ,
+		GroupKey:  n.group,
+		EventKey:  n.key,
+		SubjectID: n.subject,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Notification{}, false, nil
+	}
+	if err != nil {
+		return database.Notification{}, false, fmt.Errorf("notify %s: %w", n.typ, err)
+	}
+	return dbNotification, true, nil
+}
+
+// publishNotification sends n to its recipient's notifications channel.
+func (cfg *apiConfig) publishNotification(n database.Notification) {
+	typ := eventNotificationCreated
+	if len(n.EventKeys) > 1 {
+		typ = eventNotificationUpdated
+	}
+	cfg.publish(hub.Event{Type: typ, UserID: n.UserID}, notificationFromDB(n))
+}
+
+func (cfg *apiConfig) handlerListNotifications(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type responseBody struct {
+		Notifications []Notification `json:"notifications"`
+		UnreadCount   int64          `json:"unread_count"`
+	}
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var dbNotifications []database.Notification
+	switch r.URL.Query().Get("unread") {
+	case "", "false":
+		dbNotifications, err = cfg.db.ListNotifications(r.Context(), database.ListNotificationsParams{
+			UserID: userID,
+			Limit:  limit,
+			Offset: offset,
+		})
+	case "true":
+		dbNotifications, err = cfg.db.ListUnreadNotifications(r.Context(), database.ListUnreadNotificationsParams{
+			UserID: userID,
+			Limit:  limit,
+			Offset: offset,
+		})
+	default:
+		respondWithError(w, r, problem.New(problem.ValidationFailed, "unread must be true or false"))
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't retrieve notifications"))
+		return
+	}
+
+	unread, err := cfg.db.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't retrieve notifications"))
+		return
+	}
+
+	notifications := []Notification{}
+	for _, n := range dbNotifications {
+		notifications = append(notifications, notificationFromDB(n))
+	}
+	respondWithJson(w, http.StatusOK, responseBody{
+		Notifications: notifications,
+		UnreadCount:   unread,
+	})
+}
+
+func (cfg *apiConfig) handlerMarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type requestBody struct {
+		IDs []uuid.UUID `json:"ids" validate:"max=200"`
+		// All marks every notification read, whatever IDs says.
+		All bool `json:"all"`
+	}
+
+	type responseBody struct {
+		UnreadCount int64 `json:"unread_count"`
+	}
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var params requestBody
+	if err := decodeJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if !params.All && len(params.IDs) == 0 {
+		respondWithError(w, r, problem.Wrap(problem.ValidationFailed,
+			validate.Errors{{Field: "ids", Message: "is required unless all is true"}},
+			"name the notifications to mark read, or set all"))
+		return
+	}
+
+	if params.All {
+		_, err = cfg.db.MarkAllNotificationsRead(r.Context(), userID)
+	} else {
+		_, err = cfg.db.MarkNotificationsRead(r.Context(), database.MarkNotificationsReadParams{
+			UserID: userID,
+			Ids:    params.IDs,
+		})
+	}
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't mark notifications read"))
+		return
+	}
+
+	unread, err := cfg.db.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't mark notifications read"))
+		return
+	}
+	respondWithJson(w, http.StatusOK, responseBody{UnreadCount: unread})
+}
+
+func (cfg *apiConfig) handlerGetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	dbPreferences, err := cfg.db.ListNotificationPreferences(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't retrieve notification preferences"))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, notificationPreferences(dbPreferences))
+}
+
+// notificationPreferences lists every type with whether it is enabled.
+// Types without a saved preference are on, and saved ones for types that
+// no longer exist are left out.
+func notificationPreferences(saved []database.NotificationPreference) []NotificationPreference {
+	disabled := map[string]bool{}
+	for _, p := range saved {
+		disabled[p.Type] = !p.Enabled
+	}
+	preferences := []NotificationPreference{}
+	for _, t := range notificationTypes {
+		preferences = append(preferences, NotificationPreference{Type: t.name, Enabled: !disabled[t.name]})
+	}
+	return preferences
+}
+
+func (cfg *apiConfig) handlerPutNotificationPreference(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type requestBody struct {
+		Enabled *bool `json:"enabled" validate:"required"`
+	}
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	typ := r.PathValue("type")
+	if !isNotificationType(typ) {
+		respondWithError(w, r, problem.Newf(problem.NotFound, "there is no %q notification type", typ))
+		return
+	}
+
+	var params requestBody
+	if err := decodeJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if err := cfg.db.SetNotificationPreference(r.Context(), database.SetNotificationPreferenceParams{
+		UserID:  userID,
+		Type:    typ,
+		Enabled: *params.Enabled,
+	}); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't save notification preference"))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, NotificationPreference{Type: typ, Enabled: *params.Enabled})
+}
+
+func isNotificationType(name string) bool {
+	for _, t := range notificationTypes {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// notificationMessage words a notification of typ grouping count events.
+func notificationMessage(typ string, count int) string {
+	for _, t := range notificationTypes {
+		if t.name != typ {
+			continue
+		}
+		if count == 1 || t.many == "" {
+			return t.one
+		}
+		return fmt.Sprintf(t.many, count)
+	}
+	return typ
+}
+
+func notificationFromDB(n database.Notification) Notification {
+	return Notification{
+		ID:        n.ID,
+		CreatedAt: n.CreatedAt,
+		UpdatedAt: n.UpdatedAt,
+		Type:      n.Type,
+		Message:   notificationMessage(n.Type, len(n.EventKeys)),
+		Count:     len(n.EventKeys),
+		SubjectID: nullUUIDPtr(n.SubjectID),
+		ReadAt:    nullTimePtr(n.ReadAt),
+	}
+}
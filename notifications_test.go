@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/database"
+)
+
+func TestNotifications(t *testing.T) {
+	c := newTestAPI(t)
+	alice := c.signup("alice@example.com")
+	if status, _ := c.do("GET", "/api/notifications", alice.auth, nil); status == http.StatusNotImplemented {
+		t.Skip("notifications need Postgres")
+	}
+	bob := c.signup("bob@example.com")
+	admin := c.mustDo("POST", "/api/login", "", map[string]string{"email": testAdminEmail, "password": testAdminPassword})
+	adminAuth := bearer(admin["token"])
+
+	ws := c.websocket(alice)
+	ws.send(`{"type": "subscribe", "id": "1", "channel": "notifications"}`)
+	if got := ws.next(); got.Type != "ack" {
+		t.Fatalf("subscribe reply = %+v, want ack", got)
+	}
+
+	// two chirps removed while the first notice is unread make one group
+	for _, body := range []string{"first", "second"} {
+		chirp := c.mustDo("POST", "/api/chirps", alice.auth, map[string]string{"body": body})
+		report := c.mustDo("POST", "/api/chirps/"+chirp["id"].(string)+"/report", bob.auth, map[string]string{"reason": "spam"})
+		c.mustDo("POST", "/admin/reports/"+report["id"].(string)+"/resolve", adminAuth, map[string]string{"action": "delete_chirp"})
+	}
+	for _, want := range []string{eventNotificationCreated, eventNotificationUpdated} {
+		if got := ws.next(); got.Event != want || got.Channel != "notifications" {
+			t.Errorf("event = %+v, want %s", got, want)
+		}
+	}
+
+	// Polka retrying a delivery doesn't notify twice
+	upgrade := map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": alice.id}}
+	c.mustDo("POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey, upgrade)
+	c.mustDo("POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey, upgrade)
+
+	list := c.mustDo("GET", "/api/notifications", alice.auth, nil)
+	notifications := list["notifications"].([]any)
+	if len(notifications) != 2 || list["unread_count"] != 2.0 {
+		t.Fatalf("alice's notifications = %v, want 2 unread", list)
+	}
+	if n := notifications[0].(map[string]any); n["type"] != notificationChirpyRed {
+		t.Errorf("newest notification = %v, want chirpy_red", n)
+	}
+	removed := notifications[1].(map[string]any)
+	if removed["count"] != 2.0 || removed["message"] != "Moderators removed 2 of your chirps" {
+		t.Errorf("grouped notification = %v, want 2 removed chirps", removed)
+	}
+
+	read := c.mustDo("POST", "/api/notifications/read", alice.auth, map[string]any{"ids": []any{removed["id"]}})
+	if read["unread_count"] != 1.0 {
+		t.Errorf("after marking one read unread_count = %v, want 1", read["unread_count"])
+	}
+	if status, _ := c.do("POST", "/api/notifications/read", alice.auth, map[string]any{}); status != http.StatusBadRequest {
+		t.Errorf("marking nothing read: %d, want 400", status)
+	}
+
+	// nor once the first one has been read
+	c.mustDo("POST", "/api/notifications/read", alice.auth, map[string]bool{"all": true})
+	c.mustDo("POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey, upgrade)
+	if list := c.mustDo("GET", "/api/notifications?unread=true", alice.auth, nil); list["unread_count"] != 0.0 {
+		t.Errorf("after a retried upgrade alice's notifications = %v, want none unread", list)
+	}
+
+	// bob turns off report outcomes, so the next one isn't recorded
+	c.mustDo("PUT", "/api/notifications/preferences/"+notificationReportReviewed, bob.auth, map[string]bool{"enabled": false})
+	if status, _ := c.do("PUT", "/api/notifications/preferences/likes", bob.auth, map[string]bool{"enabled": false}); status != http.StatusNotFound {
+		t.Errorf("unknown type: %d, want 404", status)
+	}
+	c.mustDo("POST", "/api/notifications/read", bob.auth, map[string]bool{"all": true})
+	chirp := c.mustDo("POST", "/api/chirps", alice.auth, map[string]string{"body": "third"})
+	report := c.mustDo("POST", "/api/chirps/"+chirp["id"].(string)+"/report", bob.auth, map[string]string{"reason": "spam"})
+	c.mustDo("POST", "/admin/reports/"+report["id"].(string)+"/resolve", adminAuth, map[string]string{"action": "dismiss"})
+	if list := c.mustDo("GET", "/api/notifications?unread=true", bob.auth, nil); list["unread_count"] != 0.0 {
+		t.Errorf("bob's notifications = %v, want none unread", list)
+	}
+}
+
+func TestNotificationMessage(t *testing.T) {
+	tests := []struct {
+		typ   string
+		count int
+		want  string
+	}{
+		{notificationChirpRemoved, 1, "A moderator removed your chirp"},
+		{notificationChirpRemoved, 3, "Moderators removed 3 of your chirps"},
+		{notificationChirpyRed, 2, "Welcome to Chirpy Red"},
+		{"unknown", 1, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := notificationMessage(tt.typ, tt.count); got != tt.want {
+			t.Errorf("notificationMessage(%q, %d) = %q, want %q", tt.typ, tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	got := notificationPreferences([]database.NotificationPreference{
+		{Type: notificationReportReviewed, Enabled: false},
+		{Type: notificationChirpyRed, Enabled: true},
+		{Type: "retired", Enabled: false},
+	})
+	want := []NotificationPreference{
+		{notificationChirpRemoved, true},
+		{notificationAccountSuspended, true},
+		{notificationReportReviewed, false},
+		{notificationChirpyRed, true},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("notificationPreferences() = %v, want %v", got, want)
+	}
+}
+
+func TestResolutionNotices(t *testing.T) {
+	reporter, author := uuid.New(), uuid.New()
+	chirp := uuid.NullUUID{UUID: uuid.New(), Valid: true}
+	report := database.Report{ID: uuid.New(), ReporterID: uuid.NullUUID{UUID: reporter, Valid: true}, ChirpAuthorID: author, ChirpID: chirp}
+
+	reviewed := notification{userID: reporter, typ: notificationReportReviewed, group: notificationReportReviewed, key: report.ID.String(), subject: chirp}
+	tests := []struct {
+		name    string
+		report  database.Report
+		action  string
+		removed int64
+		want    []notification
+	}{
+		{"dismissed", report, moderationDismiss, 0, []notification{reviewed}},
+		{"chirp deleted", report, moderationDeleteChirp, 1, []notification{
+			reviewed,
+			{userID: author, typ: notificationChirpRemoved, group: notificationChirpRemoved, key: chirp.UUID.String(), subject: chirp},
+		}},
+		// the author deleted it first, so there is nothing to tell them
+		{"chirp already gone", report, moderationDeleteChirp, 0, []notification{reviewed}},
+		{"suspended", report, moderationSuspendUser, 0, []notification{
+			reviewed,
+			{userID: author, typ: notificationAccountSuspended, group: notificationAccountSuspended, key: report.ID.String()},
+		}},
+		{"banned", report, moderationBanUser, 0, []notification{reviewed}},
+		{"reporter deleted", database.Report{ID: report.ID, ChirpAuthorID: author, ChirpID: chirp}, moderationDismiss, 0, nil},
+	}
+	for _, tt := range tests {
+		if got := resolutionNotices(tt.report, tt.action, tt.removed); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: resolutionNotices() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
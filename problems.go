@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/media"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+	"github.com/jwoodsiii/chirpy/internal/store"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func init() {
+	problem.Register(problemFor)
+}
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqForeignKeyViolation = "23503"
+	pqUniqueViolation     = "23505"
+	pqCheckViolation      = "23514"
+)
+
+// problemFor maps the errors of the stores, their drivers, auth and media
+// to problems, for package problem, which doesn't import them.
+func problemFor(err error) *problem.Error {
+	var pqErr *pq.Error
+	var sqliteErr *sqlite.Error
+	switch {
+	case errors.Is(err, media.ErrBlobNotFound):
+		return problem.Wrap(problem.NotFound, err, "resource not found")
+	case errors.Is(err, store.ErrConstraint):
+		return problem.Wrap(problem.Conflict, err, "the request conflicts with existing data")
+	case errors.As(err, &pqErr) && (pqErr.Code == pqUniqueViolation || pqErr.Code == pqForeignKeyViolation || pqErr.Code == pqCheckViolation):
+		return problem.Wrap(problem.Conflict, err, "the request conflicts with existing data")
+	// SQLite's extended result codes keep the primary code in the low byte.
+	case errors.As(err, &sqliteErr) && sqliteErr.Code()&0xff == sqlite3.SQLITE_CONSTRAINT:
+		return problem.Wrap(problem.Conflict, err, "the request conflicts with existing data")
+	case errors.Is(err, auth.ErrNoAuthHeaderIncluded):
+		return problem.Wrap(problem.Unauthorized, err, "missing Authorization header")
+	case errors.Is(err, media.ErrUnsupportedImage):
+		return problem.Wrap(problem.UnsupportedMediaType, err, "unsupported image type")
+	case errors.Is(err, media.ErrImageTooLarge):
+		return problem.Wrap(problem.PayloadTooLarge, err, "image dimensions too large")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/media"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+	"github.com/jwoodsiii/chirpy/internal/store"
+	"github.com/lib/pq"
+)
+
+func TestProblemFor(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want problem.Code
+	}{
+		{"memory constraint", store.ErrConstraint, problem.Conflict},
+		{"postgres unique violation", fmt.Errorf("create user: %w", &pq.Error{Code: "23505"}), problem.Conflict},
+		{"postgres other error", &pq.Error{Code: "42P01"}, problem.Internal},
+		{"missing blob", media.ErrBlobNotFound, problem.NotFound},
+		{"no auth header", auth.ErrNoAuthHeaderIncluded, problem.Unauthorized},
+		{"unsupported image", media.ErrUnsupportedImage, problem.UnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		if got := problem.CodeOf(tt.err); got != tt.want {
+			t.Errorf("%s: CodeOf() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
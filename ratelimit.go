@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jwoodsiii/chirpy/internal/problem"
+	"github.com/jwoodsiii/chirpy/internal/ratelimit"
+)
+
+// rateLimitPolicy is the limit on one group of routes. Routes sharing a
+// policy share its buckets.
+type rateLimitPolicy struct {
+	name string
+	// byUser keys the bucket on the authenticated user when the request
+	// has a valid access token; otherwise, and always when false, on the
+	// client IP.
+	byUser bool
+	limit  ratelimit.Limit
+	// red replaces limit for Chirpy Red members if set.
+	red ratelimit.Limit
+}
+
+var (
+	loginRateLimit   = rateLimitPolicy{name: "login", limit: ratelimit.Limit{Requests: 10, Per: time.Minute}}
+	signupRateLimit  = rateLimitPolicy{name: "signup", limit: ratelimit.Limit{Requests: 10, Per: time.Hour}}
+	refreshRateLimit = rateLimitPolicy{name: "refresh", limit: ratelimit.Limit{Requests: 60, Per: time.Minute}}
+	chirpRateLimit   = rateLimitPolicy{
+		name:   "chirps",
+		byUser: true,
+		limit:  ratelimit.Limit{Requests: 10, Per: time.Minute},
+		red:    ratelimit.Limit{Requests: 30, Per: time.Minute},
+	}
+	uploadRateLimit = rateLimitPolicy{
+		name:   "uploads",
+		byUser: true,
+		limit:  ratelimit.Limit{Requests: 20, Per: time.Hour},
+		red:    ratelimit.Limit{Requests: 60, Per: time.Hour},
+	}
+	reportRateLimit = rateLimitPolicy{name: "reports", byUser: true, limit: ratelimit.Limit{Requests: 20, Per: time.Hour}}
+)
+
+// middlewareRateLimit applies p to next. Every response carries the
+// RateLimit-* headers from the IETF RateLimit fields draft so clients can
+// pace themselves; rejected requests get a 429 with Retry-After. With rate
+// limiting disabled it returns next unchanged.
+func (cfg *apiConfig) middlewareRateLimit(p rateLimitPolicy, next http.HandlerFunc) http.HandlerFunc {
+	if cfg.rateLimits == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, limit := cfg.rateLimitKey(r, p)
+		res, err := cfg.rateLimits.Take(r.Context(), p.name+":"+key, limit)
+		if err != nil {
+			// a broken limiter shouldn't take the API down with it
+			slog.WarnContext(r.Context(), "rate limiter unavailable, allowing request", "policy", p.name, "err", err)
+			next(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Per.Seconds())))
+		if !res.Allowed {
+			cfg.metrics.rateLimited.With(p.name).Inc()
+			h.Set("Retry-After", ceilSeconds(res.RetryAfter))
+			respondWithError(w, r, problem.New(problem.TooManyRequests, "too many requests, slow down"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// rateLimitKey picks the bucket and limit for r under p.
+func (cfg *apiConfig) rateLimitKey(r *http.Request, p rateLimitPolicy) (string, ratelimit.Limit) {
+	if p.byUser {
+		if userID, err := cfg.authenticate(r); err == nil {
+			if p.red.Requests > 0 {
+				if user, err := cfg.store.GetUser(r.Context(), userID); err == nil && user.IsChirpyRed {
+					return "user:" + userID.String(), p.red
+				}
+			}
+			return "user:" + userID.String(), p.limit
+		}
+	}
+	return "ip:" + clientIP(r, cfg.trustedProxies), p.limit
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// clientIP returns the address of the client that sent r. RemoteAddr is the
+// peer that connected to us; only when that is a trusted proxy is
+// X-Forwarded-For consulted, read from the right, and the first address not
+// belonging to a trusted proxy is the client. Entries further left were
+// written by the client itself and can't be believed.
+func clientIP(r *http.Request, trusted []netip.Prefix) string {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	addr := peer.Addr().Unmap()
+	if !isTrustedProxy(addr, trusted) {
+		return addr.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// a proxy we trust wrote garbage; stop at the last good hop
+			break
+		}
+		addr = hop.Unmap()
+		if !isTrustedProxy(addr, trusted) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+func isTrustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
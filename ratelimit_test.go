@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/config"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/ratelimit"
+	"github.com/jwoodsiii/chirpy/internal/store"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer can't spoof", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"behind proxy", "10.0.0.2:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"client-supplied hops ignored", "10.0.0.2:5000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:5000", []string{"198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"split headers", "10.0.0.2:5000", []string{"198.51.100.1", "10.0.0.3"}, "198.51.100.1"},
+		{"proxy without header", "10.0.0.2:5000", nil, "10.0.0.2"},
+		{"garbage hop", "10.0.0.2:5000", []string{"198.51.100.1, bogus"}, "10.0.0.2"},
+		{"ipv4-mapped peer", "[::ffff:203.0.113.7]:5000", nil, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(r, trusted); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRateLimit(t *testing.T) {
+	conf := config.Default()
+	conf.JWTSecret = "test-secret"
+	st := store.NewMemory()
+	cfg := newAPIConfig(conf, st, nil, nil, nil)
+
+	ctx := context.Background()
+	member, err := st.CreateUser(ctx, database.CreateUserParams{Email: "red@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.UpgradeUser(ctx, member.ID); err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.MakeJWT(member.ID, conf.JWTSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := rateLimitPolicy{
+		name:   "test",
+		byUser: true,
+		limit:  ratelimit.Limit{Requests: 1, Per: time.Minute},
+		red:    ratelimit.Limit{Requests: 2, Per: time.Minute},
+	}
+	h := cfg.middlewareRateLimit(policy, func(w http.ResponseWriter, r *http.Request) {})
+	send := func(authorization string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/chirps", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	w := send("")
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("first anonymous request: %d %v", w.Code, w.Header())
+	}
+	w = send("")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("second anonymous request: %d with Retry-After %q, want 429 and 60", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// the Chirpy Red member has their own, larger bucket
+	for i := range 2 {
+		if w := send("Bearer " + token); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("member request %d: %d with limit %q, want 200 and 2", i+1, w.Code, w.Header().Get("RateLimit-Limit"))
+		}
+	}
+	if w := send("Bearer " + token); w.Code != http.StatusTooManyRequests {
+		t.Errorf("third member request: %d, want 429", w.Code)
+	}
+}
@@ -1,9 +1,43 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+	"time"
 
-func handlerReadiness(w http.ResponseWriter, r *http.Request) {
+	"github.com/jwoodsiii/chirpy/internal/media"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+// handlerLivez reports that the process is up and serving requests. It
+// deliberately checks nothing else so a database outage doesn't get the
+// process restarted.
+func handlerLivez(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(http.StatusText(http.StatusOK)))
 }
+
+// handlerReadyz reports whether this instance should receive traffic,
+// with the result of each check.
+func (cfg *apiConfig) handlerReadyz(w http.ResponseWriter, r *http.Request) {
+	report := cfg.health.Check(r.Context())
+	code := http.StatusOK
+	if !report.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, code, report)
+}
+
+func (cfg *apiConfig) registerHealthChecks() {
+	if cfg.conn != nil {
+		cfg.health.Add("database", cfg.conn.PingContext)
+	}
+	if cfg.migrator != nil {
+		cfg.health.Add("migrations", cfg.migrator.Check)
+	}
+	if p, ok := cfg.blobs.(media.Pinger); ok {
+		cfg.health.Add("blob_store", p.Ping)
+	}
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultSuspension = 7 * 24 * time.Hour
+	defaultPageSize   = 50
+	maxPageSize       = 200
+)
+
+const (
+	moderationTriage      = "triage"
+	moderationDismiss     = "dismiss"
+	moderationDeleteChirp = "delete_chirp"
+	moderationSuspendUser = "suspend_user"
+	moderationBanUser     = "ban_user"
+)
+
+type Report struct {
+	ID            uuid.UUID  `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	ReporterID    *uuid.UUID `json:"reporter_id"`
+	ChirpID       *uuid.UUID `json:"chirp_id"`
+	ChirpAuthorID uuid.UUID  `json:"chirp_author_id"`
+	ChirpBody     string     `json:"chirp_body"`
+	Reason        string     `json:"reason"`
+	Details       string     `json:"details"`
+	Status        string     `json:"status"`
+	AssignedTo    *uuid.UUID `json:"assigned_to"`
+	Resolution    *string    `json:"resolution"`
+	ResolvedBy    *uuid.UUID `json:"resolved_by"`
+	ResolvedAt    *time.Time `json:"resolved_at"`
+}
+
+type ModerationAction struct {
+	ID            uuid.UUID  `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ModeratorID   *uuid.UUID `json:"moderator_id"`
+	ReportID      *uuid.UUID `json:"report_id"`
+	Action        string     `json:"action"`
+	TargetUserID  *uuid.UUID `json:"target_user_id"`
+	TargetChirpID *uuid.UUID `json:"target_chirp_id"`
+	Note          string     `json:"note"`
+}
+
+func (cfg *apiConfig) handlerReportChirp(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type requestBody struct {
+		Reason  string `json:"reason" validate:"required,oneof=spam harassment hate violence sexual_content self_harm misinformation other"`
+		Details string `json:"details" validate:"max=1000"`
+	}
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	chirpID, err := pathUUID(r, "chirpID")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var params requestBody
+	if err := decodeJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	details := strings.TrimSpace(params.Details)
+
+	chirp, err := cfg.store.GetChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, problem.Wrap(problem.NotFound, err, "chirp not found"))
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't report chirp"))
+		return
+	}
+
+	if chirp.UserID == userID {
+		respondWithError(w, r, problem.New(problem.ValidationFailed, "you can't report your own chirp"))
+		return
+	}
+
+	report, err := cfg.db.CreateReport(r.Context(), database.CreateReportParams{
+		ReporterID:    uuid.NullUUID{UUID: userID, Valid: true},
+		ChirpID:       uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		ChirpAuthorID: chirp.UserID,
+		ChirpBody:     chirp.Body,
+		Reason:        params.Reason,
+		Details:       details,
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			respondWithError(w, r, problem.New(problem.Conflict, "you have already reported this chirp"))
+			return
+		}
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't create report"))
+		return
+	}
+
+	respondWithJson(w, http.StatusCreated, reportFromDB(report))
+}
+
+func (cfg *apiConfig) handlerListReports(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = "open"
+	case "open", "triaged", "resolved":
+	default:
+		respondWithError(w, r, problem.New(problem.ValidationFailed, "status must be open, triaged or resolved"))
+		return
+	}
+
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	dbReports, err := cfg.db.ListReportsByStatus(r.Context(), database.ListReportsByStatusParams{
+		Status: status,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't retrieve reports"))
+		return
+	}
+
+	reports := []Report{}
+	for _, report := range dbReports {
+		reports = append(reports, reportFromDB(report))
+	}
+	respondWithJson(w, http.StatusOK, reports)
+}
+
+func (cfg *apiConfig) handlerGetReport(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type responseBody struct {
+		Report
+		Actions []ModerationAction `json:"actions"`
+	}
+
+	reportID, err := pathUUID(r, "reportID")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	report, err := cfg.db.GetReport(r.Context(), reportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, problem.Wrap(problem.NotFound, err, "report not found"))
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't retrieve report"))
+		return
+	}
+
+	dbActions, err := cfg.db.ListModerationActionsForReport(r.Context(), uuid.NullUUID{UUID: reportID, Valid: true})
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't retrieve report history"))
+		return
+	}
+
+	actions := []ModerationAction{}
+	for _, action := range dbActions {
+		actions = append(actions, moderationActionFromDB(action))
+	}
+	respondWithJson(w, http.StatusOK, responseBody{
+		Report:  reportFromDB(report),
+		Actions: actions,
+	})
+}
+
+func (cfg *apiConfig) handlerTriageReport(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type requestBody struct {
+		Note string `json:"note"`
+	}
+
+	moderator := userFromContext(r.Context())
+
+	reportID, err := pathUUID(r, "reportID")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var params requestBody
+	if err := decodeOptionalJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't triage report"))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	report, err := qtx.TriageReport(r.Context(), database.TriageReportParams{
+		ID:         reportID,
+		AssignedTo: uuid.NullUUID{UUID: moderator.ID, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, problem.New(problem.Conflict, "report is not open"))
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't triage report"))
+		return
+	}
+
+	if _, err := qtx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:   uuid.NullUUID{UUID: moderator.ID, Valid: true},
+		ReportID:      uuid.NullUUID{UUID: report.ID, Valid: true},
+		Action:        moderationTriage,
+		TargetUserID:  uuid.NullUUID{UUID: report.ChirpAuthorID, Valid: true},
+		TargetChirpID: report.ChirpID,
+		Note:          strings.TrimSpace(params.Note),
+	}); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't triage report"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't triage report"))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, reportFromDB(report))
+}
+
+func (cfg *apiConfig) handlerResolveReport(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type requestBody struct {
+		Action string `json:"action" validate:"required,oneof=dismiss delete_chirp suspend_user ban_user"`
+		Note   string `json:"note"`
+		// SuspendHours is only used by the suspend_user action. Zero means
+		// defaultSuspension; the maximum is a year.
+		SuspendHours int `json:"suspend_hours" validate:"min=1,max=8760"`
+	}
+
+	moderator := userFromContext(r.Context())
+
+	reportID, err := pathUUID(r, "reportID")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var params requestBody
+	if err := decodeJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	suspension := defaultSuspension
+	if params.SuspendHours != 0 {
+		suspension = time.Duration(params.SuspendHours) * time.Hour
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't resolve report"))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	report, err := qtx.GetReport(r.Context(), reportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, problem.Wrap(problem.NotFound, err, "report not found"))
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't resolve report"))
+		return
+	}
+
+	var removed int64
+	switch params.Action {
+	case moderationDeleteChirp:
+		if report.ChirpID.Valid {
+			removed, err = qtx.RemoveChirp(r.Context(), report.ChirpID.UUID)
+			if err != nil {
+				respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't delete chirp"))
+				return
+			}
+		}
+
+	case moderationSuspendUser, moderationBanUser:
+		target, err := qtx.GetUser(r.Context(), report.ChirpAuthorID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, problem.Wrap(problem.NotFound, err, "user not found"))
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't resolve report"))
+			return
+		}
+		if !outranks(auth.Role(moderator.Role), auth.Role(target.Role)) {
+			respondWithError(w, r, problem.New(problem.Forbidden, "you can't take action against this user"))
+			return
+		}
+
+		if params.Action == moderationSuspendUser {
+			_, err = qtx.SuspendUser(r.Context(), database.SuspendUserParams{
+				ID:             target.ID,
+				SuspendedUntil: sql.NullTime{Time: time.Now().UTC().Add(suspension), Valid: true},
+			})
+		} else {
+			_, err = qtx.BanUser(r.Context(), target.ID)
+		}
+		if err == nil {
+			err = qtx.RevokeUserTokens(r.Context(), target.ID)
+		}
+		if err != nil {
+			respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't update user"))
+			return
+		}
+	}
+
+	report, err = qtx.ResolveReport(r.Context(), database.ResolveReportParams{
+		ID:         report.ID,
+		Resolution: sql.NullString{String: params.Action, Valid: true},
+		ResolvedBy: uuid.NullUUID{UUID: moderator.ID, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, problem.New(problem.Conflict, "report is already resolved"))
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't resolve report"))
+		return
+	}
+
+	if _, err := qtx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:   uuid.NullUUID{UUID: moderator.ID, Valid: true},
+		ReportID:      uuid.NullUUID{UUID: report.ID, Valid: true},
+		Action:        params.Action,
+		TargetUserID:  uuid.NullUUID{UUID: report.ChirpAuthorID, Valid: true},
+		TargetChirpID: report.ChirpID,
+		Note:          strings.TrimSpace(params.Note),
+	}); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't resolve report"))
+		return
+	}
+
+	notifications, err := resolutionNotifications(r.Context(), qtx, report, params.Action, removed)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't resolve report"))
+		return
+	}
+	if removed > 0 {
+		deleted := ChirpDeleted{Id: report.ChirpID.UUID, UserId: report.ChirpAuthorID}
+		if err := cfg.enqueueWebhooks(r.Context(), qtx, tx, eventChirpDeleted, report.ChirpAuthorID, deleted); err != nil {
+			respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't resolve report"))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't resolve report"))
+		return
+	}
+	if removed > 0 {
+		cfg.publishChirpEvent(eventChirpDeleted, report.ChirpAuthorID, report.ChirpBody, ChirpDeleted{Id: report.ChirpID.UUID, UserId: report.ChirpAuthorID})
+	}
+	for _, n := range notifications {
+		cfg.publishNotification(n)
+	}
+
+	respondWithJson(w, http.StatusOK, reportFromDB(report))
+}
+
+func (cfg *apiConfig) handlerListModerationActions(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	dbActions, err := cfg.db.ListModerationActions(r.Context(), database.ListModerationActionsParams{
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't retrieve moderation actions"))
+		return
+	}
+
+	actions := []ModerationAction{}
+	for _, action := range dbActions {
+		actions = append(actions, moderationActionFromDB(action))
+	}
+	respondWithJson(w, http.StatusOK, actions)
+}
+
+// resolutionNotifications tells the reporter their report was reviewed
+// and the author what was done to them, without saying who reported or
+// resolved it. Banned users can't sign in to read anything, so a ban only
+// notifies the reporter.
+func resolutionNotifications(ctx context.Context, q *database.Queries, report database.Report, action string, removed int64) ([]database.Notification, error) {
+	var created []database.Notification
+	for _, n := range resolutionNotices(report, action, removed) {
+		dbNotification, ok, err := notify(ctx, q, n)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			created = append(created, dbNotification)
+		}
+	}
+	return created, nil
+}
+
+// resolutionNotices are the notifications resolutionNotifications records.
+// Each groups by its type, so several reviews or removals read as one.
+func resolutionNotices(report database.Report, action string, removed int64) []notification {
+	var pending []notification
+	if report.ReporterID.Valid {
+		pending = append(pending, notification{
+			userID:  report.ReporterID.UUID,
+			typ:     notificationReportReviewed,
+			group:   notificationReportReviewed,
+			key:     report.ID.String(),
+			subject: report.ChirpID,
+		})
+	}
+	switch {
+	case action == moderationDeleteChirp && removed > 0:
+		pending = append(pending, notification{
+			userID:  report.ChirpAuthorID,
+			typ:     notificationChirpRemoved,
+			group:   notificationChirpRemoved,
+			key:     report.ChirpID.UUID.String(),
+			subject: report.ChirpID,
+		})
+	case action == moderationSuspendUser:
+		pending = append(pending, notification{
+			userID: report.ChirpAuthorID,
+			typ:    notificationAccountSuspended,
+			group:  notificationAccountSuspended,
+			key:    report.ID.String(),
+		})
+	}
+	return pending
+}
+
+// outranks reports whether actor may suspend or ban target: only users with a
+// strictly higher role can act on someone, so admins can't be banned.
+func outranks(actor, target auth.Role) bool {
+	return actor.AtLeast(target) && !target.AtLeast(actor)
+}
+
+func pageParams(r *http.Request) (limit, offset int32, err error) {
+	limit, offset = defaultPageSize, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return 0, 0, problem.Newf(problem.ValidationFailed, "limit must be between 1 and %d", maxPageSize)
+		}
+		limit = int32(n)
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, problem.New(problem.ValidationFailed, "offset must be a non-negative integer")
+		}
+		offset = int32(n)
+	}
+	return limit, offset, nil
+}
+
+func reportFromDB(report database.Report) Report {
+	return Report{
+		ID:            report.ID,
+		CreatedAt:     report.CreatedAt,
+		UpdatedAt:     report.UpdatedAt,
+		ReporterID:    nullUUIDPtr(report.ReporterID),
+		ChirpID:       nullUUIDPtr(report.ChirpID),
+		ChirpAuthorID: report.ChirpAuthorID,
+		ChirpBody:     report.ChirpBody,
+		Reason:        report.Reason,
+		Details:       report.Details,
+		Status:        report.Status,
+		AssignedTo:    nullUUIDPtr(report.AssignedTo),
+		Resolution:    nullStringPtr(report.Resolution),
+		ResolvedBy:    nullUUIDPtr(report.ResolvedBy),
+		ResolvedAt:    nullTimePtr(report.ResolvedAt),
+	}
+}
+
+func moderationActionFromDB(action database.ModerationAction) ModerationAction {
+	return ModerationAction{
+		ID:            action.ID,
+		CreatedAt:     action.CreatedAt,
+		ModeratorID:   nullUUIDPtr(action.ModeratorID),
+		ReportID:      nullUUIDPtr(action.ReportID),
+		Action:        action.Action,
+		TargetUserID:  nullUUIDPtr(action.TargetUserID),
+		TargetChirpID: nullUUIDPtr(action.TargetChirpID),
+		Note:          action.Note,
+	}
+}
+
+func nullUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
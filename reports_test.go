@@ -0,0 +1,140 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/database"
+)
+
+func TestResolveReport(t *testing.T) {
+	c := newTestAPI(t)
+	admin := c.mustDo("POST", "/api/login", "", map[string]string{"email": testAdminEmail, "password": testAdminPassword})
+	adminAuth := bearer(admin["token"])
+	if status, _ := c.do("GET", "/admin/reports", adminAuth, nil); status == http.StatusNotImplemented {
+		t.Skip("reports need Postgres")
+	}
+	alice := c.signup("alice@example.com")
+	bob := c.signup("bob@example.com")
+	carol := c.signup("carol@example.com")
+	dave := c.signup("dave@example.com")
+
+	// promote returns a fresh token, since a role change revokes the old ones
+	promote := func(user testUser, email string, role auth.Role) testUser {
+		c.mustDo("PUT", "/admin/users/"+user.id+"/role", adminAuth, map[string]auth.Role{"role": role})
+		login := c.mustDo("POST", "/api/login", "", map[string]string{"email": email, "password": "password123"})
+		return testUser{id: user.id, auth: bearer(login["token"])}
+	}
+	mod := promote(carol, "carol@example.com", auth.RoleModerator)
+	otherMod := promote(dave, "dave@example.com", auth.RoleModerator)
+
+	// report has bob report a new chirp by author
+	report := func(author testUser) (chirpID, reportID string) {
+		t.Helper()
+		chirp := c.mustDo("POST", "/api/chirps", author.auth, map[string]string{"body": "reported"})
+		report := c.mustDo("POST", "/api/chirps/"+chirp["id"].(string)+"/report", bob.auth, map[string]string{"reason": "spam"})
+		return chirp["id"].(string), report["id"].(string)
+	}
+	resolve := func(reportID string, body map[string]any) (int, []byte) {
+		t.Helper()
+		return c.do("POST", "/admin/reports/"+reportID+"/resolve", mod.auth, body)
+	}
+
+	// dismissing leaves the chirp up
+	chirpID, reportID := report(alice)
+	got := c.mustDo("POST", "/admin/reports/"+reportID+"/resolve", mod.auth, map[string]any{"action": "dismiss"})
+	if got["status"] != "resolved" || got["resolution"] != "dismiss" || got["resolved_by"] != mod.id {
+		t.Errorf("dismissed report = %v", got)
+	}
+	if status, _ := c.do("GET", "/api/chirps/"+chirpID, "", nil); status != http.StatusOK {
+		t.Errorf("dismissed chirp: %d, want 200", status)
+	}
+	if status, _ := resolve(reportID, map[string]any{"action": "delete_chirp"}); status != http.StatusConflict {
+		t.Errorf("resolving twice: %d, want 409", status)
+	}
+
+	chirpID, reportID = report(alice)
+	c.mustDo("POST", "/admin/reports/"+reportID+"/resolve", mod.auth, map[string]any{"action": "delete_chirp"})
+	if status, _ := c.do("GET", "/api/chirps/"+chirpID, "", nil); status != http.StatusNotFound {
+		t.Errorf("removed chirp: %d, want 404", status)
+	}
+
+	// a moderator can't act on another moderator or an admin, and the
+	// report stays open for someone who can
+	_, reportID = report(otherMod)
+	for _, action := range []string{"suspend_user", "ban_user"} {
+		if status, _ := resolve(reportID, map[string]any{"action": action}); status != http.StatusForbidden {
+			t.Errorf("%s on a moderator: %d, want 403", action, status)
+		}
+	}
+	_, adminReport := report(testUser{id: admin["id"].(string), auth: adminAuth})
+	if status, _ := resolve(adminReport, map[string]any{"action": "ban_user"}); status != http.StatusForbidden {
+		t.Errorf("ban_user on an admin: %d, want 403", status)
+	}
+	c.mustDo("POST", "/admin/reports/"+reportID+"/resolve", adminAuth, map[string]any{"action": "suspend_user", "suspend_hours": 1})
+
+	_, reportID = report(alice)
+	c.mustDo("POST", "/admin/reports/"+reportID+"/resolve", mod.auth, map[string]any{"action": "suspend_user", "suspend_hours": 1})
+	if status, body := c.do("POST", "/api/chirps", alice.auth, map[string]string{"body": "let me out"}); status != http.StatusForbidden || !strings.Contains(string(body), "suspended") {
+		t.Errorf("chirping while suspended: %d %s, want 403", status, body)
+	}
+	if status, _ := c.do("POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "password123"}); status != http.StatusForbidden {
+		t.Errorf("login while suspended: %d, want 403", status)
+	}
+
+	// once the suspension is over alice can chirp again
+	if _, err := c.cfg.conn.Exec("update users set suspended_until = NOW() - interval '1 minute' where id = $1", alice.id); err != nil {
+		t.Fatal(err)
+	}
+	c.mustDo("POST", "/api/chirps", alice.auth, map[string]string{"body": "I'm back"})
+	c.mustDo("POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "password123"})
+
+	_, reportID = report(alice)
+	c.mustDo("POST", "/admin/reports/"+reportID+"/resolve", mod.auth, map[string]any{"action": "ban_user"})
+	if status, body := c.do("POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "password123"}); status != http.StatusForbidden || !strings.Contains(string(body), "banned") {
+		t.Errorf("login while banned: %d %s, want 403", status, body)
+	}
+}
+
+func TestOutranks(t *testing.T) {
+	tests := []struct {
+		actor, target auth.Role
+		want          bool
+	}{
+		{auth.RoleAdmin, auth.RoleModerator, true},
+		{auth.RoleModerator, auth.RoleUser, true},
+		{auth.RoleModerator, auth.RoleModerator, false},
+		{auth.RoleModerator, auth.RoleAdmin, false},
+		{auth.RoleAdmin, auth.RoleAdmin, false},
+		{auth.RoleUser, auth.RoleUser, false},
+	}
+	for _, tt := range tests {
+		if got := outranks(tt.actor, tt.target); got != tt.want {
+			t.Errorf("outranks(%q, %q) = %v, want %v", tt.actor, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestAccountRestriction(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name string
+		user database.User
+		want string
+	}{
+		{"in good standing", database.User{}, ""},
+		{"suspension over", database.User{SuspendedUntil: sql.NullTime{Time: now.Add(-time.Minute), Valid: true}}, ""},
+		{"suspended", database.User{SuspendedUntil: sql.NullTime{Time: now.Add(time.Hour), Valid: true}}, "account is suspended until"},
+		{"banned", database.User{BannedAt: sql.NullTime{Time: now, Valid: true}}, "account is banned"},
+	}
+	for _, tt := range tests {
+		got := accountRestriction(tt.user)
+		if tt.want == "" && got != "" || !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: accountRestriction() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
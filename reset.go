@@ -2,18 +2,20 @@ package main
 
 import (
 	"net/http"
+
+	"github.com/jwoodsiii/chirpy/internal/problem"
 )
 
 func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	if cfg.platform != "dev" {
-		respondWithError(w, 403, "can't delete all users in prod, are you crazy?")
+		respondWithError(w, r, problem.New(problem.Forbidden, "can't delete all users in prod, are you crazy?"))
 		return
 	}
 
-	if err := cfg.db.DeleteUsers(r.Context()); err != nil {
-		respondWithError(w, 500, "failed to delete users")
+	if err := cfg.store.DeleteUsers(r.Context()); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "failed to delete users"))
 		return
 	}
 
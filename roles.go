@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/logging"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+	"github.com/jwoodsiii/chirpy/internal/store"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+const moderationChangeRole = "change_role"
+
+// middlewareRequireRole only calls next when the caller's access token
+// carries a role of at least min. The role claim is checked first so
+// ordinary users never cost a database lookup; the user is then loaded to
+// reject tokens issued before their last role change and accounts that have
+// since been banned or suspended. next can read the caller with
+// userFromContext.
+func (cfg *apiConfig) middlewareRequireRole(min auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, r, problem.Wrap(problem.Unauthorized, err, "a bearer access token is required"))
+			return
+		}
+
+		token, err := auth.ParseAccessToken(tokenString, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, r, problem.Wrap(problem.Unauthorized, err, "invalid or expired access token"))
+			return
+		}
+
+		logging.SetUserID(r.Context(), token.UserID.String())
+
+		if !token.Role.AtLeast(min) {
+			respondWithError(w, r, problem.New(problem.Forbidden, "insufficient permissions"))
+			return
+		}
+
+		user, err := cfg.store.GetUser(r.Context(), token.UserID)
+		if err != nil {
+			respondWithError(w, r, problem.Wrap(problem.Unauthorized, err, "invalid or expired access token"))
+			return
+		}
+
+		// JWT timestamps have second precision
+		if user.RoleUpdatedAt.Valid && token.IssuedAt.Before(user.RoleUpdatedAt.Time.Truncate(time.Second)) {
+			respondWithError(w, r, problem.New(problem.Unauthorized, "token was revoked by a role change, please log in again"))
+			return
+		}
+
+		if !auth.Role(user.Role).AtLeast(min) || accountRestriction(user) != "" {
+			respondWithError(w, r, problem.New(problem.Forbidden, "insufficient permissions"))
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	}
+}
+
+func userFromContext(ctx context.Context) database.User {
+	user, _ := ctx.Value(userContextKey).(database.User)
+	return user
+}
+
+func (cfg *apiConfig) handlerSetUserRole(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type requestBody struct {
+		Role auth.Role `json:"role" validate:"required,oneof=user moderator admin"`
+	}
+
+	type responseBody struct {
+		Id   uuid.UUID `json:"id"`
+		Role auth.Role `json:"role"`
+	}
+
+	admin := userFromContext(r.Context())
+
+	targetID, err := pathUUID(r, "id")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var params requestBody
+	if err := decodeJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if targetID == admin.ID {
+		respondWithError(w, r, problem.New(problem.ValidationFailed, "you can't change your own role"))
+		return
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't change role"))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	target, err := qtx.GetUser(r.Context(), targetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, problem.New(problem.NotFound, "user not found"))
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't change role"))
+		return
+	}
+
+	if err := changeRole(r.Context(), qtx, target.ID, params.Role); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't change role"))
+		return
+	}
+
+	if _, err := qtx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  uuid.NullUUID{UUID: admin.ID, Valid: true},
+		Action:       moderationChangeRole,
+		TargetUserID: uuid.NullUUID{UUID: target.ID, Valid: true},
+		Note:         fmt.Sprintf("%s -> %s", target.Role, params.Role),
+	}); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't change role"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't change role"))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, responseBody{
+		Id:   target.ID,
+		Role: params.Role,
+	})
+}
+
+// changeRole sets a user's role and revokes their refresh tokens. Stamping
+// role_updated_at also invalidates any access tokens issued before now for
+// routes behind middlewareRequireRole.
+func changeRole(ctx context.Context, q store.Queries, userID uuid.UUID, role auth.Role) error {
+	if _, err := q.SetUserRole(ctx, database.SetUserRoleParams{
+		ID:            userID,
+		Role:          string(role),
+		RoleUpdatedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	}); err != nil {
+		return err
+	}
+	return q.RevokeUserTokens(ctx, userID)
+}
+
+// bootstrapAdmin makes sure the account for email exists and is an admin so
+// a fresh deployment has someone who can reach the /admin routes. The
+// account is only created when a password is supplied.
+func (cfg *apiConfig) bootstrapAdmin(ctx context.Context, email, password string) error {
+	user, err := cfg.store.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		if password == "" {
+			return fmt.Errorf("no user with email %s and no password to create one", email)
+		}
+		hashed, err := auth.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		user, err = cfg.store.CreateUser(ctx, database.CreateUserParams{Email: email, HashedPassword: hashed})
+		if err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "created bootstrap admin", "email", email)
+	} else if err != nil {
+		return err
+	}
+
+	if auth.Role(user.Role) == auth.RoleAdmin {
+		return nil
+	}
+	if err := changeRole(ctx, cfg.store, user.ID, auth.RoleAdmin); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "promoted bootstrap admin", "email", email)
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jwoodsiii/chirpy/internal/config"
+)
+
+func newServer(sc config.Server, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              sc.Addr,
+		Handler:           handler,
+		ReadTimeout:       sc.ReadTimeout,
+		ReadHeaderTimeout: sc.ReadHeaderTimeout,
+		WriteTimeout:      sc.WriteTimeout,
+		IdleTimeout:       sc.IdleTimeout,
+		MaxHeaderBytes:    sc.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// runServer serves until ctx is cancelled and then shuts the server down,
+// giving in-flight requests up to sc.ShutdownTimeout to finish. Before
+// that it calls draining and keeps serving for sc.ShutdownDelay so load
+// balancers polling readyz see the instance go unready first. With TLS
+// enabled, SIGHUP reloads the certificate and key from disk without
+// dropping connections.
+func runServer(ctx context.Context, server *http.Server, sc config.Server, draining func()) error {
+	if sc.TLSEnabled() {
+		certs, err := newCertReloader(sc.TLSCertFile, sc.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.getCertificate,
+		}
+		go certs.reloadOnSIGHUP(ctx)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		slog.Info("Serving", "addr", server.Addr, "tls", sc.TLSEnabled())
+		var err error
+		if sc.TLSEnabled() {
+			// certificates come from TLSConfig.GetCertificate
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	draining()
+	if sc.ShutdownDelay > 0 {
+		slog.Info("Shutting down, waiting for load balancers", "delay", sc.ShutdownDelay)
+		select {
+		case <-time.After(sc.ShutdownDelay):
+		case err := <-errc:
+			return err
+		}
+	}
+
+	slog.Info("Shutting down, draining requests", "timeout", sc.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), sc.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// certReloader hands out the most recently loaded TLS certificate.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// reloadOnSIGHUP keeps serving the old certificate if the new one can't be
+// loaded, so a bad deploy doesn't take the server down.
+func (c *certReloader) reloadOnSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := c.reload(); err != nil {
+				slog.Error("TLS certificate reload failed, keeping the current certificate", "err", err)
+				continue
+			}
+			slog.Info("Reloaded TLS certificate", "cert_file", c.certFile)
+		}
+	}
+}
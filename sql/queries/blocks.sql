@@ -0,0 +1,23 @@
+-- name: BlockUser :exec
+insert into user_blocks (blocker_id, blocked_id, created_at)
+values ($1, $2, NOW())
+on conflict do nothing;
+
+-- name: UnblockUser :exec
+delete from user_blocks where blocker_id=$1 and blocked_id=$2;
+
+-- name: IsBlocked :one
+select exists(select 1 from user_blocks where blocker_id=$1 and blocked_id=$2);
+
+-- name: MuteUser :exec
+insert into user_mutes (muter_id, muted_id, created_at)
+values ($1, $2, NOW())
+on conflict do nothing;
+
+-- name: UnmuteUser :exec
+delete from user_mutes where muter_id=$1 and muted_id=$2;
+
+-- name: ListHiddenUsers :many
+select blocked_id as user_id from user_blocks where blocker_id=$1
+union
+select muted_id from user_mutes where muter_id=$1;
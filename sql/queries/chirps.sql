@@ -10,7 +10,14 @@ values (
 returning *;
 
 -- name: GetChirps :many
-select * from chirps order by created_at asc;
+select * from chirps
+where not exists (
+    select 1 from user_blocks where blocker_id=sqlc.arg(viewer_id) and blocked_id=chirps.user_id
+)
+and not exists (
+    select 1 from user_mutes where muter_id=sqlc.arg(viewer_id) and muted_id=chirps.user_id
+)
+order by created_at asc;
 
 -- name: GetChirp :one
 select * from chirps where id=$1;
@@ -20,4 +27,15 @@ delete from chirps where id=$1 and user_id=$2
 returning *;
 
 -- name: GetChirpsByAuthor :many
-select * from chirps where user_id=$1 order by created_at asc;
+select * from chirps
+where user_id=sqlc.arg(user_id)
+and not exists (
+    select 1 from user_blocks where blocker_id=sqlc.arg(viewer_id) and blocked_id=chirps.user_id
+)
+and not exists (
+    select 1 from user_mutes where muter_id=sqlc.arg(viewer_id) and muted_id=chirps.user_id
+)
+order by created_at asc;
+
+-- name: RemoveChirp :execrows
+delete from chirps where id=$1;
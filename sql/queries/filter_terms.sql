@@ -0,0 +1,13 @@
+-- name: ListFilterTerms :many
+select * from filter_terms
+order by word;
+
+-- name: UpsertFilterTerm :one
+insert into filter_terms (word, action, created_at, updated_at, updated_by)
+values ($1, $2, NOW(), NOW(), $3)
+on conflict (word) do update
+set action=excluded.action, updated_at=NOW(), updated_by=excluded.updated_by
+returning *;
+
+-- name: DeleteFilterTerm :execrows
+delete from filter_terms where word=$1;
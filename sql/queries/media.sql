@@ -0,0 +1,38 @@
+-- name: CreateMediaUpload :one
+insert into media_uploads (id, created_at, updated_at, user_id, content_type, width, height, key, thumbnail_key, blurhash)
+values (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+returning *;
+
+-- name: AttachChirpMedia :execrows
+insert into chirp_media (chirp_id, media_id, position, alt_text)
+select sqlc.arg(chirp_id)::uuid, media_uploads.id, sqlc.arg(position)::integer, sqlc.arg(alt_text)::text
+from media_uploads
+where media_uploads.id=sqlc.arg(media_id)
+and media_uploads.user_id=sqlc.arg(user_id)
+and not exists (select 1 from chirp_media where chirp_media.media_id=media_uploads.id);
+
+-- name: GetChirpMedia :many
+select chirp_media.chirp_id, chirp_media.position, chirp_media.alt_text,
+    media_uploads.id, media_uploads.content_type, media_uploads.width, media_uploads.height,
+    media_uploads.key, media_uploads.thumbnail_key, media_uploads.blurhash
+from chirp_media
+join media_uploads on media_uploads.id=chirp_media.media_id
+where chirp_media.chirp_id = any(sqlc.arg(chirp_ids)::uuid[])
+order by chirp_media.chirp_id, chirp_media.position;
+
+-- name: DeleteOrphanedMediaUploads :many
+delete from media_uploads
+where created_at < $1
+and not exists (select 1 from chirp_media where chirp_media.media_id=media_uploads.id)
+returning *;
@@ -0,0 +1,57 @@
+-- name: CreateNotification :one
+with event as (
+    insert into notification_events (user_id, type, event_key, created_at)
+    values (sqlc.arg(user_id)::uuid, sqlc.arg(type)::text, sqlc.arg(event_key)::text, NOW())
+    on conflict do nothing
+    returning user_id
+)
+insert into notifications (id, created_at, updated_at, user_id, type, group_key, event_keys, subject_id)
+select gen_random_uuid(), NOW(), NOW(), event.user_id, sqlc.arg(type)::text, sqlc.arg(group_key)::text,
+    array[sqlc.arg(event_key)::text], sqlc.narg(subject_id)::uuid
+from event
+where not exists (
+    select 1 from notification_preferences
+    where user_id=sqlc.arg(user_id) and type=sqlc.arg(type) and not enabled
+)
+on conflict (user_id, group_key) where read_at is null do update
+set event_keys=notifications.event_keys || excluded.event_keys,
+    subject_id=excluded.subject_id,
+    updated_at=NOW()
+returning *;
+
+-- name: ListNotifications :many
+select * from notifications
+where user_id=$1
+order by updated_at desc, id desc
+limit $2 offset $3;
+
+-- name: ListUnreadNotifications :many
+select * from notifications
+where user_id=$1 and read_at is null
+order by updated_at desc, id desc
+limit $2 offset $3;
+
+-- name: CountUnreadNotifications :one
+select count(*) from notifications
+where user_id=$1 and read_at is null;
+
+-- name: MarkNotificationsRead :execrows
+update notifications
+set read_at=NOW()
+where user_id=sqlc.arg(user_id) and read_at is null and id = any(sqlc.arg(ids)::uuid[]);
+
+-- name: MarkAllNotificationsRead :execrows
+update notifications
+set read_at=NOW()
+where user_id=$1 and read_at is null;
+
+-- name: ListNotificationPreferences :many
+select * from notification_preferences
+where user_id=$1
+order by type;
+
+-- name: SetNotificationPreference :exec
+insert into notification_preferences (user_id, type, enabled, updated_at)
+values ($1, $2, $3, NOW())
+on conflict (user_id, type) do update
+set enabled=excluded.enabled, updated_at=NOW();
@@ -5,7 +5,7 @@ values (
     NOW(),
     NOW(),
     $2,
-    NOW()+interval '60 day',
+    $3,
     null
 )
 returning *;
@@ -24,3 +24,9 @@ update refresh_tokens
 set revoked_at=NOW(), updated_at=NOW()
 where token=$1
 returning *;
+
+-- name: RevokeUserTokens :exec
+update refresh_tokens
+set revoked_at=NOW(), updated_at=NOW()
+where user_id=$1
+and revoked_at is null;
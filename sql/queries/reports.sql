@@ -0,0 +1,60 @@
+-- name: CreateReport :one
+insert into reports (id, created_at, updated_at, reporter_id, chirp_id, chirp_author_id, chirp_body, reason, details, status)
+values (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    'open'
+)
+returning *;
+
+-- name: GetReport :one
+select * from reports where id=$1;
+
+-- name: ListReportsByStatus :many
+select * from reports
+where status=$1
+order by created_at asc
+limit $2 offset $3;
+
+-- name: TriageReport :one
+update reports
+set status='triaged', assigned_to=$2, updated_at=NOW()
+where id=$1 and status='open'
+returning *;
+
+-- name: ResolveReport :one
+update reports
+set status='resolved', resolution=$2, resolved_by=$3, resolved_at=NOW(), updated_at=NOW()
+where id=$1 and status <> 'resolved'
+returning *;
+
+-- name: CreateModerationAction :one
+insert into moderation_actions (id, created_at, moderator_id, report_id, action, target_user_id, target_chirp_id, note)
+values (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+returning *;
+
+-- name: ListModerationActions :many
+select * from moderation_actions
+order by created_at desc
+limit $1 offset $2;
+
+-- name: ListModerationActionsForReport :many
+select * from moderation_actions
+where report_id=$1
+order by created_at asc;
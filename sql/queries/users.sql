@@ -26,3 +26,36 @@ update users
 set is_chirpy_red=true
 where id=$1
 returning *;
+
+-- name: GetUser :one
+select * from users where id=$1;
+
+-- name: UpdateUserAvatar :one
+update users
+set avatar_key=$2, updated_at=NOW()
+where id=$1
+returning *;
+
+-- name: UpdateUserBanner :one
+update users
+set banner_key=$2, updated_at=NOW()
+where id=$1
+returning *;
+
+-- name: SuspendUser :one
+update users
+set suspended_until=$2, updated_at=NOW()
+where id=$1
+returning *;
+
+-- name: BanUser :one
+update users
+set banned_at=NOW(), updated_at=NOW()
+where id=$1
+returning *;
+
+-- name: SetUserRole :one
+update users
+set role=$2, role_updated_at=$3, updated_at=NOW()
+where id=$1
+returning *;
@@ -0,0 +1,60 @@
+-- name: CreateWebhookEndpoint :one
+insert into webhook_endpoints (id, created_at, updated_at, user_id, url, secret, events, all_users)
+values (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5)
+returning *;
+
+-- name: CountWebhookEndpoints :one
+select count(*) from webhook_endpoints
+where user_id=$1;
+
+-- name: ListWebhookEndpoints :many
+select * from webhook_endpoints
+where user_id=$1
+order by created_at;
+
+-- name: GetWebhookEndpoint :one
+select * from webhook_endpoints
+where id=$1 and user_id=$2;
+
+-- name: DeleteWebhookEndpoint :execrows
+delete from webhook_endpoints
+where id=$1 and user_id=$2;
+
+-- name: EnqueueWebhookEvent :many
+insert into webhook_deliveries (id, created_at, updated_at, endpoint_id, event_type, payload, status, next_attempt_at)
+select gen_random_uuid(), NOW(), NOW(), e.id, sqlc.arg(event_type)::text, sqlc.arg(payload)::jsonb, 'pending', NOW()
+from webhook_endpoints e
+join users u on u.id=e.user_id
+where sqlc.arg(event_type)::text = any(e.events)
+    and (e.user_id=sqlc.arg(user_id)::uuid
+        or (e.all_users and u.role='admin' and u.banned_at is null))
+returning id;
+
+-- name: CreateWebhookDelivery :one
+insert into webhook_deliveries (id, created_at, updated_at, endpoint_id, event_type, payload, status, next_attempt_at)
+values (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, 'pending', NOW())
+returning *;
+
+-- name: StartWebhookAttempt :one
+update webhook_deliveries d
+set attempts=d.attempts + 1, last_attempt_at=NOW(), updated_at=NOW()
+from webhook_endpoints e
+where e.id=d.endpoint_id and d.id=$1 and d.status='pending'
+returning d.id, d.event_type, d.payload, d.attempts, e.url, e.secret;
+
+-- name: RecordWebhookAttempt :exec
+update webhook_deliveries
+set status=$2, next_attempt_at=$3, last_status_code=$4, last_error=$5, updated_at=NOW()
+where id=$1;
+
+-- name: ListWebhookDeliveries :many
+select * from webhook_deliveries
+where endpoint_id=$1
+order by created_at desc, id desc
+limit $2 offset $3;
+
+-- name: RedeliverWebhook :one
+update webhook_deliveries
+set status='pending', attempts=0, next_attempt_at=NOW(), last_error='', updated_at=NOW()
+where id=$1 and endpoint_id=$2 and status <> 'pending'
+returning *;
@@ -0,0 +1,7 @@
+-- +goose Up
+alter table users add column avatar_key text;
+alter table users add column banner_key text;
+
+-- +goose Down
+alter table users drop column banner_key;
+alter table users drop column avatar_key;
@@ -0,0 +1,26 @@
+-- +goose Up
+create table media_uploads (
+    id uuid primary key,
+    -- with a time zone, as the media sweeper compares it with a cutoff from Go
+    created_at timestamptz not null,
+    updated_at timestamp not null,
+    user_id uuid not null references users(id) on delete cascade,
+    content_type text not null,
+    width integer not null,
+    height integer not null,
+    key text not null,
+    thumbnail_key text not null,
+    blurhash text not null
+);
+
+create table chirp_media (
+    chirp_id uuid not null references chirps(id) on delete cascade,
+    media_id uuid not null unique references media_uploads(id) on delete cascade,
+    position integer not null,
+    alt_text text not null,
+    primary key (chirp_id, media_id)
+);
+
+-- +goose Down
+drop table chirp_media;
+drop table media_uploads;
@@ -0,0 +1,20 @@
+-- +goose Up
+create table user_blocks (
+    blocker_id uuid not null references users(id) on delete cascade,
+    blocked_id uuid not null references users(id) on delete cascade,
+    created_at timestamp not null,
+    primary key (blocker_id, blocked_id),
+    check (blocker_id <> blocked_id)
+);
+
+create table user_mutes (
+    muter_id uuid not null references users(id) on delete cascade,
+    muted_id uuid not null references users(id) on delete cascade,
+    created_at timestamp not null,
+    primary key (muter_id, muted_id),
+    check (muter_id <> muted_id)
+);
+
+-- +goose Down
+drop table user_mutes;
+drop table user_blocks;
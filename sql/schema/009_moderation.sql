@@ -0,0 +1,45 @@
+-- +goose Up
+alter table users add column role text not null default 'user'
+    check (role in ('user', 'moderator', 'admin'));
+-- Go sets suspensions in UTC and queries compare them with NOW()
+alter table users add column suspended_until timestamptz;
+alter table users add column banned_at timestamp;
+
+create table reports (
+    id uuid primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    reporter_id uuid not null references users(id) on delete cascade,
+    chirp_id uuid references chirps(id) on delete set null,
+    chirp_author_id uuid not null references users(id) on delete cascade,
+    chirp_body text not null,
+    reason text not null,
+    details text not null,
+    status text not null default 'open'
+        check (status in ('open', 'triaged', 'resolved')),
+    assigned_to uuid references users(id) on delete set null,
+    resolution text,
+    resolved_by uuid references users(id) on delete set null,
+    resolved_at timestamp,
+    unique (reporter_id, chirp_id)
+);
+
+create index reports_status_created_at_idx on reports (status, created_at);
+
+create table moderation_actions (
+    id uuid primary key,
+    created_at timestamp not null,
+    moderator_id uuid references users(id) on delete set null,
+    report_id uuid references reports(id) on delete set null,
+    action text not null,
+    target_user_id uuid references users(id) on delete set null,
+    target_chirp_id uuid,
+    note text not null
+);
+
+-- +goose Down
+drop table moderation_actions;
+drop table reports;
+alter table users drop column banned_at;
+alter table users drop column suspended_until;
+alter table users drop column role;
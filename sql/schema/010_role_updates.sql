@@ -0,0 +1,5 @@
+-- +goose Up
+alter table users add column role_updated_at timestamp;
+
+-- +goose Down
+alter table users drop column role_updated_at;
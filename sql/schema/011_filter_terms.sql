@@ -0,0 +1,16 @@
+-- +goose Up
+create table filter_terms (
+    word text primary key,
+    action text not null check (action in ('mask', 'reject', 'flag')),
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    updated_by uuid references users(id) on delete set null
+);
+
+-- reports raised by the profanity filter have no reporter
+alter table reports alter column reporter_id drop not null;
+
+-- +goose Down
+delete from reports where reporter_id is null;
+alter table reports alter column reporter_id set not null;
+drop table filter_terms;
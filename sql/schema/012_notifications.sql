@@ -0,0 +1,40 @@
+-- +goose Up
+create table notifications (
+    id uuid primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    user_id uuid not null references users(id) on delete cascade,
+    type text not null,
+    -- unread notifications with the same group key are merged into one
+    group_key text not null,
+    -- the events merged into this notification, so repeats are ignored
+    event_keys text[] not null,
+    subject_id uuid,
+    read_at timestamp
+);
+
+create unique index notifications_unread_group on notifications (user_id, group_key) where read_at is null;
+create index notifications_user_updated on notifications (user_id, updated_at desc);
+
+-- every event a user has been notified of, so a repeat is ignored even
+-- after the notification it went into has been read
+create table notification_events (
+    user_id uuid not null references users(id) on delete cascade,
+    type text not null,
+    event_key text not null,
+    created_at timestamp not null,
+    primary key (user_id, type, event_key)
+);
+
+create table notification_preferences (
+    user_id uuid not null references users(id) on delete cascade,
+    type text not null,
+    enabled boolean not null,
+    updated_at timestamp not null,
+    primary key (user_id, type)
+);
+
+-- +goose Down
+drop table notification_preferences;
+drop table notification_events;
+drop table notifications;
@@ -0,0 +1,37 @@
+-- +goose Up
+create table webhook_endpoints (
+    id uuid primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    user_id uuid not null references users(id) on delete cascade,
+    url text not null,
+    secret text not null,
+    events text[] not null,
+    -- only admins can register endpoints for every user's events
+    all_users boolean not null default false
+);
+
+create index webhook_endpoints_user on webhook_endpoints (user_id);
+
+-- the outbox: a row per event and endpoint, sent by the delivery worker
+create table webhook_deliveries (
+    id uuid primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    endpoint_id uuid not null references webhook_endpoints(id) on delete cascade,
+    event_type text not null,
+    payload jsonb not null,
+    status text not null check (status in ('pending', 'delivered', 'dead')),
+    attempts int not null default 0,
+    next_attempt_at timestamp not null,
+    last_attempt_at timestamp,
+    last_status_code int,
+    last_error text not null default ''
+);
+
+create index webhook_deliveries_due on webhook_deliveries (next_attempt_at) where status = 'pending';
+create index webhook_deliveries_endpoint on webhook_deliveries (endpoint_id, created_at desc);
+
+-- +goose Down
+drop table webhook_deliveries;
+drop table webhook_endpoints;
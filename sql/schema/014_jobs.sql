@@ -0,0 +1,29 @@
+-- +goose Up
+-- background work, claimed and run by internal/jobs
+create table jobs (
+    id uuid primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    kind text not null,
+    payload jsonb not null,
+    -- succeeded jobs are deleted
+    status text not null check (status in ('pending', 'running', 'failed')),
+    attempts int not null default 0,
+    max_attempts int not null check (max_attempts > 0),
+    run_at timestamp not null,
+    -- while running, when the runner's lease on the job runs out
+    locked_until timestamp,
+    last_error text not null default '',
+    unique_key text
+);
+
+create index jobs_due on jobs (kind, run_at) where status = 'pending';
+create index jobs_leased on jobs (kind, locked_until) where status = 'running';
+create unique index jobs_unique_key on jobs (unique_key) where status in ('pending', 'running');
+
+-- webhook deliveries are now sent by jobs; the table keeps their history
+drop index webhook_deliveries_due;
+
+-- +goose Down
+create index webhook_deliveries_due on webhook_deliveries (next_attempt_at) where status = 'pending';
+drop table jobs;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Go writes expires_at in UTC while queries compare it with NOW(). As a
+-- plain timestamp they only agree when the server's time zone is UTC.
+alter table refresh_tokens alter column expires_at type timestamptz using expires_at at time zone 'UTC';
+
+-- +goose Down
+alter table refresh_tokens alter column expires_at type timestamp using expires_at at time zone 'UTC';
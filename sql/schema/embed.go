@@ -0,0 +1,10 @@
+// Package schema embeds the goose migrations so the chirpy binary can apply
+// them itself.
+package schema
+
+import "embed"
+
+// FS holds every NNN_name.sql migration in this directory.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,23 @@
+-- name: BlockUser :exec
+insert into user_blocks (blocker_id, blocked_id, created_at)
+values (?, ?, ?)
+on conflict do nothing;
+
+-- name: UnblockUser :exec
+delete from user_blocks where blocker_id=? and blocked_id=?;
+
+-- name: IsBlocked :one
+select count(*) from user_blocks where blocker_id=? and blocked_id=?;
+
+-- name: MuteUser :exec
+insert into user_mutes (muter_id, muted_id, created_at)
+values (?, ?, ?)
+on conflict do nothing;
+
+-- name: UnmuteUser :exec
+delete from user_mutes where muter_id=? and muted_id=?;
+
+-- name: ListHiddenUsers :many
+select blocked_id as user_id from user_blocks where blocker_id=?1
+union
+select muted_id from user_mutes where muter_id=?1;
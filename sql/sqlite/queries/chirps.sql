@@ -0,0 +1,35 @@
+-- name: CreateChirp :one
+insert into chirps (id, created_at, updated_at, body, user_id)
+values (?, ?, ?, ?, ?)
+returning *;
+
+-- name: GetChirps :many
+select * from chirps
+where not exists (
+    select 1 from user_blocks where blocker_id=sqlc.arg(viewer_id) and blocked_id=chirps.user_id
+)
+and not exists (
+    select 1 from user_mutes where muter_id=sqlc.arg(viewer_id) and muted_id=chirps.user_id
+)
+order by created_at asc;
+
+-- name: GetChirp :one
+select * from chirps where id=?;
+
+-- name: DeleteChirp :one
+delete from chirps where id=? and user_id=?
+returning *;
+
+-- name: GetChirpsByAuthor :many
+select * from chirps
+where user_id=sqlc.arg(user_id)
+and not exists (
+    select 1 from user_blocks where blocker_id=sqlc.arg(viewer_id) and blocked_id=chirps.user_id
+)
+and not exists (
+    select 1 from user_mutes where muter_id=sqlc.arg(viewer_id) and muted_id=chirps.user_id
+)
+order by created_at asc;
+
+-- name: RemoveChirp :execrows
+delete from chirps where id=?;
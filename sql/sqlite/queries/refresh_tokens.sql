@@ -0,0 +1,25 @@
+-- name: CreateToken :one
+insert into refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+values (?, ?, ?, ?, ?, null)
+returning *;
+
+-- name: GetRefreshToken :one
+select * from refresh_tokens where token=?;
+
+-- name: GetUserFromRefreshToken :one
+select * from refresh_tokens
+where token=sqlc.arg(token)
+and expires_at > sqlc.arg(now)
+and revoked_at is null;
+
+-- name: RevokeToken :one
+update refresh_tokens
+set revoked_at=sqlc.arg(now), updated_at=sqlc.arg(now)
+where token=sqlc.arg(token)
+returning *;
+
+-- name: RevokeUserTokens :exec
+update refresh_tokens
+set revoked_at=sqlc.arg(now), updated_at=sqlc.arg(now)
+where user_id=sqlc.arg(user_id)
+and revoked_at is null;
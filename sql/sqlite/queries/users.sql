@@ -0,0 +1,55 @@
+-- name: CreateUser :one
+insert into users (id, created_at, updated_at, email, hashed_password)
+values (?, ?, ?, ?, ?)
+returning *;
+
+-- name: GetUserByEmail :one
+select * from users where email=?;
+
+-- name: DeleteUsers :exec
+delete from users;
+
+-- name: UpdateUser :one
+update users
+set email=?, hashed_password=?, updated_at=?
+where id=?
+returning *;
+
+-- name: UpgradeUser :one
+update users
+set is_chirpy_red=true
+where id=?
+returning *;
+
+-- name: GetUser :one
+select * from users where id=?;
+
+-- name: UpdateUserAvatar :one
+update users
+set avatar_key=?, updated_at=?
+where id=?
+returning *;
+
+-- name: UpdateUserBanner :one
+update users
+set banner_key=?, updated_at=?
+where id=?
+returning *;
+
+-- name: SuspendUser :one
+update users
+set suspended_until=?, updated_at=?
+where id=?
+returning *;
+
+-- name: BanUser :one
+update users
+set banned_at=sqlc.arg(now), updated_at=sqlc.arg(now)
+where id=sqlc.arg(id)
+returning *;
+
+-- name: SetUserRole :one
+update users
+set role=?, role_updated_at=?, updated_at=?
+where id=?
+returning *;
@@ -0,0 +1,61 @@
+-- +goose Up
+-- SQLite has no uuid or timestamptz types. IDs are stored as text and
+-- timestamps as integer microseconds since the Unix epoch, both supplied
+-- by the application.
+create table users (
+    id uuid primary key,
+    created_at integer not null,
+    updated_at integer not null,
+    email text unique not null,
+    hashed_password text not null default 'unset',
+    is_chirpy_red boolean not null default false,
+    avatar_key text,
+    banner_key text,
+    role text not null default 'user'
+        check (role in ('user', 'moderator', 'admin')),
+    suspended_until integer,
+    banned_at integer,
+    role_updated_at integer
+);
+
+create table chirps (
+    id uuid primary key,
+    created_at integer not null,
+    updated_at integer not null,
+    body text not null,
+    user_id uuid not null references users(id) on delete cascade
+);
+
+create index chirps_created_at_idx on chirps (created_at);
+
+create table refresh_tokens (
+    token text primary key,
+    created_at integer not null,
+    updated_at integer not null,
+    user_id uuid not null references users(id) on delete cascade,
+    expires_at integer not null,
+    revoked_at integer
+);
+
+create table user_blocks (
+    blocker_id uuid not null references users(id) on delete cascade,
+    blocked_id uuid not null references users(id) on delete cascade,
+    created_at integer not null,
+    primary key (blocker_id, blocked_id),
+    check (blocker_id <> blocked_id)
+);
+
+create table user_mutes (
+    muter_id uuid not null references users(id) on delete cascade,
+    muted_id uuid not null references users(id) on delete cascade,
+    created_at integer not null,
+    primary key (muter_id, muted_id),
+    check (muter_id <> muted_id)
+);
+
+-- +goose Down
+drop table user_mutes;
+drop table user_blocks;
+drop table refresh_tokens;
+drop table chirps;
+drop table users;
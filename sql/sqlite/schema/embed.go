@@ -0,0 +1,11 @@
+// Package schema embeds the SQLite migrations. SQLite deployments only
+// cover users, chirps, refresh tokens, blocks and mutes; keep these tables
+// in step with sql/schema when those change.
+package schema
+
+import "embed"
+
+// FS holds every NNN_name.sql migration in this directory.
+//
+//go:embed *.sql
+var FS embed.FS
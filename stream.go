@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/hub"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+)
+
+const (
+	eventChirpCreated = "chirp.created"
+	eventChirpDeleted = "chirp.deleted"
+	// eventReset tells a resuming client that events were lost, so it
+	// should reload what it shows rather than rely on the stream.
+	eventReset = "reset"
+
+	// streamHeartbeatInterval keeps idle streams from being closed by
+	// proxies and lets the server notice clients that have gone away.
+	streamHeartbeatInterval = 15 * time.Second
+	// streamRetry is how long EventSource clients wait before reconnecting.
+	streamRetry = 3 * time.Second
+)
+
+// ChirpDeleted is the data of a chirp.deleted event.
+type ChirpDeleted struct {
+	Id     uuid.UUID `json:"id"`
+	UserId uuid.UUID `json:"user_id"`
+}
+
+// newStreamEpoch identifies this process's event IDs. Event IDs are
+// "<epoch>-<seq>", so a client resuming with an ID from another replica
+// or from before a restart is told to reset instead of being handed the
+// wrong events.
+func newStreamEpoch() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// publish sends e to the streams with data as its payload. data is
+// marshalled once here rather than for every client.
+func (cfg *apiConfig) publish(e hub.Event, data any) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("couldn't encode event", "type", e.Type, "err", err)
+		return
+	}
+	e.Data = b
+	cfg.events.Publish(e)
+}
+
+// publishChirpEvent publishes a chirp event by authorID, tagged with the
+// hashtags in the chirp's body.
+func (cfg *apiConfig) publishChirpEvent(typ string, authorID uuid.UUID, body string, data any) {
+	cfg.publish(hub.Event{Type: typ, UserID: authorID, Tags: hashtags(body)}, data)
+}
+
+// hashtags returns the distinct hashtags in body, lowercased and without
+// the #. Only a # at the start, after a space or after an opening bracket
+// or quote starts one, so URL fragments and "C#" aren't tags.
+func hashtags(body string) []string {
+	var tags []string
+	prev := ' '
+	for i, r := range body {
+		if r == '#' && (unicode.IsSpace(prev) || strings.ContainsRune(`([{"'`, prev)) {
+			end := i + 1
+			for end < len(body) {
+				next, size := utf8.DecodeRuneInString(body[end:])
+				if !isTagRune(next) {
+					break
+				}
+				end += size
+			}
+			if tag := strings.ToLower(body[i+1 : end]); tag != "" && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		prev = r
+	}
+	return tags
+}
+
+func isTagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// handlerStreamChirps streams chirp.created and chirp.deleted events as
+// Server-Sent Events. Repeating author_id limits the stream to those
+// authors, and a signed-in caller never sees the users they have blocked
+// or muted. A client that reconnects with Last-Event-ID (or last_event_id
+// in the query, for the first connection) is sent what it missed from the
+// replay buffer, or a reset event if that is no longer possible.
+func (cfg *apiConfig) handlerStreamChirps(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	authors, err := queryUUIDs(r, "author_id")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	viewerID, err := cfg.viewerID(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	var hidden []uuid.UUID
+	if viewerID != uuid.Nil {
+		hidden, err = cfg.store.ListHiddenUsers(r.Context(), viewerID)
+		if err != nil {
+			respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't open stream"))
+			return
+		}
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	lastID, known := cfg.parseEventID(lastEventID)
+
+	sub, complete, err := cfg.events.Subscribe(lastID, func(e hub.Event) bool {
+		if e.Type != eventChirpCreated && e.Type != eventChirpDeleted {
+			return false
+		}
+		if len(authors) > 0 && !slices.Contains(authors, e.UserID) {
+			return false
+		}
+		return !slices.Contains(hidden, e.UserID)
+	})
+	if err != nil {
+		respondStreamUnavailable(w, r, err)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	rc := http.NewResponseController(w)
+	// the server's WriteTimeout would otherwise cut every stream off
+	rc.SetWriteDeadline(time.Time{})
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Access-Control-Allow-Origin", "*")
+	// stop nginx from buffering the stream
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	if lastEventID != "" && (!known || !complete) {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventReset)
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				if errors.Is(sub.Err(), hub.ErrSlowConsumer) {
+					slog.WarnContext(r.Context(), "dropped slow stream client")
+				}
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", cfg.formatEventID(e.ID), e.Type, e.Data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// respondStreamUnavailable answers a request for a stream the hub
+// refused to open.
+func respondStreamUnavailable(w http.ResponseWriter, r *http.Request, err error) {
+	detail := "too many open streams, try again shortly"
+	if errors.Is(err, hub.ErrClosed) {
+		detail = "the server is shutting down"
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(streamRetry.Seconds())))
+	respondWithError(w, r, problem.Wrap(problem.Unavailable, err, detail))
+}
+
+// formatEventID returns the ID clients see for hub event seq.
+func (cfg *apiConfig) formatEventID(seq uint64) string {
+	return cfg.streamEpoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// parseEventID returns the sequence number in an event ID this process
+// issued. known is false for IDs from another process, which can't be
+// resumed from.
+func (cfg *apiConfig) parseEventID(id string) (seq uint64, known bool) {
+	epoch, n, ok := strings.Cut(id, "-")
+	if !ok || epoch != cfg.streamEpoch {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(n, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return seq, true
+}
+
+// isStream reports whether r is for a long-lived event stream or
+// WebSocket.
+func isStream(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/stream/") || r.URL.Path == "/api/ws"
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	id, event, data string
+}
+
+// sseReader reads events from a stream, skipping comments and fields
+// other than id, event and data.
+type sseReader struct {
+	t    *testing.T
+	resp *http.Response
+	r    *bufio.Reader
+}
+
+func (c *apiClient) stream(path, authorization, lastEventID string) *sseReader {
+	c.t.Helper()
+	req, err := http.NewRequest("GET", c.server.URL+path, nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := c.server.Client().Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		c.t.Fatalf("GET %s: %d %s", path, resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return &sseReader{t: c.t, resp: resp, r: bufio.NewReader(resp.Body)}
+}
+
+// next returns the next event, failing the test if none arrives in time.
+func (s *sseReader) next() sseEvent {
+	s.t.Helper()
+	done := make(chan sseEvent, 1)
+	go func() {
+		var e sseEvent
+		for {
+			line, err := s.r.ReadString('\n')
+			if err != nil {
+				close(done)
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" && e.event != "" {
+				done <- e
+				return
+			}
+			field, value, _ := strings.Cut(line, ": ")
+			switch field {
+			case "id":
+				e.id = value
+			case "event":
+				e.event = value
+			case "data":
+				e.data = value
+			}
+		}
+	}()
+	select {
+	case e, ok := <-done:
+		if !ok {
+			s.t.Fatal("stream ended")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("no event within 5s")
+	}
+	return sseEvent{}
+}
+
+func TestStreamChirps(t *testing.T) {
+	c := newTestAPI(t)
+
+	alice := c.signup("alice@example.com")
+	bob := c.signup("bob@example.com")
+	carol := c.signup("carol@example.com")
+
+	everything := c.stream("/api/stream/chirps", "", "")
+	onlyAlice := c.stream("/api/stream/chirps?author_id="+alice.id, "", "")
+	c.mustDo("POST", "/api/users/"+bob.id+"/mute", carol.auth, nil)
+	carolsView := c.stream("/api/stream/chirps", carol.auth, "")
+
+	first := c.mustDo("POST", "/api/chirps", bob.auth, map[string]string{"body": "bob's kerfuffle"})
+	second := c.mustDo("POST", "/api/chirps", alice.auth, map[string]string{"body": "alice's chirp"})
+	c.mustDo("DELETE", "/api/chirps/"+second["id"].(string), alice.auth, nil)
+
+	e := everything.next()
+	var chirp Chirp
+	if err := json.Unmarshal([]byte(e.data), &chirp); err != nil {
+		t.Fatal(err)
+	}
+	if e.event != eventChirpCreated || chirp.Id.String() != first["id"] || chirp.Body != "bob's ****" {
+		t.Errorf("first event = %+v, want bob's masked chirp", e)
+	}
+	if e := everything.next(); e.event != eventChirpCreated {
+		t.Errorf("second event = %+v, want chirp.created", e)
+	}
+	lastSeen := e.id
+	if e := everything.next(); e.event != eventChirpDeleted || !strings.Contains(e.data, second["id"].(string)) {
+		t.Errorf("third event = %+v, want alice's chirp deleted", e)
+	}
+
+	if e := onlyAlice.next(); e.event != eventChirpCreated || !strings.Contains(e.data, "alice's chirp") {
+		t.Errorf("author stream got %+v, want alice's chirp", e)
+	}
+	if e := carolsView.next(); e.event != eventChirpCreated || !strings.Contains(e.data, "alice's chirp") {
+		t.Errorf("carol's stream got %+v, want alice's chirp and not bob's", e)
+	}
+
+	// resuming after the first event replays the rest
+	resumed := c.stream("/api/stream/chirps", "", lastSeen)
+	if e := resumed.next(); e.event != eventChirpCreated || !strings.Contains(e.data, "alice's chirp") {
+		t.Errorf("resumed stream got %+v, want alice's chirp", e)
+	}
+	if e := resumed.next(); e.event != eventChirpDeleted {
+		t.Errorf("resumed stream got %+v, want chirp.deleted", e)
+	}
+
+	// an ID from another server can't be resumed from
+	if e := c.stream("/api/stream/chirps", "", "feedface-1").next(); e.event != eventReset {
+		t.Errorf("stream resumed from a foreign ID got %+v, want reset", e)
+	}
+}
+
+type testUser struct {
+	id, auth string
+}
+
+func (c *apiClient) signup(email string) testUser {
+	c.t.Helper()
+	user := c.mustDo("POST", "/api/users", "", map[string]string{"email": email, "password": "password123"})
+	login := c.mustDo("POST", "/api/login", "", map[string]string{"email": email, "password": "password123"})
+	return testUser{id: user["id"].(string), auth: bearer(login["token"])}
+}
+
+// mustDo is do for requests that must succeed, decoding any JSON object in
+// the response.
+func (c *apiClient) mustDo(method, path, authorization string, body any) map[string]any {
+	c.t.Helper()
+	status, dat := c.do(method, path, authorization, body)
+	if status >= 300 {
+		c.t.Fatalf("%s %s: %d %s", method, path, status, dat)
+	}
+	var m map[string]any
+	json.Unmarshal(dat, &m)
+	return m
+}
@@ -1,11 +1,12 @@
 package main
 
 import (
-	"log"
+	"database/sql"
+	"errors"
 	"net/http"
-	"time"
 
 	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/problem"
 )
 
 func (cfg *apiConfig) handlerRevokeToken(w http.ResponseWriter, r *http.Request) {
@@ -13,13 +14,17 @@ func (cfg *apiConfig) handlerRevokeToken(w http.ResponseWriter, r *http.Request)
 
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
+		respondWithError(w, r, problem.Wrap(problem.Unauthorized, err, "a bearer refresh token is required"))
 		return
 	}
 
-	_, err = cfg.db.RevokeToken(r.Context(), token)
+	_, err = cfg.store.RevokeToken(r.Context(), token)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, problem.Wrap(problem.Unauthorized, err, "invalid refresh token"))
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't revoke token"))
 		return
 	}
 
@@ -35,22 +40,26 @@ func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request
 	}
 
 	token, err := auth.GetBearerToken(r.Header)
-	log.Printf("Bearer token: %s", token)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, problem.Wrap(problem.Unauthorized, err, "a bearer refresh token is required"))
 		return
 	}
 
-	rToken, err := cfg.db.GetUserFromRefreshToken(r.Context(), token)
+	rToken, err := cfg.store.GetUserFromRefreshToken(r.Context(), token)
 	if err != nil || rToken.Token == "" {
-		log.Printf("Error pulling token from db: %v", err)
-		respondWithError(w, http.StatusUnauthorized, "invalid token")
+		respondWithError(w, r, problem.Wrap(problem.Unauthorized, err, "invalid or expired refresh token"))
+		return
+	}
+
+	user, err := cfg.store.GetUser(r.Context(), rToken.UserID)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Unauthorized, err, "invalid or expired refresh token"))
 		return
 	}
 
-	jwt, err := auth.MakeJWT(rToken.UserID, cfg.jwtSecret, time.Hour)
+	jwt, err := auth.MakeJWTWithRole(user.ID, auth.Role(user.Role), cfg.jwtSecret, cfg.accessTokenTTL)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't create access token"))
 		return
 	}
 
@@ -1,54 +1,88 @@
 package main
 
 import (
-	"encoding/json"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jwoodsiii/chirpy/internal/auth"
 	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/jobs"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+	"github.com/jwoodsiii/chirpy/internal/store"
 )
 
 func (cfg *apiConfig) handlerUpgradeChirpy(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	type requestBody struct {
-		Event string `json:"event"`
+		Event string `json:"event" validate:"required"`
 		Data  struct {
-			UserID string `json:"user_id"`
+			UserID string `json:"user_id" validate:"required,uuid"`
 		} `json:"data"`
 	}
 
-	_, err := auth.GetAuthValueFromHeader(r.Header, "ApiKey")
+	apiKey, err := auth.GetAuthValueFromHeader(r.Header, "ApiKey")
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
+		respondWithError(w, r, problem.Wrap(problem.Unauthorized, err, "an ApiKey authorization header is required"))
 		return
 	}
-
-	dat, err := io.ReadAll(r.Body)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+	if cfg.polkaKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.polkaKey)) != 1 {
+		respondWithError(w, r, problem.New(problem.Unauthorized, "invalid API key"))
 		return
 	}
 
 	var params requestBody
-	if err := json.Unmarshal(dat, &params); err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+	if err := decodeJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
-	if params.Event != "user.upgraded" {
-		respondWithError(w, http.StatusNoContent, "Event not supported")
+	// Polka only needs a 2xx to stop retrying events we don't handle.
+	if params.Event != eventUserUpgraded {
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	_, err = cfg.db.UpgradeUser(r.Context(), uuid.MustParse(params.Data.UserID))
+	userID, err := uuid.Parse(params.Data.UserID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, err.Error())
+		respondWithError(w, r, problem.Wrap(problem.BadRequest, err, "user_id is not a valid UUID"))
+		return
+	}
+	var welcome database.Notification
+	var notified bool
+	err = cfg.store.InTx(r.Context(), func(tx store.Store, exec jobs.Execer) error {
+		user, err := tx.UpgradeUser(r.Context(), userID)
+		if err != nil {
+			return err
+		}
+		q := postgresQueries(tx)
+		// Polka retries deliveries, which the notification's key dedupes.
+		welcome, notified, err = notify(r.Context(), q, notification{
+			userID: user.ID,
+			typ:    notificationChirpyRed,
+			group:  notificationChirpyRed,
+			key:    params.Event,
+		})
+		if err != nil {
+			return err
+		}
+		return cfg.enqueueWebhooks(r.Context(), q, exec, eventUserUpgraded, user.ID, UserUpgraded{UserID: user.ID})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, problem.Wrap(problem.NotFound, err, "user not found"))
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't upgrade user"))
+		return
+	}
+	if notified {
+		cfg.publishNotification(welcome)
 	}
 
 	respondWithJson(w, http.StatusNoContent, "")
@@ -59,8 +93,8 @@ func (cfg *apiConfig) handlerUserUpdates(w http.ResponseWriter, r *http.Request)
 	defer r.Body.Close()
 
 	type requestBody struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password" validate:"required,password"`
 	}
 
 	type responseBody struct {
@@ -70,37 +104,31 @@ func (cfg *apiConfig) handlerUserUpdates(w http.ResponseWriter, r *http.Request)
 		Email     string    `json:"email"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.authenticate(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
+		respondWithError(w, r, err)
 		return
 	}
 
-	dat, err := io.ReadAll(r.Body)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
-	}
-
 	var params requestBody
-	if err := json.Unmarshal(dat, &params); err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+	if err := decodeJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
 	}
 
 	hashed, err := auth.HashPassword(params.Password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, problem.Wrap(problem.ValidationFailed, err, "password can't be used"))
 		return
 	}
 
-	user, err := cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{ID: userID, Email: params.Email, HashedPassword: hashed})
+	user, err := cfg.store.UpdateUser(r.Context(), database.UpdateUserParams{ID: userID, Email: params.Email, HashedPassword: hashed})
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
+		if problem.CodeOf(err) == problem.Conflict {
+			respondWithError(w, r, problem.Wrap(problem.Conflict, err, "an account with that email already exists"))
+			return
+		}
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't update user"))
 		return
 	}
 
@@ -117,8 +145,8 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	type requestBody struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required"`
+		Password string `json:"password" validate:"required"`
 	}
 
 	type responseBody struct {
@@ -127,62 +155,67 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt    time.Time `json:"updated_at"`
 		Email        string    `json:"email"`
 		IsChirpyRed  bool      `json:"is_chirpy_red"`
+		Role         string    `json:"role"`
 		Token        string    `json:"token"`
 		RefreshToken string    `json:"refresh_token"`
 	}
 
-	dat, err := io.ReadAll(r.Body)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "couldn't read request")
-		return
-	}
-
 	var params requestBody
-	if err := json.Unmarshal(dat, &params); err != nil {
-		respondWithError(w, http.StatusBadRequest, "couldn't unmarshal request")
+	if err := decodeJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
-	expirationTime := time.Hour
-
-	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	user, err := cfg.store.GetUserByEmail(r.Context(), params.Email)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "user not found")
+		cfg.metrics.failedLogins.With("unknown_email").Inc()
+		respondWithError(w, r, problem.New(problem.NotFound, "user not found"))
 		return
 	}
 
 	exists, err := auth.CheckPasswordHash(params.Password, user.HashedPassword)
 	if err != nil || !exists {
-		respondWithError(w, http.StatusUnauthorized, "incorrect email or password")
+		cfg.metrics.failedLogins.With("bad_password").Inc()
+		respondWithError(w, r, problem.New(problem.Unauthorized, "incorrect email or password"))
 		return
 	}
 
-	jwt, err := auth.MakeJWT(user.ID, cfg.jwtSecret, expirationTime)
+	if restriction := accountRestriction(user); restriction != "" {
+		cfg.metrics.failedLogins.With("restricted").Inc()
+		respondWithError(w, r, problem.New(problem.Forbidden, restriction))
+		return
+	}
+
+	jwt, err := auth.MakeJWTWithRole(user.ID, auth.Role(user.Role), cfg.jwtSecret, cfg.accessTokenTTL)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT")
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't create access token"))
 		return
 	}
 
 	refresh, err := auth.MakeRefreshToken()
 	if err != nil {
-		log.Printf("Auth error: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token")
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't create refresh token"))
 		return
 	}
 
-	refreshToken, err := cfg.db.CreateToken(r.Context(), database.CreateTokenParams{Token: refresh, UserID: user.ID})
+	refreshToken, err := cfg.store.CreateToken(r.Context(), database.CreateTokenParams{
+		Token:     refresh,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(cfg.refreshTokenTTL),
+	})
 	if err != nil {
-		log.Printf("Database error: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token")
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't create refresh token"))
 		return
 	}
 
+	cfg.metrics.logins.Inc()
 	respondWithJson(w, http.StatusOK, responseBody{
 		Id:           user.ID,
 		CreatedAt:    user.CreatedAt,
 		UpdatedAt:    user.UpdatedAt,
 		Email:        user.Email,
 		IsChirpyRed:  user.IsChirpyRed,
+		Role:         user.Role,
 		Token:        jwt,
 		RefreshToken: refreshToken.Token,
 	})
@@ -192,8 +225,8 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 	defer r.Body.Close()
 
 	type requestBody struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password" validate:"required,password"`
 	}
 
 	type responseBody struct {
@@ -204,31 +237,28 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		IsChirpyRed bool      `json:"is_chirpy_red"`
 	}
 
-	dat, err := io.ReadAll(r.Body)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "couldn't read request")
-		return
-	}
-
 	var params requestBody
-	if err := json.Unmarshal(dat, &params); err != nil {
-		respondWithError(w, http.StatusBadRequest, "couldn't unmarshal request")
+	if err := decodeJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
 	hashed, err := auth.HashPassword(params.Password)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "couldn't hash password")
+		respondWithError(w, r, problem.Wrap(problem.ValidationFailed, err, "password can't be used"))
 		return
 	}
 
-	user, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{Email: params.Email, HashedPassword: hashed})
+	user, err := cfg.store.CreateUser(r.Context(), database.CreateUserParams{Email: params.Email, HashedPassword: hashed})
 	if err != nil {
-		// log.Printf("DB error: %v", err)
-		respondWithError(w, http.StatusBadRequest, "couldn't create user")
-		fmt.Printf("DB error: %v", err)
+		if problem.CodeOf(err) == problem.Conflict {
+			respondWithError(w, r, problem.Wrap(problem.Conflict, err, "an account with that email already exists"))
+			return
+		}
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't create user"))
 		return
 	}
+	cfg.metrics.usersCreated.Inc()
 
 	respondWithJson(w, 201, responseBody{
 		Id:          user.ID,
@@ -238,3 +268,15 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		IsChirpyRed: user.IsChirpyRed,
 	})
 }
+
+// accountRestriction explains why user may not sign in or post, or returns
+// an empty string when the account is in good standing.
+func accountRestriction(user database.User) string {
+	if user.BannedAt.Valid {
+		return "account is banned"
+	}
+	if user.SuspendedUntil.Valid && user.SuspendedUntil.Time.After(time.Now().UTC()) {
+		return fmt.Sprintf("account is suspended until %s", user.SuspendedUntil.Time.Format(time.RFC3339))
+	}
+	return ""
+}
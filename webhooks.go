@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/jobs"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+	"github.com/jwoodsiii/chirpy/internal/validate"
+	"github.com/jwoodsiii/chirpy/internal/webhook"
+)
+
+const (
+	eventUserUpgraded = "user.upgraded"
+	// eventWebhookPing is sent by the ping endpoint, whatever events the
+	// webhook subscribes to.
+	eventWebhookPing = "ping"
+
+	webhookPending   = "pending"
+	webhookDelivered = "delivered"
+	webhookDead      = "dead"
+
+	maxWebhooksPerUser = 10
+	// webhookConcurrency is how many deliveries an instance sends at once,
+	// so slow endpoints can't take up every job slot.
+	webhookConcurrency = 8
+	// A failed delivery is retried after a minute, doubling up to twelve
+	// hours.
+	webhookFirstBackoff = time.Minute
+	webhookMaxBackoff   = 12 * time.Hour
+)
+
+// deliverWebhookJob sends one delivery from the outbox.
+var deliverWebhookJob = jobs.Kind[deliverWebhookArgs]{Name: "webhook.deliver"}
+
+type deliverWebhookArgs struct {
+	DeliveryID uuid.UUID `json:"delivery_id"`
+}
+
+// webhookEvents are the events a webhook can subscribe to.
+var webhookEvents = []string{eventChirpCreated, eventChirpDeleted, eventUserUpgraded}
+
+type Webhook struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	AllUsers  bool      `json:"all_users"`
+	// Secret signs the deliveries. It is only shown when the webhook is
+	// created.
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// webhookPayload is the body of every delivery. ID identifies the event,
+// so a receiver can recognise one it has seen when a delivery is retried.
+type webhookPayload struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// UserUpgraded is the data of a user.upgraded event.
+type UserUpgraded struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func newWebhookPayload(typ string, data any) (json.RawMessage, error) {
+	return json.Marshal(webhookPayload{
+		ID:        uuid.New(),
+		Type:      typ,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+}
+
+// enqueueWebhooks adds an event about userID to the outbox of every
+// webhook subscribed to it, the user's own and those of admins receiving
+// every user's events, and queues a job to send each delivery. q and tx
+// must be the same transaction, so the event is only sent if the change
+// it describes is committed. A nil q is a store without webhooks, so
+// there is nothing to send.
+func (cfg *apiConfig) enqueueWebhooks(ctx context.Context, q *database.Queries, tx jobs.Execer, typ string, userID uuid.UUID, data any) error {
+	if q == nil {
+		return nil
+	}
+	payload, err := newWebhookPayload(typ, data)
+	if err != nil {
+		return fmt.Errorf("encode %s webhook: %w", typ, err)
+	}
+	ids, err := q.EnqueueWebhookEvent(ctx, database.EnqueueWebhookEventParams{
+		EventType: typ,
+		Payload:   payload,
+		UserID:    userID,
+	})
+	if err != nil {
+		return fmt.Errorf("enqueue %s webhook: %w", typ, err)
+	}
+	for _, id := range ids {
+		if err := cfg.queueWebhookDelivery(ctx, tx, id); err != nil {
+			return fmt.Errorf("enqueue %s webhook: %w", typ, err)
+		}
+	}
+	return nil
+}
+
+// queueWebhookDelivery queues the job that sends a delivery.
+func (cfg *apiConfig) queueWebhookDelivery(ctx context.Context, tx jobs.Execer, deliveryID uuid.UUID) error {
+	return deliverWebhookJob.Enqueue(ctx, tx, deliverWebhookArgs{DeliveryID: deliveryID},
+		jobs.MaxAttempts(cfg.webhookMaxAttempts))
+}
+
+// deliverWebhook sends a delivery and records the outcome: delivered,
+// pending with the next attempt backed off, or dead once it has used up
+// its attempts. A delivery that is no longer pending has been sent
+// already or belonged to a deleted webhook.
+func (cfg *apiConfig) deliverWebhook(ctx context.Context, job *jobs.Job[deliverWebhookArgs]) error {
+	d, err := cfg.db.StartWebhookAttempt(ctx, job.Args.DeliveryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	status, sendErr := cfg.webhooks.Send(ctx, d.Url, d.Secret, d.EventType, d.ID.String(), d.Payload)
+	attempt := database.RecordWebhookAttemptParams{
+		ID:             d.ID,
+		Status:         webhookDelivered,
+		NextAttemptAt:  time.Now().UTC(),
+		LastStatusCode: sql.NullInt32{Int32: int32(status), Valid: status != 0},
+	}
+	outcome := webhookDelivered
+	var retryIn time.Duration
+	if sendErr != nil {
+		attempt.LastError = sendErr.Error()
+		if int(d.Attempts) < job.MaxAttempts {
+			retryIn = jobs.ExponentialBackoff(int(d.Attempts), webhookFirstBackoff, webhookMaxBackoff)
+			attempt.Status = webhookPending
+			attempt.NextAttemptAt = attempt.NextAttemptAt.Add(retryIn)
+			outcome = "retry"
+		} else {
+			attempt.Status = webhookDead
+			outcome = webhookDead
+		}
+	}
+	cfg.metrics.webhookAttempts.With(outcome).Inc()
+
+	// the attempt happened even if the job is being interrupted
+	if err := cfg.db.RecordWebhookAttempt(context.WithoutCancel(ctx), attempt); err != nil {
+		return fmt.Errorf("record webhook attempt: %w", err)
+	}
+	switch attempt.Status {
+	case webhookPending:
+		return jobs.RetryAfter(sendErr, retryIn)
+	case webhookDead:
+		return jobs.Permanent(sendErr)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type requestBody struct {
+		URL    string   `json:"url" validate:"required,max=2048"`
+		Events []string `json:"events" validate:"required,max=10"`
+		// AllUsers subscribes to every user's events rather than only the
+		// caller's. Only admins may set it.
+		AllUsers bool `json:"all_users"`
+	}
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var params requestBody
+	if err := decodeJSON(w, r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var errs validate.Errors
+	if err := webhook.CheckURL(params.URL, cfg.webhookAllowPrivate); errors.Is(err, webhook.ErrPrivateAddress) {
+		errs = append(errs, validate.FieldError{Field: "url", Message: "must not be a private address"})
+	} else if err != nil {
+		errs = append(errs, validate.FieldError{Field: "url", Message: err.Error()})
+	}
+	for i, e := range params.Events {
+		if !slices.Contains(webhookEvents, e) {
+			errs = append(errs, validate.FieldError{
+				Field:   fmt.Sprintf("events[%d]", i),
+				Message: "must be one of " + strings.Join(webhookEvents, ", "),
+			})
+		}
+	}
+	if len(errs) > 0 {
+		respondWithError(w, r, errs)
+		return
+	}
+	slices.Sort(params.Events)
+	params.Events = slices.Compact(params.Events)
+
+	if params.AllUsers {
+		user, err := cfg.store.GetUser(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't create webhook"))
+			return
+		}
+		if !auth.Role(user.Role).AtLeast(auth.RoleAdmin) {
+			respondWithError(w, r, problem.New(problem.Forbidden, "only admins can receive every user's events"))
+			return
+		}
+	}
+
+	n, err := cfg.db.CountWebhookEndpoints(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't create webhook"))
+		return
+	}
+	if n >= maxWebhooksPerUser {
+		respondWithError(w, r, problem.Newf(problem.Conflict, "you can't have more than %d webhooks", maxWebhooksPerUser))
+		return
+	}
+
+	endpoint, err := cfg.db.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID:   userID,
+		Url:      params.URL,
+		Secret:   webhook.NewSecret(),
+		Events:   params.Events,
+		AllUsers: params.AllUsers,
+	})
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't create webhook"))
+		return
+	}
+
+	res := webhookFromDB(endpoint)
+	res.Secret = endpoint.Secret
+	respondWithJson(w, http.StatusCreated, res)
+}
+
+func (cfg *apiConfig) handlerListWebhooks(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	endpoints, err := cfg.db.ListWebhookEndpoints(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't retrieve webhooks"))
+		return
+	}
+
+	webhooks := []Webhook{}
+	for _, e := range endpoints {
+		webhooks = append(webhooks, webhookFromDB(e))
+	}
+	respondWithJson(w, http.StatusOK, webhooks)
+}
+
+func (cfg *apiConfig) handlerDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	id, err := pathUUID(r, "webhookID")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	n, err := cfg.db.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{ID: id, UserID: userID})
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't delete webhook"))
+		return
+	}
+	if n == 0 {
+		respondWithError(w, r, problem.New(problem.NotFound, "webhook not found"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPingWebhook queues a ping to one webhook, so its owner can check
+// it is reachable and verifies signatures.
+func (cfg *apiConfig) handlerPingWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	endpoint, err := cfg.ownWebhook(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	payload, err := newWebhookPayload(eventWebhookPing, map[string]uuid.UUID{"webhook_id": endpoint.ID})
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't ping webhook"))
+		return
+	}
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't ping webhook"))
+		return
+	}
+	defer tx.Rollback()
+
+	delivery, err := cfg.db.WithTx(tx).CreateWebhookDelivery(r.Context(), database.CreateWebhookDeliveryParams{
+		EndpointID: endpoint.ID,
+		EventType:  eventWebhookPing,
+		Payload:    payload,
+	})
+	if err == nil {
+		err = cfg.queueWebhookDelivery(r.Context(), tx, delivery.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't ping webhook"))
+		return
+	}
+
+	respondWithJson(w, http.StatusAccepted, webhookDeliveryFromDB(delivery))
+}
+
+func (cfg *apiConfig) handlerListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	endpoint, err := cfg.ownWebhook(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	dbDeliveries, err := cfg.db.ListWebhookDeliveries(r.Context(), database.ListWebhookDeliveriesParams{
+		EndpointID: endpoint.ID,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't retrieve deliveries"))
+		return
+	}
+
+	deliveries := []WebhookDelivery{}
+	for _, d := range dbDeliveries {
+		deliveries = append(deliveries, webhookDeliveryFromDB(d))
+	}
+	respondWithJson(w, http.StatusOK, deliveries)
+}
+
+// handlerRedeliverWebhook queues a delivered or dead-lettered delivery to
+// be sent again, with a fresh set of attempts.
+func (cfg *apiConfig) handlerRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	endpoint, err := cfg.ownWebhook(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	deliveryID, err := pathUUID(r, "deliveryID")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't redeliver webhook"))
+		return
+	}
+	defer tx.Rollback()
+
+	delivery, err := cfg.db.WithTx(tx).RedeliverWebhook(r.Context(), database.RedeliverWebhookParams{
+		ID:         deliveryID,
+		EndpointID: endpoint.ID,
+	})
+	if err == nil {
+		err = cfg.queueWebhookDelivery(r.Context(), tx, delivery.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, problem.New(problem.NotFound, "delivery not found, or it is still pending"))
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't redeliver webhook"))
+		return
+	}
+
+	respondWithJson(w, http.StatusAccepted, webhookDeliveryFromDB(delivery))
+}
+
+// ownWebhook authenticates r and returns the caller's webhook named by the
+// webhookID path value.
+func (cfg *apiConfig) ownWebhook(r *http.Request) (database.WebhookEndpoint, error) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		return database.WebhookEndpoint{}, err
+	}
+
+	id, err := pathUUID(r, "webhookID")
+	if err != nil {
+		return database.WebhookEndpoint{}, err
+	}
+
+	endpoint, err := cfg.db.GetWebhookEndpoint(r.Context(), database.GetWebhookEndpointParams{ID: id, UserID: userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.WebhookEndpoint{}, problem.Wrap(problem.NotFound, err, "webhook not found")
+	}
+	if err != nil {
+		return database.WebhookEndpoint{}, problem.Wrap(problem.Internal, err, "couldn't retrieve webhook")
+	}
+	return endpoint, nil
+}
+
+func webhookFromDB(e database.WebhookEndpoint) Webhook {
+	return Webhook{
+		ID:        e.ID,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+		URL:       e.Url,
+		Events:    e.Events,
+		AllUsers:  e.AllUsers,
+	}
+}
+
+func webhookDeliveryFromDB(d database.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID:            d.ID,
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+		Event:         d.EventType,
+		Status:        d.Status,
+		Attempts:      int(d.Attempts),
+		LastAttemptAt: nullTimePtr(d.LastAttemptAt),
+		LastError:     d.LastError,
+		Payload:       d.Payload,
+	}
+	if d.Status == webhookPending {
+		delivery.NextAttemptAt = &d.NextAttemptAt
+	}
+	if d.LastStatusCode.Valid {
+		code := int(d.LastStatusCode.Int32)
+		delivery.LastStatusCode = &code
+	}
+	return delivery
+}
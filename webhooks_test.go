@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/jobs"
+	"github.com/jwoodsiii/chirpy/internal/store"
+	"github.com/jwoodsiii/chirpy/internal/webhook"
+)
+
+// webhookReceiver records the deliveries it gets, answering each with the
+// next of its statuses.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	got      []receivedDelivery
+}
+
+type receivedDelivery struct {
+	header http.Header
+	body   []byte
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.got = append(rcv.got, receivedDelivery{header: r.Header, body: body})
+	status := http.StatusNoContent
+	if len(rcv.statuses) > 0 {
+		status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rcv *webhookReceiver) last() receivedDelivery {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return rcv.got[len(rcv.got)-1]
+}
+
+func TestWebhooks(t *testing.T) {
+	c := newTestAPI(t)
+	alice := c.signup("alice@example.com")
+	if status, _ := c.do("GET", "/api/webhooks", alice.auth, nil); status == http.StatusNotImplemented {
+		t.Skip("webhooks need Postgres")
+	}
+	c.cfg.webhookMaxAttempts = 1
+
+	rcv := &webhookReceiver{statuses: []int{http.StatusInternalServerError}}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	if status, _ := c.do("POST", "/api/webhooks", alice.auth, map[string]any{"url": srv.URL, "events": []string{"chirp.liked"}}); status != http.StatusBadRequest {
+		t.Errorf("unknown event: %d, want 400", status)
+	}
+	if status, _ := c.do("POST", "/api/webhooks", alice.auth, map[string]any{"url": srv.URL, "events": []string{eventChirpCreated}, "all_users": true}); status != http.StatusForbidden {
+		t.Errorf("all_users as a plain user: %d, want 403", status)
+	}
+	hook := c.mustDo("POST", "/api/webhooks", alice.auth, map[string]any{"url": srv.URL, "events": []string{eventChirpCreated}})
+	secret, _ := hook["secret"].(string)
+	if !strings.HasPrefix(secret, "whsec_") {
+		t.Fatalf("created webhook = %v, want a secret", hook)
+	}
+	hookPath := "/api/webhooks/" + hook["id"].(string)
+
+	// the first attempt fails, and with one attempt allowed is dead-lettered
+	c.mustDo("POST", "/api/chirps", alice.auth, map[string]string{"body": "hello hooks"})
+	deliver(t, c, 1)
+	status, dat := c.do("GET", hookPath+"/deliveries", alice.auth, nil)
+	var deliveries []WebhookDelivery
+	if err := json.Unmarshal(dat, &deliveries); status != http.StatusOK || err != nil || len(deliveries) != 1 {
+		t.Fatalf("deliveries = %d %s, want one", status, dat)
+	}
+	if d := deliveries[0]; d.Status != webhookDead || d.LastStatusCode == nil || *d.LastStatusCode != http.StatusInternalServerError {
+		t.Errorf("delivery = %+v, want dead after a 500", d)
+	}
+
+	c.mustDo("POST", hookPath+"/deliveries/"+deliveries[0].ID.String()+"/redeliver", alice.auth, nil)
+	deliver(t, c, 1)
+	got := rcv.last()
+	if got.header.Get(webhook.EventHeader) != eventChirpCreated || !strings.Contains(string(got.body), "hello hooks") {
+		t.Errorf("redelivered %v %s, want the chirp.created event", got.header, got.body)
+	}
+	if err := webhook.Verify(secret, got.header.Get(webhook.SignatureHeader), got.body, time.Minute, time.Now()); err != nil {
+		t.Errorf("delivery signature: %v", err)
+	}
+
+	// pings reach the webhook whatever it subscribes to
+	c.mustDo("POST", hookPath+"/ping", alice.auth, nil)
+	deliver(t, c, 1)
+	if got := rcv.last(); got.header.Get(webhook.EventHeader) != eventWebhookPing {
+		t.Errorf("ping delivered as %q", got.header.Get(webhook.EventHeader))
+	}
+
+	bob := c.signup("bob@example.com")
+	if status, _ := c.do("GET", hookPath+"/deliveries", bob.auth, nil); status != http.StatusNotFound {
+		t.Errorf("another user's delivery log: %d, want 404", status)
+	}
+	c.mustDo("DELETE", hookPath, alice.auth, nil)
+	c.mustDo("POST", "/api/chirps", alice.auth, map[string]string{"body": "anyone listening?"})
+	deliver(t, c, 0)
+}
+
+// TestAllUsersWebhooksNeedAnAdmin checks a webhook for every user's events
+// stops getting them once its owner is no longer an admin.
+func TestAllUsersWebhooksNeedAnAdmin(t *testing.T) {
+	c := newTestAPI(t)
+	admin := c.mustDo("POST", "/api/login", "", map[string]string{"email": testAdminEmail, "password": testAdminPassword})
+	adminAuth := bearer(admin["token"])
+	if status, _ := c.do("GET", "/api/webhooks", adminAuth, nil); status == http.StatusNotImplemented {
+		t.Skip("webhooks need Postgres")
+	}
+	alice := c.signup("alice@example.com")
+	carol := c.signup("carol@example.com")
+
+	srv := httptest.NewServer(&webhookReceiver{})
+	defer srv.Close()
+
+	c.mustDo("PUT", "/admin/users/"+carol.id+"/role", adminAuth, map[string]auth.Role{"role": auth.RoleAdmin})
+	login := c.mustDo("POST", "/api/login", "", map[string]string{"email": "carol@example.com", "password": "password123"})
+	c.mustDo("POST", "/api/webhooks", bearer(login["token"]), map[string]any{"url": srv.URL, "events": []string{eventChirpCreated}, "all_users": true})
+
+	c.mustDo("POST", "/api/chirps", alice.auth, map[string]string{"body": "seen by an admin"})
+	deliver(t, c, 1)
+
+	c.mustDo("PUT", "/admin/users/"+carol.id+"/role", adminAuth, map[string]auth.Role{"role": auth.RoleUser})
+	c.mustDo("POST", "/api/chirps", alice.auth, map[string]string{"body": "not for carol"})
+	deliver(t, c, 0)
+}
+
+// deliver runs the due jobs once, failing unless there are want of them.
+func deliver(t *testing.T, c *apiClient, want int) {
+	t.Helper()
+	n, err := c.cfg.jobs.Work(context.Background())
+	if err != nil || n != want {
+		t.Fatalf("jobs.Work() = %d, %v; want %d", n, err, want)
+	}
+}
+
+// TestWebhooksShareTheWriteTransaction checks an event is queued with the
+// change it describes: when queueing fails, the change is rolled back.
+func TestWebhooksShareTheWriteTransaction(t *testing.T) {
+	c := newTestAPI(t)
+	alice := c.signup("alice@example.com")
+	if status, _ := c.do("GET", "/api/webhooks", alice.auth, nil); status == http.StatusNotImplemented {
+		t.Skip("webhooks need Postgres")
+	}
+	c.mustDo("POST", "/api/webhooks", alice.auth, map[string]any{
+		"url":    "http://127.0.0.1:1/hooks",
+		"events": []string{eventChirpCreated, eventChirpDeleted, eventUserUpgraded},
+	})
+	chirp := c.mustDo("POST", "/api/chirps", alice.auth, map[string]string{"body": "kept"})
+	chirpPath := "/api/chirps/" + chirp["id"].(string)
+
+	// from here on the deliveries can't be queued
+	st := c.cfg.store
+	c.cfg.store = failingJobsStore{st}
+
+	if status, _ := c.do("POST", "/api/chirps", alice.auth, map[string]string{"body": "lost"}); status != http.StatusInternalServerError {
+		t.Errorf("creating a chirp whose webhook can't be queued: %d, want 500", status)
+	}
+	status, dat := c.do("GET", "/api/chirps?author_id="+alice.id, "", nil)
+	var chirps []Chirp
+	if err := json.Unmarshal(dat, &chirps); status != http.StatusOK || err != nil || len(chirps) != 1 {
+		t.Errorf("alice's chirps = %d %s, want only the first", status, dat)
+	}
+
+	if status, _ := c.do("DELETE", chirpPath, alice.auth, nil); status != http.StatusInternalServerError {
+		t.Errorf("deleting a chirp whose webhook can't be queued: %d, want 500", status)
+	}
+	if status, _ := c.do("GET", chirpPath, "", nil); status != http.StatusOK {
+		t.Errorf("chirp after a failed delete: %d, want 200", status)
+	}
+
+	upgrade := map[string]any{"event": eventUserUpgraded, "data": map[string]string{"user_id": alice.id}}
+	if status, _ := c.do("POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey, upgrade); status != http.StatusInternalServerError {
+		t.Errorf("upgrade whose webhook can't be queued: %d, want 500", status)
+	}
+	login := c.mustDo("POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "password123"})
+	if login["is_chirpy_red"] != false {
+		t.Errorf("alice after a failed upgrade: %v, want not Chirpy Red", login)
+	}
+
+	// nothing was queued by the failed writes
+	c.cfg.store = st
+	deliver(t, c, 1)
+}
+
+// failingJobsStore is a Store whose transactions fail to queue jobs.
+type failingJobsStore struct {
+	store.Store
+}
+
+func (s failingJobsStore) InTx(ctx context.Context, fn func(tx store.Store, exec jobs.Execer) error) error {
+	return s.Store.InTx(ctx, func(tx store.Store, _ jobs.Execer) error {
+		return fn(tx, failingExecer{})
+	})
+}
+
+type failingExecer struct{}
+
+func (failingExecer) ExecContext(context.Context, string, ...any) (sql.Result, error) {
+	return nil, errors.New("jobs table unavailable")
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+	"github.com/jwoodsiii/chirpy/internal/auth"
+	"github.com/jwoodsiii/chirpy/internal/database"
+	"github.com/jwoodsiii/chirpy/internal/hub"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+)
+
+const (
+	eventTyping   = "typing"
+	eventPresence = "presence"
+	// notificationEventPrefix starts the type of every event addressed to
+	// one user, which only that user's notifications channel receives.
+	notificationEventPrefix = "notification."
+
+	wsPingInterval  = 30 * time.Second
+	wsPingTimeout   = 10 * time.Second
+	wsWriteTimeout  = 10 * time.Second
+	wsMaxMessage    = 4096
+	wsMaxChannels   = 100
+	wsControlQueue  = 16
+	wsMaxTagLength  = 100
+	wsSignalBackoff = time.Second
+)
+
+// wsMessage is the envelope of every WebSocket message, in both
+// directions. Messages are JSON text frames.
+//
+// Client to server:
+//
+//	{"type": "subscribe", "id": "1", "channel": "timeline"}
+//	{"type": "unsubscribe", "id": "2", "channel": "user:<uuid>"}
+//	{"type": "ping", "id": "3"}
+//	{"type": "typing"}
+//	{"type": "presence", "data": {"status": "online"}}
+//
+// id is optional and chosen by the client; the server echoes it in the
+// ack, pong or error answering that message. Channels are timeline (every
+// chirp), user:<uuid> (one user's chirps, typing and presence), tag:<name>
+// (chirps carrying #name, case-insensitively) and notifications (events
+// addressed to the caller). An ack names the channel as events will carry
+// it, so tag:Go is acknowledged as tag:go. typing and presence are sent to
+// the subscribers of the caller's user channel and are limited to one a
+// second each; extra ones are dropped. Users can't subscribe to the
+// channel of someone who has blocked them.
+//
+// Server to client:
+//
+//	{"type": "ack", "id": "1", "channel": "timeline"}
+//	{"type": "pong", "id": "3"}
+//	{"type": "error", "id": "1", "error": {"code": "validation_failed", "message": "..."}}
+//	{"type": "event", "channel": "timeline", "event": "chirp.created", "event_id": "<epoch>-<seq>", "data": {...}}
+//
+// An event matching several of a connection's channels is sent once, on
+// the first channel it subscribed to.
+type wsMessage struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Channel string          `json:"channel,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	EventID string          `json:"event_id,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   *wsError        `json:"error,omitempty"`
+}
+
+type wsError struct {
+	Code    problem.Code `json:"code"`
+	Message string       `json:"message"`
+}
+
+// wsChannel is a parsed channel name.
+type wsChannel struct {
+	name   string
+	kind   string
+	userID uuid.UUID
+	tag    string
+}
+
+func parseWSChannel(name string) (wsChannel, error) {
+	kind, arg, _ := strings.Cut(name, ":")
+	c := wsChannel{name: name, kind: kind}
+	switch {
+	case name == "timeline", name == "notifications":
+		return c, nil
+	case kind == "user":
+		id, err := uuid.Parse(arg)
+		if err != nil {
+			return c, errors.New("user channels are user:<uuid>")
+		}
+		c.userID = id
+		return c, nil
+	case kind == "tag":
+		c.tag = strings.ToLower(strings.TrimPrefix(arg, "#"))
+		if c.tag == "" || len(c.tag) > wsMaxTagLength {
+			return c, errors.New("tag channels are tag:<name>")
+		}
+		c.name = "tag:" + c.tag
+		return c, nil
+	}
+	return c, errors.New("unknown channel")
+}
+
+// wsConn is one WebSocket client.
+type wsConn struct {
+	cfg       *apiConfig
+	conn      *websocket.Conn
+	userID    uuid.UUID
+	hidden    []uuid.UUID
+	canSignal bool
+
+	// control carries acks, pongs and errors to the writer; events come
+	// from sub, whose queue is the connection's send queue.
+	control chan wsMessage
+	sub     *hub.Subscription
+
+	mu       sync.Mutex
+	channels []wsChannel
+
+	lastSignal map[string]time.Time
+}
+
+// channelFor returns the first subscribed channel e belongs on, or "".
+// The hub calls it for every event, so it must stay cheap.
+func (c *wsConn) channelFor(e hub.Event) string {
+	isChirp := e.Type == eventChirpCreated || e.Type == eventChirpDeleted
+	isSignal := e.Type == eventTyping || e.Type == eventPresence
+	if (isChirp || isSignal) && slices.Contains(c.hidden, e.UserID) {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ch := range c.channels {
+		switch ch.kind {
+		case "timeline":
+			if isChirp {
+				return ch.name
+			}
+		case "user":
+			if (isChirp || isSignal) && e.UserID == ch.userID {
+				return ch.name
+			}
+		case "tag":
+			if isChirp && slices.Contains(e.Tags, ch.tag) {
+				return ch.name
+			}
+		case "notifications":
+			if strings.HasPrefix(e.Type, notificationEventPrefix) && e.UserID == c.userID {
+				return ch.name
+			}
+		}
+	}
+	return ""
+}
+
+// handlerWebSocket serves the real-time API described at wsMessage. The
+// access token goes in the Authorization header or, for browsers, which
+// can't set headers on a WebSocket, the access_token query parameter. The
+// connection is closed when the token expires, so the client reconnects
+// with a fresh one.
+func (cfg *apiConfig) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	token, err := auth.GetBearerToken(r.Header)
+	if errors.Is(err, auth.ErrNoAuthHeaderIncluded) {
+		token, err = r.URL.Query().Get("access_token"), nil
+	}
+	if err != nil || token == "" {
+		respondWithError(w, r, problem.New(problem.Unauthorized, "a bearer access token is required"))
+		return
+	}
+	claims, err := auth.ParseAccessToken(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Unauthorized, err, "invalid or expired access token"))
+		return
+	}
+
+	user, err := cfg.store.GetUser(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Unauthorized, err, "invalid or expired access token"))
+		return
+	}
+	if user.BannedAt.Valid {
+		respondWithError(w, r, problem.New(problem.Forbidden, "account is banned"))
+		return
+	}
+	hidden, err := cfg.store.ListHiddenUsers(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, r, problem.Wrap(problem.Internal, err, "couldn't open connection"))
+		return
+	}
+
+	c := &wsConn{
+		cfg:        cfg,
+		userID:     user.ID,
+		hidden:     hidden,
+		canSignal:  accountRestriction(user) == "",
+		control:    make(chan wsMessage, wsControlQueue),
+		lastSignal: map[string]time.Time{},
+	}
+	c.sub, _, err = cfg.events.Subscribe(0, func(e hub.Event) bool { return c.channelFor(e) != "" })
+	if err != nil {
+		respondStreamUnavailable(w, r, err)
+		return
+	}
+	defer c.sub.Unsubscribe()
+
+	// tokens authenticate the client, not cookies, so any origin may connect
+	c.conn, err = websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: []string{"*"}})
+	if err != nil {
+		// Accept has already written the response
+		return
+	}
+	defer c.conn.CloseNow()
+	c.conn.SetReadLimit(wsMaxMessage)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if !claims.ExpiresAt.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, claims.ExpiresAt)
+		defer cancel()
+	}
+	go c.readLoop(ctx, cancel)
+	go c.keepalive(ctx, cancel)
+	c.writeLoop(ctx)
+}
+
+// writeLoop sends queued messages until ctx ends or the subscription is
+// dropped, then closes the connection with the reason.
+func (c *wsConn) writeLoop(ctx context.Context) {
+	for {
+		var msg wsMessage
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				c.conn.Close(websocket.StatusPolicyViolation, "access token expired")
+			}
+			return
+		case msg = <-c.control:
+		case e, ok := <-c.sub.C:
+			if !ok {
+				switch err := c.sub.Err(); {
+				case errors.Is(err, hub.ErrSlowConsumer):
+					c.conn.Close(websocket.StatusTryAgainLater, "too slow reading events")
+				case errors.Is(err, hub.ErrClosed):
+					c.conn.Close(websocket.StatusGoingAway, "server shutting down")
+				}
+				return
+			}
+			channel := c.channelFor(e)
+			if channel == "" {
+				// unsubscribed while the event was queued
+				continue
+			}
+			msg = wsMessage{
+				Type:    "event",
+				Channel: channel,
+				Event:   e.Type,
+				Data:    e.Data,
+			}
+			if !e.Ephemeral {
+				msg.EventID = c.cfg.formatEventID(e.ID)
+			}
+		}
+
+		b, err := json.Marshal(msg)
+		if err != nil {
+			slog.ErrorContext(ctx, "couldn't encode websocket message", "err", err)
+			continue
+		}
+		writeCtx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+		err = c.conn.Write(writeCtx, websocket.MessageText, b)
+		cancel()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readLoop handles client messages until the connection fails, then
+// cancels the connection's context.
+func (c *wsConn) readLoop(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+	for {
+		typ, b, err := c.conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		if typ != websocket.MessageText {
+			c.conn.Close(websocket.StatusUnsupportedData, "messages must be JSON text")
+			return
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(b, &msg); err != nil {
+			c.reply(cancel, wsMessage{Type: "error", Error: &wsError{Code: problem.BadRequest, Message: "message is not valid JSON"}})
+			continue
+		}
+		c.reply(cancel, c.handle(ctx, msg))
+	}
+}
+
+// handle answers one client message. The zero wsMessage means no answer.
+func (c *wsConn) handle(ctx context.Context, msg wsMessage) wsMessage {
+	fail := func(code problem.Code, message string) wsMessage {
+		return wsMessage{Type: "error", ID: msg.ID, Error: &wsError{Code: code, Message: message}}
+	}
+
+	switch msg.Type {
+	case "subscribe", "unsubscribe":
+		ch, err := parseWSChannel(msg.Channel)
+		if err != nil {
+			return fail(problem.ValidationFailed, err.Error())
+		}
+		if msg.Type == "subscribe" && ch.kind == "user" {
+			blocked, err := c.cfg.store.IsBlocked(ctx, database.IsBlockedParams{BlockerID: ch.userID, BlockedID: c.userID})
+			if err != nil {
+				slog.ErrorContext(ctx, "couldn't check websocket subscription", "err", err)
+				return fail(problem.Internal, "couldn't subscribe")
+			}
+			if blocked {
+				return fail(problem.Forbidden, "this user has blocked you")
+			}
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		i := slices.IndexFunc(c.channels, func(s wsChannel) bool { return s.name == ch.name })
+		switch {
+		case msg.Type == "unsubscribe" && i >= 0:
+			c.channels = slices.Delete(c.channels, i, i+1)
+		case msg.Type == "subscribe" && i < 0:
+			if len(c.channels) >= wsMaxChannels {
+				return fail(problem.ValidationFailed, "too many channels")
+			}
+			c.channels = append(c.channels, ch)
+		}
+		return wsMessage{Type: "ack", ID: msg.ID, Channel: ch.name}
+
+	case "ping":
+		return wsMessage{Type: "pong", ID: msg.ID}
+
+	case eventTyping, eventPresence:
+		if !c.canSignal {
+			return fail(problem.Forbidden, "restricted accounts can't send "+msg.Type)
+		}
+		data := map[string]any{"user_id": c.userID}
+		if msg.Type == eventPresence {
+			var p struct {
+				Status string `json:"status"`
+			}
+			json.Unmarshal(msg.Data, &p)
+			if p.Status != "online" && p.Status != "away" && p.Status != "offline" {
+				return fail(problem.ValidationFailed, "presence status must be online, away or offline")
+			}
+			data["status"] = p.Status
+		}
+		if last := c.lastSignal[msg.Type]; time.Since(last) < wsSignalBackoff {
+			return wsMessage{}
+		}
+		c.lastSignal[msg.Type] = time.Now()
+		c.cfg.publish(hub.Event{Type: msg.Type, UserID: c.userID, Ephemeral: true}, data)
+		return wsMessage{}
+	}
+	return fail(problem.BadRequest, "unknown message type")
+}
+
+// reply queues msg for the writer. A client that sends faster than it
+// reads its replies is disconnected.
+func (c *wsConn) reply(cancel context.CancelFunc, msg wsMessage) {
+	if msg.Type == "" {
+		return
+	}
+	select {
+	case c.control <- msg:
+	default:
+		c.conn.Close(websocket.StatusPolicyViolation, "sending too fast")
+		cancel()
+	}
+}
+
+// keepalive pings the client so dead connections are noticed and proxies
+// don't time out idle ones.
+func (c *wsConn) keepalive(ctx context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pingCtx, cancelPing := context.WithTimeout(ctx, wsPingTimeout)
+		err := c.conn.Ping(pingCtx)
+		cancelPing()
+		if err != nil {
+			cancel()
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/jwoodsiii/chirpy/internal/problem"
+)
+
+type wsClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func (c *apiClient) websocket(user testUser) *wsClient {
+	c.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url := "ws" + strings.TrimPrefix(c.server.URL, "http") + "/api/ws"
+	conn, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": {user.auth}},
+	})
+	if err != nil {
+		c.t.Fatalf("dial: %v", err)
+	}
+	c.t.Cleanup(func() { conn.CloseNow() })
+	return &wsClient{t: c.t, conn: conn}
+}
+
+func (ws *wsClient) send(msg string) {
+	ws.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ws.conn.Write(ctx, websocket.MessageText, []byte(msg)); err != nil {
+		ws.t.Fatalf("write: %v", err)
+	}
+}
+
+func (ws *wsClient) next() wsMessage {
+	ws.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, b, err := ws.conn.Read(ctx)
+	if err != nil {
+		ws.t.Fatalf("read: %v", err)
+	}
+	var msg wsMessage
+	if err := json.Unmarshal(b, &msg); err != nil {
+		ws.t.Fatal(err)
+	}
+	return msg
+}
+
+func TestWebSocket(t *testing.T) {
+	c := newTestAPI(t)
+	alice := c.signup("alice@example.com")
+	bob := c.signup("bob@example.com")
+
+	if status, _ := c.do("GET", "/api/ws", "", nil); status != http.StatusUnauthorized {
+		t.Errorf("unauthenticated connect: %d, want 401", status)
+	}
+
+	ws := c.websocket(bob)
+	ws.send(`{"type": "subscribe", "id": "1", "channel": "user:` + alice.id + `"}`)
+	ws.send(`{"type": "subscribe", "id": "2", "channel": "tag:Go"}`)
+	ws.send(`{"type": "subscribe", "id": "3", "channel": "tag:"}`)
+	ws.send(`{"type": "ping", "id": "4"}`)
+	ws.send(`{"type": "dance"}`)
+	want := []wsMessage{
+		{Type: "ack", ID: "1"},
+		{Type: "ack", ID: "2"},
+		{Type: "error", ID: "3"},
+		{Type: "pong", ID: "4"},
+		{Type: "error"},
+	}
+	for _, w := range want {
+		if got := ws.next(); got.Type != w.Type || got.ID != w.ID {
+			t.Errorf("reply = %+v, want %s %q", got, w.Type, w.ID)
+		}
+	}
+
+	c.mustDo("POST", "/api/chirps", alice.auth, map[string]string{"body": "hello"})
+	if got := ws.next(); got.Event != eventChirpCreated || got.Channel != "user:"+alice.id || !strings.Contains(string(got.Data), "hello") {
+		t.Errorf("event = %+v, want alice's chirp on her channel", got)
+	}
+	c.mustDo("POST", "/api/chirps", bob.auth, map[string]string{"body": "learning #go today"})
+	if got := ws.next(); got.Event != eventChirpCreated || got.Channel != "tag:go" || got.EventID == "" {
+		t.Errorf("event = %+v, want bob's chirp on tag:go", got)
+	}
+
+	aliceWS := c.websocket(alice)
+	aliceWS.send(`{"type": "typing"}`)
+	if got := ws.next(); got.Event != eventTyping || got.Channel != "user:"+alice.id || got.EventID != "" {
+		t.Errorf("event = %+v, want alice typing without an event ID", got)
+	}
+
+	ws.send(`{"type": "unsubscribe", "id": "5", "channel": "user:` + alice.id + `"}`)
+	if got := ws.next(); got.Type != "ack" {
+		t.Errorf("unsubscribe reply = %+v, want ack", got)
+	}
+	c.mustDo("POST", "/api/chirps", alice.auth, map[string]string{"body": "anyone there?"})
+	ws.send(`{"type": "ping", "id": "6"}`)
+	if got := ws.next(); got.Type != "pong" {
+		t.Errorf("after unsubscribing got %+v, want only the pong", got)
+	}
+}
+
+func TestWebSocketBlocked(t *testing.T) {
+	c := newTestAPI(t)
+	alice := c.signup("alice@example.com")
+	bob := c.signup("bob@example.com")
+	carol := c.signup("carol@example.com")
+	c.mustDo("POST", "/api/users/"+bob.id+"/block", alice.auth, nil)
+	c.mustDo("POST", "/api/users/"+carol.id+"/mute", alice.auth, nil)
+
+	// bob can't follow alice's channel, but she can still follow his, and a
+	// mute doesn't stop carol
+	bobWS := c.websocket(bob)
+	bobWS.send(`{"type": "subscribe", "id": "1", "channel": "user:` + alice.id + `"}`)
+	if got := bobWS.next(); got.Type != "error" || got.Error.Code != problem.Forbidden {
+		t.Errorf("blocked subscribe reply = %+v, want forbidden", got)
+	}
+	aliceWS := c.websocket(alice)
+	aliceWS.send(`{"type": "subscribe", "id": "1", "channel": "user:` + bob.id + `"}`)
+	if got := aliceWS.next(); got.Type != "ack" {
+		t.Errorf("blocker's subscribe reply = %+v, want ack", got)
+	}
+	carolWS := c.websocket(carol)
+	carolWS.send(`{"type": "subscribe", "id": "1", "channel": "user:` + alice.id + `"}`)
+	if got := carolWS.next(); got.Type != "ack" {
+		t.Errorf("muted subscribe reply = %+v, want ack", got)
+	}
+
+	c.mustDo("DELETE", "/api/users/"+bob.id+"/block", alice.auth, nil)
+	bobWS.send(`{"type": "subscribe", "id": "2", "channel": "user:` + alice.id + `"}`)
+	if got := bobWS.next(); got.Type != "ack" {
+		t.Errorf("subscribe reply after unblocking = %+v, want ack", got)
+	}
+}
+
+func TestHashtags(t *testing.T) {
+	got := hashtags("#Go and #go, #café! see https://example.com/#anchor and C# or ## #")
+	want := []string{"go", "café"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("hashtags() = %q, want %q", got, want)
+	}
+}